@@ -1,20 +1,130 @@
 package config
 
-import "app/internal/env"
+import (
+	"time"
+
+	"app/internal/env"
+)
+
+const (
+	envKeyHttpServerPort           = "HTTP_SERVER_PORT"
+	envKeyStorageBackend           = "STORAGE_BACKEND"
+	envKeyPostgresDSN              = "POSTGRES_DSN"
+	envKeyPostgresStatementTimeout = "POSTGRES_STATEMENT_TIMEOUT"
+	envKeyPostgresReplicaDSN       = "POSTGRES_REPLICA_DSN"
+	envKeyPostgresReplicaCooldown  = "POSTGRES_REPLICA_COOLDOWN"
+	envKeyPostgresMaxOpenConns     = "POSTGRES_MAX_OPEN_CONNS"
+	envKeyPostgresMaxIdleConns     = "POSTGRES_MAX_IDLE_CONNS"
+	envKeyPostgresConnMaxLifetime  = "POSTGRES_CONN_MAX_LIFETIME"
+	envKeyPostgresConnMaxIdleTime  = "POSTGRES_CONN_MAX_IDLE_TIME"
+	envKeySQLitePath               = "SQLITE_PATH"
+	envKeySQLiteStatementTimeout   = "SQLITE_STATEMENT_TIMEOUT"
+	envKeyAdminToken               = "ADMIN_TOKEN"
+	envKeySoftDeleteRetention      = "SOFT_DELETE_RETENTION"
+	envKeySoftDeletePurgeInterval  = "SOFT_DELETE_PURGE_INTERVAL"
+	envKeyStorageRetryMaxAttempts  = "STORAGE_RETRY_MAX_ATTEMPTS"
+	envKeyStorageRetryBaseDelay    = "STORAGE_RETRY_BASE_DELAY"
+	envKeyStorageRetryMaxDelay     = "STORAGE_RETRY_MAX_DELAY"
+	envKeyStorageRetryBudget       = "STORAGE_RETRY_BUDGET"
+	envKeyUserCacheSize            = "USER_CACHE_SIZE"
+	envKeyUserCacheTTL             = "USER_CACHE_TTL"
+	envKeySchemaCheck              = "SCHEMA_CHECK"
+	envKeyOutboxPublisher          = "OUTBOX_PUBLISHER"
+	envKeyOutboxFilePath           = "OUTBOX_FILE_PATH"
+	envKeyOutboxWebhookURL         = "OUTBOX_WEBHOOK_URL"
+	envKeyOutboxWebhookSecret      = "OUTBOX_WEBHOOK_SECRET"
+	envKeyOutboxWebhookTimeout     = "OUTBOX_WEBHOOK_TIMEOUT"
+	envKeyOutboxRelayInterval      = "OUTBOX_RELAY_INTERVAL"
+	envKeyOutboxRelayBatchSize     = "OUTBOX_RELAY_BATCH_SIZE"
+	envKeyOutboxMaxAttempts        = "OUTBOX_MAX_ATTEMPTS"
+)
+
+const (
+	StorageBackendPostgres = "postgres"
+	StorageBackendSQLite   = "sqlite"
+	StorageBackendMemory   = "memory"
+)
+
+const (
+	SchemaCheckFail     = "fail"
+	SchemaCheckReadOnly = "read-only"
+	SchemaCheckOff      = "off"
+)
 
 const (
-	envKeyHttpServerPort = "HTTP_SERVER_PORT"
-	envKeyPostgresDSN    = "POSTGRES_DSN"
+	OutboxPublisherStdout  = "stdout"
+	OutboxPublisherFile    = "file"
+	OutboxPublisherWebhook = "webhook"
+	OutboxPublisherOff     = "off"
 )
 
 type Config struct {
-	HttpServerPort int
-	PostgresDSN    string
+	HttpServerPort           int
+	StorageBackend           string
+	PostgresDSN              string
+	PostgresStatementTimeout time.Duration
+	PostgresReplicaDSN       string
+	PostgresReplicaCooldown  time.Duration
+	PostgresMaxOpenConns     int
+	PostgresMaxIdleConns     int
+	PostgresConnMaxLifetime  time.Duration
+	PostgresConnMaxIdleTime  time.Duration
+	SQLitePath               string
+	SQLiteStatementTimeout   time.Duration
+	AdminToken               string
+	SoftDeleteRetention      time.Duration
+	SoftDeletePurgeInterval  time.Duration
+	StorageRetryMaxAttempts  int
+	StorageRetryBaseDelay    time.Duration
+	StorageRetryMaxDelay     time.Duration
+	StorageRetryBudget       time.Duration
+	UserCacheSize            int
+	UserCacheTTL             time.Duration
+	SchemaCheck              string
+	OutboxPublisher          string
+	OutboxFilePath           string
+	OutboxWebhookURL         string
+	OutboxWebhookSecret      string
+	OutboxWebhookTimeout     time.Duration
+	OutboxRelayInterval      time.Duration
+	OutboxRelayBatchSize     int
+	OutboxMaxAttempts        int
 }
 
 func Init() *Config {
+	storageBackend := env.MustString(env.OneOf(envKeyStorageBackend, true, StorageBackendPostgres, StorageBackendPostgres, StorageBackendSQLite, StorageBackendMemory))
+	outboxPublisher := env.MustString(env.OneOf(envKeyOutboxPublisher, true, OutboxPublisherOff, OutboxPublisherStdout, OutboxPublisherFile, OutboxPublisherWebhook, OutboxPublisherOff))
+
 	return &Config{
-		HttpServerPort: env.MustInt(env.Port(envKeyHttpServerPort, true, "8080")),
-		PostgresDSN:    env.MustString(env.String(envKeyPostgresDSN, true, "")),
+		HttpServerPort:           env.MustInt(env.Port(envKeyHttpServerPort, true, "8080")),
+		StorageBackend:           storageBackend,
+		PostgresDSN:              env.MustString(env.String(envKeyPostgresDSN, storageBackend == StorageBackendPostgres, "")),
+		PostgresStatementTimeout: env.MustDuration(env.Duration(envKeyPostgresStatementTimeout, true, "5s")),
+		PostgresReplicaDSN:       env.MustString(env.String(envKeyPostgresReplicaDSN, false, "")),
+		PostgresReplicaCooldown:  env.MustDuration(env.Duration(envKeyPostgresReplicaCooldown, true, "30s")),
+		PostgresMaxOpenConns:     env.MustInt(env.Int(envKeyPostgresMaxOpenConns, true, "20")),
+		PostgresMaxIdleConns:     env.MustInt(env.Int(envKeyPostgresMaxIdleConns, true, "10")),
+		PostgresConnMaxLifetime:  env.MustDuration(env.Duration(envKeyPostgresConnMaxLifetime, true, "30m")),
+		PostgresConnMaxIdleTime:  env.MustDuration(env.Duration(envKeyPostgresConnMaxIdleTime, true, "5m")),
+		SQLitePath:               env.MustString(env.String(envKeySQLitePath, storageBackend == StorageBackendSQLite, "users.sqlite")),
+		SQLiteStatementTimeout:   env.MustDuration(env.Duration(envKeySQLiteStatementTimeout, true, "5s")),
+		AdminToken:               env.MustString(env.String(envKeyAdminToken, false, "")),
+		SoftDeleteRetention:      env.MustDuration(env.Duration(envKeySoftDeleteRetention, true, "720h")),
+		SoftDeletePurgeInterval:  env.MustDuration(env.PositiveDuration(envKeySoftDeletePurgeInterval, true, "1h")),
+		StorageRetryMaxAttempts:  env.MustInt(env.Int(envKeyStorageRetryMaxAttempts, true, "3")),
+		StorageRetryBaseDelay:    env.MustDuration(env.Duration(envKeyStorageRetryBaseDelay, true, "50ms")),
+		StorageRetryMaxDelay:     env.MustDuration(env.Duration(envKeyStorageRetryMaxDelay, true, "1s")),
+		StorageRetryBudget:       env.MustDuration(env.Duration(envKeyStorageRetryBudget, true, "3s")),
+		UserCacheSize:            env.MustInt(env.Int(envKeyUserCacheSize, true, "10000")),
+		UserCacheTTL:             env.MustDuration(env.Duration(envKeyUserCacheTTL, true, "30s")),
+		SchemaCheck:              env.MustString(env.OneOf(envKeySchemaCheck, true, SchemaCheckFail, SchemaCheckFail, SchemaCheckReadOnly, SchemaCheckOff)),
+		OutboxPublisher:          outboxPublisher,
+		OutboxFilePath:           env.MustString(env.String(envKeyOutboxFilePath, outboxPublisher == OutboxPublisherFile, "events.ndjson")),
+		OutboxWebhookURL:         env.MustString(env.String(envKeyOutboxWebhookURL, outboxPublisher == OutboxPublisherWebhook, "")),
+		OutboxWebhookSecret:      env.MustString(env.String(envKeyOutboxWebhookSecret, false, "")),
+		OutboxWebhookTimeout:     env.MustDuration(env.Duration(envKeyOutboxWebhookTimeout, true, "5s")),
+		OutboxRelayInterval:      env.MustDuration(env.PositiveDuration(envKeyOutboxRelayInterval, true, "1s")),
+		OutboxRelayBatchSize:     env.MustInt(env.PositiveInt(envKeyOutboxRelayBatchSize, true, "100")),
+		OutboxMaxAttempts:        env.MustInt(env.PositiveInt(envKeyOutboxMaxAttempts, true, "10")),
 	}
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,11 +14,40 @@ func TestInit(t *testing.T) {
 
 	require.NoError(t, os.Setenv(envKeyHttpServerPort, "81"))
 	require.NoError(t, os.Setenv(envKeyPostgresDSN, "host=postgres port=5432 user=postgres dbname=postgres sslmode=disable"))
+	require.NoError(t, os.Setenv(envKeyPostgresStatementTimeout, "2s"))
+	require.NoError(t, os.Setenv(envKeyAdminToken, "secret"))
+	require.NoError(t, os.Setenv(envKeySoftDeleteRetention, "24h"))
+	require.NoError(t, os.Setenv(envKeyStorageRetryMaxAttempts, "5"))
 
 	t.Run("ok", func(t *testing.T) {
 		expCfg := Config{
-			HttpServerPort: 81,
-			PostgresDSN:    "host=postgres port=5432 user=postgres dbname=postgres sslmode=disable",
+			HttpServerPort:           81,
+			StorageBackend:           StorageBackendPostgres,
+			PostgresDSN:              "host=postgres port=5432 user=postgres dbname=postgres sslmode=disable",
+			PostgresStatementTimeout: 2 * time.Second,
+			PostgresReplicaCooldown:  30 * time.Second,
+			PostgresMaxOpenConns:     20,
+			PostgresMaxIdleConns:     10,
+			PostgresConnMaxLifetime:  30 * time.Minute,
+			PostgresConnMaxIdleTime:  5 * time.Minute,
+			SQLitePath:               "users.sqlite",
+			SQLiteStatementTimeout:   5 * time.Second,
+			AdminToken:               "secret",
+			SoftDeleteRetention:      24 * time.Hour,
+			SoftDeletePurgeInterval:  time.Hour,
+			StorageRetryMaxAttempts:  5,
+			StorageRetryBaseDelay:    50 * time.Millisecond,
+			StorageRetryMaxDelay:     time.Second,
+			StorageRetryBudget:       3 * time.Second,
+			UserCacheSize:            10000,
+			UserCacheTTL:             30 * time.Second,
+			SchemaCheck:              SchemaCheckFail,
+			OutboxPublisher:          OutboxPublisherOff,
+			OutboxFilePath:           "events.ndjson",
+			OutboxWebhookTimeout:     5 * time.Second,
+			OutboxRelayInterval:      time.Second,
+			OutboxRelayBatchSize:     100,
+			OutboxMaxAttempts:        10,
 		}
 
 		require.NotPanics(t, func() {
@@ -32,4 +62,218 @@ func TestInit(t *testing.T) {
 			Init()
 		})
 	})
+
+	t.Run("ok memory backend", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyStorageBackend, StorageBackendMemory))
+		defer os.Unsetenv(envKeyStorageBackend)
+
+		expCfg := Config{
+			HttpServerPort:           81,
+			StorageBackend:           StorageBackendMemory,
+			PostgresDSN:              "",
+			PostgresStatementTimeout: 2 * time.Second,
+			PostgresReplicaCooldown:  30 * time.Second,
+			PostgresMaxOpenConns:     20,
+			PostgresMaxIdleConns:     10,
+			PostgresConnMaxLifetime:  30 * time.Minute,
+			PostgresConnMaxIdleTime:  5 * time.Minute,
+			SQLitePath:               "users.sqlite",
+			SQLiteStatementTimeout:   5 * time.Second,
+			AdminToken:               "secret",
+			SoftDeleteRetention:      24 * time.Hour,
+			SoftDeletePurgeInterval:  time.Hour,
+			StorageRetryMaxAttempts:  5,
+			StorageRetryBaseDelay:    50 * time.Millisecond,
+			StorageRetryMaxDelay:     time.Second,
+			StorageRetryBudget:       3 * time.Second,
+			UserCacheSize:            10000,
+			UserCacheTTL:             30 * time.Second,
+			SchemaCheck:              SchemaCheckFail,
+			OutboxPublisher:          OutboxPublisherOff,
+			OutboxFilePath:           "events.ndjson",
+			OutboxWebhookTimeout:     5 * time.Second,
+			OutboxRelayInterval:      time.Second,
+			OutboxRelayBatchSize:     100,
+			OutboxMaxAttempts:        10,
+		}
+
+		require.NotPanics(t, func() {
+			assert.Equal(t, expCfg, *Init())
+		})
+	})
+
+	t.Run("ok sqlite backend", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyStorageBackend, StorageBackendSQLite))
+		require.NoError(t, os.Setenv(envKeySQLitePath, "/var/lib/user-service/users.sqlite"))
+		require.NoError(t, os.Setenv(envKeySQLiteStatementTimeout, "1s"))
+		defer os.Unsetenv(envKeyStorageBackend)
+		defer os.Unsetenv(envKeySQLitePath)
+		defer os.Unsetenv(envKeySQLiteStatementTimeout)
+
+		expCfg := Config{
+			HttpServerPort:           81,
+			StorageBackend:           StorageBackendSQLite,
+			PostgresDSN:              "",
+			PostgresStatementTimeout: 2 * time.Second,
+			PostgresReplicaCooldown:  30 * time.Second,
+			PostgresMaxOpenConns:     20,
+			PostgresMaxIdleConns:     10,
+			PostgresConnMaxLifetime:  30 * time.Minute,
+			PostgresConnMaxIdleTime:  5 * time.Minute,
+			SQLitePath:               "/var/lib/user-service/users.sqlite",
+			SQLiteStatementTimeout:   time.Second,
+			AdminToken:               "secret",
+			SoftDeleteRetention:      24 * time.Hour,
+			SoftDeletePurgeInterval:  time.Hour,
+			StorageRetryMaxAttempts:  5,
+			StorageRetryBaseDelay:    50 * time.Millisecond,
+			StorageRetryMaxDelay:     time.Second,
+			StorageRetryBudget:       3 * time.Second,
+			UserCacheSize:            10000,
+			UserCacheTTL:             30 * time.Second,
+			SchemaCheck:              SchemaCheckFail,
+			OutboxPublisher:          OutboxPublisherOff,
+			OutboxFilePath:           "events.ndjson",
+			OutboxWebhookTimeout:     5 * time.Second,
+			OutboxRelayInterval:      time.Second,
+			OutboxRelayBatchSize:     100,
+			OutboxMaxAttempts:        10,
+		}
+
+		require.NotPanics(t, func() {
+			assert.Equal(t, expCfg, *Init())
+		})
+	})
+
+	t.Run("ok postgres replica", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyPostgresDSN, "host=postgres port=5432 user=postgres dbname=postgres sslmode=disable"))
+		require.NoError(t, os.Setenv(envKeyPostgresReplicaDSN, "host=postgres-replica port=5432 user=postgres dbname=postgres sslmode=disable"))
+		require.NoError(t, os.Setenv(envKeyPostgresReplicaCooldown, "1m"))
+		defer os.Unsetenv(envKeyPostgresReplicaDSN)
+		defer os.Unsetenv(envKeyPostgresReplicaCooldown)
+
+		cfg := Init()
+
+		assert.Equal(t, "host=postgres-replica port=5432 user=postgres dbname=postgres sslmode=disable", cfg.PostgresReplicaDSN)
+		assert.Equal(t, time.Minute, cfg.PostgresReplicaCooldown)
+	})
+
+	t.Run("ok postgres pool", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyPostgresDSN, "host=postgres port=5432 user=postgres dbname=postgres sslmode=disable"))
+		require.NoError(t, os.Setenv(envKeyPostgresMaxOpenConns, "50"))
+		require.NoError(t, os.Setenv(envKeyPostgresConnMaxIdleTime, "0s"))
+		defer os.Unsetenv(envKeyPostgresMaxOpenConns)
+		defer os.Unsetenv(envKeyPostgresConnMaxIdleTime)
+
+		cfg := Init()
+
+		assert.Equal(t, 50, cfg.PostgresMaxOpenConns)
+		assert.Equal(t, 10, cfg.PostgresMaxIdleConns)
+		assert.Equal(t, time.Duration(0), cfg.PostgresConnMaxIdleTime)
+	})
+
+	t.Run("invalid storage retry error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyStorageBackend, StorageBackendMemory))
+		require.NoError(t, os.Setenv(envKeyStorageRetryBudget, "-1s"))
+		defer os.Unsetenv(envKeyStorageBackend)
+		defer os.Unsetenv(envKeyStorageRetryBudget)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("zero soft delete purge interval error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeySoftDeletePurgeInterval, "0s"))
+		defer os.Unsetenv(envKeySoftDeletePurgeInterval)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("ok schema check", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeySchemaCheck, SchemaCheckReadOnly))
+		defer os.Unsetenv(envKeySchemaCheck)
+
+		assert.Equal(t, SchemaCheckReadOnly, Init().SchemaCheck)
+	})
+
+	t.Run("invalid schema check error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeySchemaCheck, "warn"))
+		defer os.Unsetenv(envKeySchemaCheck)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("ok outbox webhook", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyOutboxPublisher, OutboxPublisherWebhook))
+		require.NoError(t, os.Setenv(envKeyOutboxWebhookURL, "http://events:8080/users"))
+		require.NoError(t, os.Setenv(envKeyOutboxWebhookSecret, "secret"))
+		defer os.Unsetenv(envKeyOutboxPublisher)
+		defer os.Unsetenv(envKeyOutboxWebhookURL)
+		defer os.Unsetenv(envKeyOutboxWebhookSecret)
+
+		cfg := Init()
+
+		assert.Equal(t, OutboxPublisherWebhook, cfg.OutboxPublisher)
+		assert.Equal(t, "http://events:8080/users", cfg.OutboxWebhookURL)
+		assert.Equal(t, "secret", cfg.OutboxWebhookSecret)
+	})
+
+	t.Run("missing outbox webhook url error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyOutboxPublisher, OutboxPublisherWebhook))
+		defer os.Unsetenv(envKeyOutboxPublisher)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("invalid outbox publisher error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyOutboxPublisher, "kafka"))
+		defer os.Unsetenv(envKeyOutboxPublisher)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("zero outbox relay interval error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyOutboxRelayInterval, "0s"))
+		defer os.Unsetenv(envKeyOutboxRelayInterval)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("zero outbox relay batch size error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyOutboxRelayBatchSize, "0"))
+		defer os.Unsetenv(envKeyOutboxRelayBatchSize)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("zero outbox max attempts error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyOutboxMaxAttempts, "0"))
+		defer os.Unsetenv(envKeyOutboxMaxAttempts)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
+
+	t.Run("invalid storage backend error", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKeyStorageBackend, "mysql"))
+		defer os.Unsetenv(envKeyStorageBackend)
+
+		assert.Panics(t, func() {
+			Init()
+		})
+	})
 }
@@ -6,10 +6,13 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"time"
 
 	"app/cmd/config"
 	"app/internal/helpers"
 	"app/internal/httpserver"
+	"app/internal/outbox"
+	"app/internal/purge"
 	"app/internal/storage"
 	_ "github.com/lib/pq"
 )
@@ -17,23 +20,112 @@ import (
 func main() {
 	cfg := config.Init()
 
-	db, err := sql.Open("postgres", cfg.PostgresDSN)
-	if err != nil {
-		log.Fatalf("cannot open postgres connection: error - %s", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Fatalf("cannot close postgres connection: error - %s", err)
+
+	var userStorage storage.UserStorage
+	var statementTimeout time.Duration
+	readOnly := false
+	pools := make(map[string]*sql.DB)
+
+	switch cfg.StorageBackend {
+	case config.StorageBackendMemory:
+		log.Println("using in-memory storage, data is lost on shutdown")
+
+		userStorage = storage.NewMemoryUserStorage()
+	case config.StorageBackendSQLite:
+		db, err := storage.OpenSQLite(cfg.SQLitePath)
+		if err != nil {
+			log.Fatalf("cannot open sqlite database: error - %s", err)
 		}
-	}()
+		defer func() {
+			if err := db.Close(); err != nil {
+				log.Fatalf("cannot close sqlite database: error - %s", err)
+			}
+		}()
+
+		pools["sqlite"] = db
+		statementTimeout = cfg.SQLiteStatementTimeout
+		userStorage = storage.NewSQLiteUserStorage(db, cfg.SQLiteStatementTimeout)
+	default:
+		db, err := sql.Open("postgres", cfg.PostgresDSN)
+		if err != nil {
+			log.Fatalf("cannot open postgres connection: error - %s", err)
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				log.Fatalf("cannot close postgres connection: error - %s", err)
+			}
+		}()
+
+		poolConfig := storage.PoolConfig{
+			MaxOpenConns:    cfg.PostgresMaxOpenConns,
+			MaxIdleConns:    cfg.PostgresMaxIdleConns,
+			ConnMaxLifetime: cfg.PostgresConnMaxLifetime,
+			ConnMaxIdleTime: cfg.PostgresConnMaxIdleTime,
+		}
+		storage.ConfigurePool(db, poolConfig)
+		pools["primary"] = db
+
+		if err := db.Ping(); err != nil {
+			log.Fatalf("cannot ping postgres connection: error - %s", err)
+		}
+
+		readOnly = checkSchema(cfg, db)
+		statementTimeout = cfg.PostgresStatementTimeout
+
+		if cfg.PostgresReplicaDSN == "" {
+			userStorage = storage.NewUserStorage(db, cfg.PostgresStatementTimeout)
+			break
+		}
+
+		replicaDB, err := sql.Open("postgres", cfg.PostgresReplicaDSN)
+		if err != nil {
+			log.Fatalf("cannot open postgres replica connection: error - %s", err)
+		}
+		defer func() {
+			if err := replicaDB.Close(); err != nil {
+				log.Fatalf("cannot close postgres replica connection: error - %s", err)
+			}
+		}()
+
+		storage.ConfigurePool(replicaDB, poolConfig)
+		pools["replica"] = replicaDB
+
+		if err := replicaDB.Ping(); err != nil {
+			log.Println(fmt.Errorf("cannot ping postgres replica connection, reads fall back to primary: error - %s", err))
+		}
+
+		userStorage = storage.NewReplicatedUserStorage(db, replicaDB, cfg.PostgresStatementTimeout, cfg.PostgresReplicaCooldown)
+	}
+
+	eventOutbox, _ := userStorage.(storage.EventOutbox)
+	if cfg.OutboxPublisher == config.OutboxPublisherOff && eventOutbox != nil {
+		eventOutbox.DisableEvents()
+	}
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("cannot ping postgres connection: error - %s", err)
+	if readOnly {
+		userStorage = storage.NewReadOnlyUserStorage(userStorage)
+	}
+
+	userStorage = storage.NewRetryUserStorage(userStorage, storage.RetryPolicy{
+		MaxAttempts: cfg.StorageRetryMaxAttempts,
+		BaseDelay:   cfg.StorageRetryBaseDelay,
+		MaxDelay:    cfg.StorageRetryMaxDelay,
+		Budget:      cfg.StorageRetryBudget,
+	})
+
+	if cfg.UserCacheSize > 0 {
+		userStorage = storage.NewCachedUserStorage(userStorage, cfg.UserCacheSize, cfg.UserCacheTTL, statementTimeout)
 	}
 
 	httpServer := httpserver.New(
 		cfg.HttpServerPort,
-		storage.NewUserStorage(db),
+		userStorage,
+		cfg.AdminToken,
+		pools,
 	)
 
 	httpServerErrCh := make(chan error, 1)
@@ -41,6 +133,25 @@ func main() {
 		httpServerErrCh <- httpServer.Run()
 	}()
 
+	stopPurgerFn := func() {}
+	if cfg.SoftDeleteRetention > 0 && !readOnly {
+		purger := purge.New(userStorage, cfg.SoftDeleteRetention, cfg.SoftDeletePurgeInterval)
+		go purger.Run()
+		stopPurgerFn = purger.Stop
+	}
+
+	stopRelayFn := func() {}
+	if cfg.OutboxPublisher != config.OutboxPublisherOff && eventOutbox != nil && !readOnly {
+		publisher, err := newEventPublisher(cfg)
+		if err != nil {
+			log.Fatalf("cannot create event publisher: error - %s", err)
+		}
+
+		relay := outbox.New(eventOutbox, publisher, cfg.OutboxRelayInterval, cfg.OutboxRelayBatchSize, cfg.OutboxMaxAttempts)
+		go relay.Run()
+		stopRelayFn = relay.Stop
+	}
+
 	systemSignalCh := make(chan os.Signal, 1)
 	signal.Notify(systemSignalCh, os.Interrupt)
 	var shutdownFn func()
@@ -48,10 +159,14 @@ func main() {
 	case <-systemSignalCh:
 		shutdownFn = func() {
 			httpServer.Stop()
+			stopPurgerFn()
+			stopRelayFn()
 		}
 	case err := <-httpServerErrCh:
 		shutdownFn = func() {
 			log.Println(fmt.Errorf("http server unexpectedly stopped: %s", err))
+			stopPurgerFn()
+			stopRelayFn()
 		}
 	}
 	if ok := helpers.WithTimeout(shutdownFn, helpers.DefaultTimeout); !ok {
@@ -60,3 +175,14 @@ func main() {
 
 	log.Println("shut down")
 }
+
+func newEventPublisher(cfg *config.Config) (outbox.Publisher, error) {
+	switch cfg.OutboxPublisher {
+	case config.OutboxPublisherFile:
+		return outbox.NewFilePublisher(cfg.OutboxFilePath)
+	case config.OutboxPublisherWebhook:
+		return outbox.NewWebhookPublisher(cfg.OutboxWebhookURL, cfg.OutboxWebhookSecret, cfg.OutboxWebhookTimeout), nil
+	default:
+		return outbox.NewStdoutPublisher(), nil
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"app/cmd/config"
+	"app/internal/migrate"
+	migrations "app/sql"
+)
+
+func runMigrate(cfg *config.Config, args []string) {
+	if cfg.StorageBackend != config.StorageBackendPostgres {
+		log.Fatalf("migrations are only supported by the %s storage backend", config.StorageBackendPostgres)
+	}
+
+	if len(args) == 0 {
+		log.Fatalln("missing migrate command: up, down [steps|all] or status")
+	}
+
+	loaded := loadMigrations()
+
+	db, err := sql.Open("postgres", cfg.PostgresDSN)
+	if err != nil {
+		log.Fatalf("cannot open postgres connection: error - %s", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Fatalf("cannot close postgres connection: error - %s", err)
+		}
+	}()
+
+	migrator := migrate.New(db, loaded)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			log.Println(fmt.Sprintf("applied migration %02d_%s", migration.Version, migration.Name))
+		}
+		if err != nil {
+			log.Fatalf("cannot migrate up: error - %s", err)
+		}
+
+		log.Println(fmt.Sprintf("migrated up, %d migrations applied", len(applied)))
+	case "down":
+		steps := 1
+		if len(args) > 1 && args[1] == "all" {
+			steps = math.MaxInt32
+		} else if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("invalid number of migrate down steps %s", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			log.Println(fmt.Sprintf("reverted migration %02d_%s", migration.Version, migration.Name))
+		}
+		if err != nil {
+			log.Fatalf("cannot migrate down: error - %s", err)
+		}
+
+		log.Println(fmt.Sprintf("migrated down, %d migrations reverted", len(reverted)))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("cannot read migration status: error - %s", err)
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Println(fmt.Sprintf("%02d_%s\t%s", status.Version, status.Name, appliedAt))
+		}
+	default:
+		log.Fatalf("unknown migrate command %s: up, down [steps|all] or status", args[0])
+	}
+}
+
+func checkSchema(cfg *config.Config, db *sql.DB) bool {
+	if cfg.SchemaCheck == config.SchemaCheckOff {
+		return false
+	}
+
+	mismatch, err := migrate.New(db, loadMigrations()).Mismatch(context.Background())
+	if err != nil {
+		log.Fatalf("cannot check database schema version: error - %s", err)
+	}
+
+	var problem, remedy string
+	switch {
+	case len(mismatch.Unknown) > 0:
+		latest := mismatch.Unknown[len(mismatch.Unknown)-1]
+		problem = fmt.Sprintf("database schema is ahead, %d applied migrations up to %02d are unknown to this build", len(mismatch.Unknown), latest)
+		remedy = "deploy a build that contains them"
+	case len(mismatch.Pending) > 0:
+		latest := mismatch.Pending[len(mismatch.Pending)-1]
+		problem = fmt.Sprintf("database schema is behind, %d migrations up to %02d_%s are pending", len(mismatch.Pending), latest.Version, latest.Name)
+		remedy = "run migrate up"
+	default:
+		return false
+	}
+
+	if cfg.SchemaCheck == config.SchemaCheckFail {
+		log.Fatalf("%s, %s", problem, remedy)
+	}
+
+	log.Println(fmt.Sprintf("%s, starting read-only", problem))
+
+	return true
+}
+
+func loadMigrations() []migrate.Migration {
+	src, err := fs.Sub(migrations.Migrations, "src")
+	if err != nil {
+		log.Fatalf("cannot open migrations: error - %s", err)
+	}
+
+	loaded, err := migrate.Load(src)
+	if err != nil {
+		log.Fatalf("cannot load migrations: error - %s", err)
+	}
+
+	return loaded
+}
@@ -4,8 +4,9 @@ go 1.16
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
-	github.com/google/uuid v1.3.0
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.0
 	github.com/lib/pq v1.10.3
+	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/stretchr/testify v1.7.0
 )
@@ -1,10 +1,242 @@
 package configuration
 
 import (
+	"fmt"
+	"strings"
+
 	"app/internal/response"
 	"github.com/google/uuid"
 )
 
+const (
+	DefaultUsersLimit = 100
+	MaxUsersLimit     = 1000
+)
+
+const (
+	CreateUsersModeAllOrNothing = "all_or_nothing"
+	CreateUsersModeBestEffort   = "best_effort"
+
+	MaxCreateUsers = 1000
+)
+
+const (
+	StatsPeriodDay   = "day"
+	StatsPeriodWeek  = "week"
+	StatsPeriodMonth = "month"
+	StatsPeriodYear  = "year"
+
+	MaxAgeBuckets     = 50
+	MaxAgeBucketBound = 1000
+)
+
+var DefaultAgeBuckets = []int{18, 30, 45, 65}
+
+const (
+	SortFieldUserId = "user_id"
+	SortFieldName   = "name"
+	SortFieldAge    = "age"
+
+	SortDirectionAsc  = "asc"
+	SortDirectionDesc = "desc"
+)
+
+type UsersSort struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
+}
+
+func (srt UsersSort) Desc() bool {
+	return srt.Direction == SortDirectionDesc
+}
+
+type UsersFilter struct {
+	NamePrefix   string      `json:"name_prefix"`
+	NameContains string      `json:"name_contains"`
+	AgeMin       int         `json:"age_min"`
+	AgeMax       int         `json:"age_max"`
+	Sort         []UsersSort `json:"sort"`
+	Deleted      bool        `json:"deleted"`
+}
+
+func (f *UsersFilter) Validate() []response.ValidationError {
+	var vErrs []response.ValidationError
+
+	if len(f.NamePrefix) > 100 {
+		vErrs = append(vErrs, response.ValidationError{Path: "name_prefix", Message: "invalid max length exceeded - (100)"})
+	}
+
+	if len(f.NameContains) > 100 {
+		vErrs = append(vErrs, response.ValidationError{Path: "name_contains", Message: "invalid max length exceeded - (100)"})
+	}
+
+	if f.AgeMin < 0 {
+		vErrs = append(vErrs, response.ValidationError{Path: "age_min", Message: "invalid min value exceeded - (0)"})
+	}
+
+	if f.AgeMax < 0 {
+		vErrs = append(vErrs, response.ValidationError{Path: "age_max", Message: "invalid min value exceeded - (0)"})
+	} else if f.AgeMax > 0 && f.AgeMin > f.AgeMax {
+		vErrs = append(vErrs, response.ValidationError{Path: "age_max", Message: "must be greater than or equal to age_min"})
+	}
+
+	seen := make(map[string]bool, len(f.Sort))
+	for i, srt := range f.Sort {
+		path := fmt.Sprintf("sort[%d]", i)
+
+		switch srt.Field {
+		case SortFieldUserId, SortFieldName, SortFieldAge:
+			if seen[srt.Field] {
+				vErrs = append(vErrs, response.ValidationError{Path: path + ".field", Message: "duplicate sort field"})
+			}
+			seen[srt.Field] = true
+		default:
+			vErrs = append(vErrs, response.ValidationError{Path: path + ".field", Message: "invalid value - (user_id, name, age)"})
+		}
+
+		if srt.Direction != "" && srt.Direction != SortDirectionAsc && srt.Direction != SortDirectionDesc {
+			vErrs = append(vErrs, response.ValidationError{Path: path + ".direction", Message: "invalid value - (asc, desc)"})
+		}
+	}
+
+	return vErrs
+}
+
+func (f *UsersFilter) SortKeys() []UsersSort {
+	keys := make([]UsersSort, 0, len(f.Sort)+1)
+
+	for _, srt := range f.Sort {
+		if srt.Direction == "" {
+			srt.Direction = SortDirectionAsc
+		}
+
+		keys = append(keys, srt)
+
+		if srt.Field == SortFieldUserId {
+			return keys
+		}
+	}
+
+	return append(keys, UsersSort{Field: SortFieldUserId, Direction: SortDirectionAsc})
+}
+
+type UsersRequest struct {
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+	UsersFilter
+}
+
+func (rq *UsersRequest) Validate() []response.ValidationError {
+	return append(validateLimit(rq.Limit), rq.UsersFilter.Validate()...)
+}
+
+func (rq *UsersRequest) PageLimit() int {
+	return pageLimit(rq.Limit)
+}
+
+type UserHistoryRequest struct {
+	UserId string `json:"user_id"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+func (rq *UserHistoryRequest) Validate() []response.ValidationError {
+	var vErrs []response.ValidationError
+
+	if _, err := uuid.Parse(rq.UserId); err != nil {
+		vErrs = append(vErrs, response.ValidationError{Path: "user_id", Message: err.Error()})
+	}
+
+	return append(vErrs, validateLimit(rq.Limit)...)
+}
+
+func (rq *UserHistoryRequest) PageLimit() int {
+	return pageLimit(rq.Limit)
+}
+
+type SearchUsersRequest struct {
+	Query  string `json:"query"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+func (rq *SearchUsersRequest) Validate() []response.ValidationError {
+	var vErrs []response.ValidationError
+
+	if query := strings.TrimSpace(rq.Query); len(query) < 1 || len(query) > 100 {
+		vErrs = append(vErrs, response.ValidationError{Path: "query", Message: "invalid length exceeded - (1-100)"})
+	}
+
+	return append(vErrs, validateLimit(rq.Limit)...)
+}
+
+func (rq *SearchUsersRequest) PageLimit() int {
+	return pageLimit(rq.Limit)
+}
+
+type UsersStatsRequest struct {
+	AgeBuckets    []int  `json:"age_buckets"`
+	CreatedPeriod string `json:"created_period"`
+}
+
+func (rq *UsersStatsRequest) Validate() []response.ValidationError {
+	var vErrs []response.ValidationError
+
+	if len(rq.AgeBuckets) > MaxAgeBuckets {
+		vErrs = append(vErrs, response.ValidationError{Path: "age_buckets", Message: fmt.Sprintf("invalid max length exceeded - (%d)", MaxAgeBuckets)})
+	}
+
+	for i, bound := range rq.AgeBuckets {
+		path := fmt.Sprintf("age_buckets[%d]", i)
+
+		if bound < 1 || bound > MaxAgeBucketBound {
+			vErrs = append(vErrs, response.ValidationError{Path: path, Message: fmt.Sprintf("invalid range exceeded - (1-%d)", MaxAgeBucketBound)})
+		} else if i > 0 && bound <= rq.AgeBuckets[i-1] {
+			vErrs = append(vErrs, response.ValidationError{Path: path, Message: "must be greater than the previous bucket"})
+		}
+	}
+
+	switch rq.CreatedPeriod {
+	case "", StatsPeriodDay, StatsPeriodWeek, StatsPeriodMonth, StatsPeriodYear:
+	default:
+		vErrs = append(vErrs, response.ValidationError{Path: "created_period", Message: "invalid value - (day, week, month, year)"})
+	}
+
+	return vErrs
+}
+
+func (rq *UsersStatsRequest) Buckets() []int {
+	if len(rq.AgeBuckets) == 0 {
+		return DefaultAgeBuckets
+	}
+
+	return rq.AgeBuckets
+}
+
+func (rq *UsersStatsRequest) Period() string {
+	if rq.CreatedPeriod == "" {
+		return StatsPeriodMonth
+	}
+
+	return rq.CreatedPeriod
+}
+
+func validateLimit(limit int) []response.ValidationError {
+	if limit < 0 || limit > MaxUsersLimit {
+		return []response.ValidationError{{Path: "limit", Message: fmt.Sprintf("invalid range exceeded - (1-%d)", MaxUsersLimit)}}
+	}
+
+	return nil
+}
+
+func pageLimit(limit int) int {
+	if limit == 0 {
+		return DefaultUsersLimit
+	}
+
+	return limit
+}
+
 type UserIdentifierRequest struct {
 	UserId string `json:"user_id"`
 }
@@ -32,6 +264,12 @@ func (usr *UserRequest) Validate() []response.ValidationError {
 		vErrs = append(vErrs, response.ValidationError{Path: "user_id", Message: err.Error()})
 	}
 
+	return append(vErrs, usr.validateFields()...)
+}
+
+func (usr *UserRequest) validateFields() []response.ValidationError {
+	var vErrs []response.ValidationError
+
 	if len(usr.Name) < 4 || len(usr.Name) > 100 {
 		vErrs = append(vErrs, response.ValidationError{Path: "name", Message: "invalid length exceeded - (4-100)"})
 	}
@@ -42,3 +280,91 @@ func (usr *UserRequest) Validate() []response.ValidationError {
 
 	return vErrs
 }
+
+type CreateUserRequest struct {
+	UserRequest
+}
+
+func (usr *CreateUserRequest) Validate() []response.ValidationError {
+	if usr.UserId == "" {
+		return usr.validateFields()
+	}
+
+	return usr.UserRequest.Validate()
+}
+
+type UpdateUserRequest struct {
+	UserId  string  `json:"user_id"`
+	Name    *string `json:"name"`
+	Age     *int    `json:"age"`
+	Version int     `json:"version"`
+}
+
+func (usr *UpdateUserRequest) Validate() []response.ValidationError {
+	var vErrs []response.ValidationError
+
+	if _, err := uuid.Parse(usr.UserId); err != nil {
+		vErrs = append(vErrs, response.ValidationError{Path: "user_id", Message: err.Error()})
+	}
+
+	if usr.Name == nil && usr.Age == nil {
+		vErrs = append(vErrs, response.ValidationError{Path: "name", Message: "at least one of name, age is required"})
+	}
+
+	if usr.Name != nil && (len(*usr.Name) < 4 || len(*usr.Name) > 100) {
+		vErrs = append(vErrs, response.ValidationError{Path: "name", Message: "invalid length exceeded - (4-100)"})
+	}
+
+	if usr.Age != nil && *usr.Age < 1 {
+		vErrs = append(vErrs, response.ValidationError{Path: "age", Message: "invalid min value exceeded - (1)"})
+	}
+
+	if usr.Version < 0 {
+		vErrs = append(vErrs, response.ValidationError{Path: "version", Message: "invalid min value exceeded - (0)"})
+	}
+
+	return vErrs
+}
+
+type CreateUsersRequest struct {
+	Users []UserRequest `json:"users"`
+	Mode  string        `json:"mode"`
+}
+
+func (rq *CreateUsersRequest) Validate() []response.ValidationError {
+	var vErrs []response.ValidationError
+
+	if len(rq.Users) < 1 || len(rq.Users) > MaxCreateUsers {
+		vErrs = append(vErrs, response.ValidationError{Path: "users", Message: fmt.Sprintf("invalid length exceeded - (1-%d)", MaxCreateUsers)})
+	}
+
+	if rq.Mode != "" && rq.Mode != CreateUsersModeAllOrNothing && rq.Mode != CreateUsersModeBestEffort {
+		vErrs = append(vErrs, response.ValidationError{Path: "mode", Message: "invalid value - (all_or_nothing, best_effort)"})
+	}
+
+	return vErrs
+}
+
+func (rq *CreateUsersRequest) ValidateUsers() [][]response.ValidationError {
+	vErrs := make([][]response.ValidationError, len(rq.Users))
+	seen := make(map[string]bool, len(rq.Users))
+
+	for i, usr := range rq.Users {
+		path := fmt.Sprintf("users[%d]", i)
+
+		for _, vErr := range usr.Validate() {
+			vErrs[i] = append(vErrs[i], response.ValidationError{Path: path + "." + vErr.Path, Message: vErr.Message})
+		}
+
+		if seen[usr.UserId] {
+			vErrs[i] = append(vErrs[i], response.ValidationError{Path: path + ".user_id", Message: "duplicate user_id"})
+		}
+		seen[usr.UserId] = true
+	}
+
+	return vErrs
+}
+
+func (rq *CreateUsersRequest) Atomic() bool {
+	return rq.Mode != CreateUsersModeBestEffort
+}
@@ -1,12 +1,430 @@
 package configuration
 
 import (
+	"strings"
 	"testing"
 
 	"app/internal/response"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestUsersRequest_Validate(t *testing.T) {
+	type args struct {
+		rq UsersRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				rq: UsersRequest{
+					Limit:  10,
+					Cursor: "cursor",
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "ok default limit",
+			args: args{
+				rq: UsersRequest{},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid min values request body",
+			args: args{
+				rq: UsersRequest{
+					Limit: -1,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "limit",
+						Message: "invalid range exceeded - (1-1000)",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid max values request body",
+			args: args{
+				rq: UsersRequest{
+					Limit: 1001,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "limit",
+						Message: "invalid range exceeded - (1-1000)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.rq.Validate())
+		})
+	}
+}
+
+func TestUsersFilter_Validate(t *testing.T) {
+	type args struct {
+		f UsersFilter
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				f: UsersFilter{
+					NamePrefix:   "Jo",
+					NameContains: "oh",
+					AgeMin:       18,
+					AgeMax:       65,
+					Sort: []UsersSort{
+						{Field: SortFieldAge, Direction: SortDirectionDesc},
+						{Field: SortFieldName},
+					},
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid values request body",
+			args: args{
+				f: UsersFilter{
+					NamePrefix:   string(make([]byte, 101)),
+					NameContains: string(make([]byte, 101)),
+					AgeMin:       -1,
+					AgeMax:       -1,
+					Sort: []UsersSort{
+						{Field: "email", Direction: SortDirectionAsc},
+						{Field: SortFieldName, Direction: "up"},
+						{Field: SortFieldName},
+					},
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{Path: "name_prefix", Message: "invalid max length exceeded - (100)"},
+					{Path: "name_contains", Message: "invalid max length exceeded - (100)"},
+					{Path: "age_min", Message: "invalid min value exceeded - (0)"},
+					{Path: "age_max", Message: "invalid min value exceeded - (0)"},
+					{Path: "sort[0].field", Message: "invalid value - (user_id, name, age)"},
+					{Path: "sort[1].direction", Message: "invalid value - (asc, desc)"},
+					{Path: "sort[2].field", Message: "duplicate sort field"},
+				},
+			},
+		},
+		{
+			name: "invalid age range request body",
+			args: args{
+				f: UsersFilter{
+					AgeMin: 30,
+					AgeMax: 20,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{Path: "age_max", Message: "must be greater than or equal to age_min"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.f.Validate())
+		})
+	}
+}
+
+func TestUsersFilter_SortKeys(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		f := UsersFilter{}
+
+		assert.Equal(t, []UsersSort{{Field: SortFieldUserId, Direction: SortDirectionAsc}}, f.SortKeys())
+	})
+
+	t.Run("user id tiebreaker", func(t *testing.T) {
+		f := UsersFilter{Sort: []UsersSort{{Field: SortFieldName, Direction: SortDirectionDesc}, {Field: SortFieldAge}}}
+
+		assert.Equal(t, []UsersSort{
+			{Field: SortFieldName, Direction: SortDirectionDesc},
+			{Field: SortFieldAge, Direction: SortDirectionAsc},
+			{Field: SortFieldUserId, Direction: SortDirectionAsc},
+		}, f.SortKeys())
+	})
+
+	t.Run("keys after user id are dropped", func(t *testing.T) {
+		f := UsersFilter{Sort: []UsersSort{{Field: SortFieldUserId, Direction: SortDirectionDesc}, {Field: SortFieldAge}}}
+
+		assert.Equal(t, []UsersSort{{Field: SortFieldUserId, Direction: SortDirectionDesc}}, f.SortKeys())
+	})
+}
+
+func TestUsersRequest_PageLimit(t *testing.T) {
+	assert.Equal(t, DefaultUsersLimit, (&UsersRequest{}).PageLimit())
+	assert.Equal(t, 10, (&UsersRequest{Limit: 10}).PageLimit())
+}
+
+func TestUserHistoryRequest_Validate(t *testing.T) {
+	type args struct {
+		rq UserHistoryRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				rq: UserHistoryRequest{
+					UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe",
+					Limit:  10,
+					Cursor: "cursor",
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				rq: UserHistoryRequest{
+					UserId: "invalid",
+					Limit:  1001,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "user_id",
+						Message: "invalid UUID length: 7",
+					},
+					{
+						Path:    "limit",
+						Message: "invalid range exceeded - (1-1000)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.rq.Validate())
+		})
+	}
+}
+
+func TestUserHistoryRequest_PageLimit(t *testing.T) {
+	assert.Equal(t, DefaultUsersLimit, (&UserHistoryRequest{}).PageLimit())
+	assert.Equal(t, 5, (&UserHistoryRequest{Limit: 5}).PageLimit())
+}
+
+func TestSearchUsersRequest_Validate(t *testing.T) {
+	type args struct {
+		rq SearchUsersRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				rq: SearchUsersRequest{
+					Query:  "jon",
+					Limit:  10,
+					Cursor: "cursor",
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				rq: SearchUsersRequest{
+					Query: "   ",
+					Limit: -1,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "query",
+						Message: "invalid length exceeded - (1-100)",
+					},
+					{
+						Path:    "limit",
+						Message: "invalid range exceeded - (1-1000)",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid query length",
+			args: args{
+				rq: SearchUsersRequest{
+					Query: strings.Repeat("a", 101),
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "query",
+						Message: "invalid length exceeded - (1-100)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.rq.Validate())
+		})
+	}
+}
+
+func TestSearchUsersRequest_PageLimit(t *testing.T) {
+	assert.Equal(t, DefaultUsersLimit, (&SearchUsersRequest{}).PageLimit())
+	assert.Equal(t, 5, (&SearchUsersRequest{Limit: 5}).PageLimit())
+}
+
+func TestUsersStatsRequest_Validate(t *testing.T) {
+	tooManyBuckets := make([]int, MaxAgeBuckets+1)
+	for i := range tooManyBuckets {
+		tooManyBuckets[i] = i + 1
+	}
+
+	type args struct {
+		rq UsersStatsRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				rq: UsersStatsRequest{
+					AgeBuckets:    []int{18, 65},
+					CreatedPeriod: StatsPeriodWeek,
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "ok empty",
+			args: args{
+				rq: UsersStatsRequest{},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				rq: UsersStatsRequest{
+					AgeBuckets:    []int{30, 30, 1001},
+					CreatedPeriod: "hour",
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "age_buckets[1]",
+						Message: "must be greater than the previous bucket",
+					},
+					{
+						Path:    "age_buckets[2]",
+						Message: "invalid range exceeded - (1-1000)",
+					},
+					{
+						Path:    "created_period",
+						Message: "invalid value - (day, week, month, year)",
+					},
+				},
+			},
+		},
+		{
+			name: "too many buckets",
+			args: args{
+				rq: UsersStatsRequest{
+					AgeBuckets: tooManyBuckets,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "age_buckets",
+						Message: "invalid max length exceeded - (50)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.rq.Validate())
+		})
+	}
+}
+
+func TestUsersStatsRequest_defaults(t *testing.T) {
+	rq := UsersStatsRequest{}
+	assert.Equal(t, DefaultAgeBuckets, rq.Buckets())
+	assert.Equal(t, StatsPeriodMonth, rq.Period())
+
+	rq = UsersStatsRequest{AgeBuckets: []int{21}, CreatedPeriod: StatsPeriodDay}
+	assert.Equal(t, []int{21}, rq.Buckets())
+	assert.Equal(t, StatsPeriodDay, rq.Period())
+}
+
 func TestUserIdentifierRequest_Validate(t *testing.T) {
 	type args struct {
 		usr UserIdentifierRequest
@@ -186,3 +604,267 @@ func TestUserRequest_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateUserRequest_Validate(t *testing.T) {
+	type args struct {
+		usr CreateUserRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				usr: CreateUserRequest{UserRequest{UserId: "bc5bfa3b-8270-4aaf-b80b-f51836268747", Name: "John Doe", Age: 41}},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "ok without user id",
+			args: args{
+				usr: CreateUserRequest{UserRequest{Name: "John Doe", Age: 41}},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid user id request body",
+			args: args{
+				usr: CreateUserRequest{UserRequest{UserId: "bc5bfa3b_8270_4aaf_b80b_f51836268747", Name: "John Doe", Age: 41}},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "user_id",
+						Message: "invalid UUID format",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid values without user id request body",
+			args: args{
+				usr: CreateUserRequest{UserRequest{Name: "usr", Age: 0}},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "name",
+						Message: "invalid length exceeded - (4-100)",
+					},
+					{
+						Path:    "age",
+						Message: "invalid min value exceeded - (1)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.usr.Validate())
+		})
+	}
+}
+
+func TestUpdateUserRequest_Validate(t *testing.T) {
+	name := "John Doe"
+	shortName := "Jo"
+	age := 42
+	zeroAge := 0
+
+	type args struct {
+		usr UpdateUserRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				usr: UpdateUserRequest{
+					UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe",
+					Name:   &name,
+					Age:    &age,
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "ok only age",
+			args: args{
+				usr: UpdateUserRequest{
+					UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe",
+					Age:    &age,
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "no fields",
+			args: args{
+				usr: UpdateUserRequest{
+					UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe",
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "name",
+						Message: "at least one of name, age is required",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid values",
+			args: args{
+				usr: UpdateUserRequest{
+					UserId:  "u-1",
+					Name:    &shortName,
+					Age:     &zeroAge,
+					Version: -1,
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "user_id",
+						Message: "invalid UUID length: 3",
+					},
+					{
+						Path:    "name",
+						Message: "invalid length exceeded - (4-100)",
+					},
+					{
+						Path:    "age",
+						Message: "invalid min value exceeded - (1)",
+					},
+					{
+						Path:    "version",
+						Message: "invalid min value exceeded - (0)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.usr.Validate())
+		})
+	}
+}
+
+func TestCreateUsersRequest_Validate(t *testing.T) {
+	type args struct {
+		rq CreateUsersRequest
+	}
+	type exp struct {
+		errors []response.ValidationError
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				rq: CreateUsersRequest{
+					Users: []UserRequest{{}},
+					Mode:  CreateUsersModeBestEffort,
+				},
+			},
+			exp: exp{
+				errors: nil,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				rq: CreateUsersRequest{
+					Mode: "sometimes",
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "users",
+						Message: "invalid length exceeded - (1-1000)",
+					},
+					{
+						Path:    "mode",
+						Message: "invalid value - (all_or_nothing, best_effort)",
+					},
+				},
+			},
+		},
+		{
+			name: "too many users",
+			args: args{
+				rq: CreateUsersRequest{
+					Users: make([]UserRequest, MaxCreateUsers+1),
+				},
+			},
+			exp: exp{
+				errors: []response.ValidationError{
+					{
+						Path:    "users",
+						Message: "invalid length exceeded - (1-1000)",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp.errors, tc.args.rq.Validate())
+		})
+	}
+}
+
+func TestCreateUsersRequest_ValidateUsers(t *testing.T) {
+	rq := CreateUsersRequest{
+		Users: []UserRequest{
+			{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42},
+			{UserId: "63df08d2-fa53-4575-a681-99058f8daba5", Name: "Jo", Age: 20},
+			{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42},
+		},
+	}
+
+	assert.Equal(t, [][]response.ValidationError{
+		nil,
+		{
+			{Path: "users[1].name", Message: "invalid length exceeded - (4-100)"},
+		},
+		{
+			{Path: "users[2].user_id", Message: "duplicate user_id"},
+		},
+	}, rq.ValidateUsers())
+}
+
+func TestCreateUsersRequest_Atomic(t *testing.T) {
+	assert.True(t, (&CreateUsersRequest{}).Atomic())
+	assert.True(t, (&CreateUsersRequest{Mode: CreateUsersModeAllOrNothing}).Atomic())
+	assert.False(t, (&CreateUsersRequest{Mode: CreateUsersModeBestEffort}).Atomic())
+}
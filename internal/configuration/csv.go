@@ -0,0 +1,185 @@
+package configuration
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"app/internal/response"
+)
+
+const MaxImportUsers = 10000
+
+const (
+	CSVColumnUserId = "user_id"
+	CSVColumnName   = "name"
+	CSVColumnAge    = "age"
+)
+
+const utf8BOM = "\ufeff"
+
+const (
+	csvFormulaEscape   = "'"
+	csvFormulaPrefixes = "=+-@\t\r'"
+)
+
+var EmptyCSVErr = errors.New("empty csv, a header row with the columns name and age is required")
+
+type ImportUserRow struct {
+	Line int
+	CreateUserRequest
+	ageErr bool
+}
+
+type ImportUsersRequest struct {
+	Rows []ImportUserRow
+}
+
+func ParseUsersCSV(r io.Reader) (ImportUsersRequest, error) {
+	br := bufio.NewReader(r)
+	reader := csv.NewReader(br)
+	reader.TrimLeadingSpace = true
+
+	line := 1 + skipBlankLines(br)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return ImportUsersRequest{}, EmptyCSVErr
+	}
+	if err != nil {
+		return ImportUsersRequest{}, fmt.Errorf("invalid csv - %s", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, utf8BOM)))] = i
+	}
+
+	for _, name := range []string{CSVColumnName, CSVColumnAge} {
+		if _, ok := columns[name]; !ok {
+			return ImportUsersRequest{}, fmt.Errorf("invalid csv - missing column %s", name)
+		}
+	}
+
+	line += recordLines(header)
+
+	var rq ImportUsersRequest
+
+	for {
+		line += skipBlankLines(br)
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImportUsersRequest{}, fmt.Errorf("invalid csv - %s", err)
+		}
+
+		if len(rq.Rows) == MaxImportUsers {
+			return ImportUsersRequest{}, fmt.Errorf("invalid csv - max rows exceeded - (%d)", MaxImportUsers)
+		}
+
+		row := ImportUserRow{Line: line}
+		row.UserId = csvField(record, columns, CSVColumnUserId)
+		row.Name = UnescapeCSVFormula(csvField(record, columns, CSVColumnName))
+
+		age, err := strconv.Atoi(csvField(record, columns, CSVColumnAge))
+		if err != nil {
+			row.ageErr = true
+		}
+		row.Age = age
+
+		rq.Rows = append(rq.Rows, row)
+		line += recordLines(record)
+	}
+
+	return rq, nil
+}
+
+func (rq *ImportUsersRequest) ValidateRows() [][]response.ValidationError {
+	vErrs := make([][]response.ValidationError, len(rq.Rows))
+	seen := make(map[string]int, len(rq.Rows))
+
+	for i, row := range rq.Rows {
+		if row.ageErr {
+			vErrs[i] = append(vErrs[i], response.ValidationError{Path: CSVColumnAge, Message: "invalid integer"})
+		}
+
+		for _, vErr := range row.Validate() {
+			if row.ageErr && vErr.Path == CSVColumnAge {
+				continue
+			}
+
+			vErrs[i] = append(vErrs[i], vErr)
+		}
+
+		if row.UserId == "" {
+			continue
+		}
+
+		if line, ok := seen[row.UserId]; ok {
+			vErrs[i] = append(vErrs[i], response.ValidationError{Path: CSVColumnUserId, Message: fmt.Sprintf("duplicate user_id - (line %d)", line)})
+			continue
+		}
+		seen[row.UserId] = row.Line
+	}
+
+	return vErrs
+}
+
+func skipBlankLines(br *bufio.Reader) int {
+	skipped := 0
+
+	for {
+		b, _ := br.Peek(2)
+		switch {
+		case len(b) > 0 && b[0] == '\n':
+			_, _ = br.Discard(1)
+		case len(b) > 1 && b[0] == '\r' && b[1] == '\n':
+			_, _ = br.Discard(2)
+		default:
+			return skipped
+		}
+
+		skipped++
+	}
+}
+
+func recordLines(record []string) int {
+	lines := 1
+	for _, field := range record {
+		lines += strings.Count(field, "\n")
+	}
+
+	return lines
+}
+
+func csvField(record []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
+
+func EscapeCSVFormula(s string) string {
+	if s != "" && strings.ContainsRune(csvFormulaPrefixes, rune(s[0])) {
+		return csvFormulaEscape + s
+	}
+
+	return s
+}
+
+func UnescapeCSVFormula(s string) string {
+	if len(s) > 1 && strings.HasPrefix(s, csvFormulaEscape) && strings.ContainsRune(csvFormulaPrefixes, rune(s[1])) {
+		return s[1:]
+	}
+
+	return s
+}
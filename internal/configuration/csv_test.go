@@ -0,0 +1,186 @@
+package configuration
+
+import (
+	"strings"
+	"testing"
+
+	"app/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUsersCSV(t *testing.T) {
+	type args struct {
+		csv string
+	}
+	type exp struct {
+		rows []ImportUserRow
+		err  string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				csv: "\ufeffUser_Id,Name,Age,version\n" +
+					"7df661d5-47e3-4533-baa6-5f952d18bffe, John Doe ,42,1\n" +
+					",\"Doe, Jane\",30,\n",
+			},
+			exp: exp{
+				rows: []ImportUserRow{
+					{Line: 2, CreateUserRequest: CreateUserRequest{UserRequest{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42}}},
+					{Line: 3, CreateUserRequest: CreateUserRequest{UserRequest{Name: "Doe, Jane", Age: 30}}},
+				},
+			},
+		},
+		{
+			name: "ok physical lines",
+			args: args{
+				csv: "\nname,age\r\n\r\nJohn Doe,42\n\n\"Jane\nDoe\",30\n\"Max\r\nMustermann\",old\n",
+			},
+			exp: exp{
+				rows: []ImportUserRow{
+					{Line: 4, CreateUserRequest: CreateUserRequest{UserRequest{Name: "John Doe", Age: 42}}},
+					{Line: 6, CreateUserRequest: CreateUserRequest{UserRequest{Name: "Jane\nDoe", Age: 30}}},
+					{Line: 8, CreateUserRequest: CreateUserRequest{UserRequest{Name: "Max\nMustermann"}}, ageErr: true},
+				},
+			},
+		},
+		{
+			name: "ok escaped formula",
+			args: args{
+				csv: "name,age\n'=1+2,42\n'Jo'hn,30\n",
+			},
+			exp: exp{
+				rows: []ImportUserRow{
+					{Line: 2, CreateUserRequest: CreateUserRequest{UserRequest{Name: "=1+2", Age: 42}}},
+					{Line: 3, CreateUserRequest: CreateUserRequest{UserRequest{Name: "'Jo'hn", Age: 30}}},
+				},
+			},
+		},
+		{
+			name: "ok without user_id column",
+			args: args{
+				csv: "age,name\n42,John Doe\n",
+			},
+			exp: exp{
+				rows: []ImportUserRow{
+					{Line: 2, CreateUserRequest: CreateUserRequest{UserRequest{Name: "John Doe", Age: 42}}},
+				},
+			},
+		},
+		{
+			name: "ok invalid age",
+			args: args{
+				csv: "name,age\nJohn Doe,old\n",
+			},
+			exp: exp{
+				rows: []ImportUserRow{
+					{Line: 2, CreateUserRequest: CreateUserRequest{UserRequest{Name: "John Doe"}}, ageErr: true},
+				},
+			},
+		},
+		{
+			name: "empty error",
+			args: args{
+				csv: "",
+			},
+			exp: exp{
+				err: EmptyCSVErr.Error(),
+			},
+		},
+		{
+			name: "missing column error",
+			args: args{
+				csv: "user_id,name\n",
+			},
+			exp: exp{
+				err: "invalid csv - missing column age",
+			},
+		},
+		{
+			name: "wrong number of fields error",
+			args: args{
+				csv: "name,age\nJohn Doe,42,1\n",
+			},
+			exp: exp{
+				err: "invalid csv - record on line 2: wrong number of fields",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rq, err := ParseUsersCSV(strings.NewReader(tc.args.csv))
+			if tc.exp.err != "" {
+				assert.EqualError(t, err, tc.exp.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp.rows, rq.Rows)
+		})
+	}
+}
+
+func TestParseUsersCSV_maxRows(t *testing.T) {
+	csv := "name,age\n" + strings.Repeat("John Doe,42\n", MaxImportUsers+1)
+
+	_, err := ParseUsersCSV(strings.NewReader(csv))
+
+	assert.EqualError(t, err, "invalid csv - max rows exceeded - (10000)")
+}
+
+func TestImportUsersRequest_ValidateRows(t *testing.T) {
+	rq, err := ParseUsersCSV(strings.NewReader(
+		"user_id,name,age\n" +
+			"7df661d5-47e3-4533-baa6-5f952d18bffe,John Doe,42\n" +
+			",Jane Doe,30\n" +
+			"u-1,Jo,old\n" +
+			"7df661d5-47e3-4533-baa6-5f952d18bffe,John Again,43\n",
+	))
+	require.NoError(t, err)
+
+	expErrs := [][]response.ValidationError{
+		nil,
+		nil,
+		{
+			{Path: "age", Message: "invalid integer"},
+			{Path: "user_id", Message: "invalid UUID length: 3"},
+			{Path: "name", Message: "invalid length exceeded - (4-100)"},
+		},
+		{
+			{Path: "user_id", Message: "duplicate user_id - (line 2)"},
+		},
+	}
+
+	assert.Equal(t, expErrs, rq.ValidateRows())
+}
+
+func TestEscapeCSVFormula(t *testing.T) {
+	tcs := []struct {
+		name    string
+		value   string
+		escaped string
+	}{
+		{name: "plain", value: "John Doe", escaped: "John Doe"},
+		{name: "empty", value: "", escaped: ""},
+		{name: "equals", value: "=SUM(A1:A2)", escaped: "'=SUM(A1:A2)"},
+		{name: "plus", value: "+420 John", escaped: "'+420 John"},
+		{name: "minus", value: "-John", escaped: "'-John"},
+		{name: "at", value: "@John", escaped: "'@John"},
+		{name: "tab", value: "\tJohn", escaped: "'\tJohn"},
+		{name: "quote", value: "'John", escaped: "''John"},
+		{name: "inner formula", value: "John =1+2", escaped: "John =1+2"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.escaped, EscapeCSVFormula(tc.value))
+			assert.Equal(t, tc.value, UnescapeCSVFormula(tc.escaped))
+		})
+	}
+}
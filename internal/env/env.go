@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type InvalidValueError struct {
@@ -53,6 +55,19 @@ func Int(key string, required bool, defaultValue string) (int, error) {
 	return v, nil
 }
 
+func PositiveInt(key string, required bool, defaultValue string) (int, error) {
+	v, err := Int(key, required, defaultValue)
+	if err != nil {
+		return 0, err
+	}
+
+	if v <= 0 {
+		return 0, NewInvalidValueError(key, strconv.Itoa(v), errors.New("value must be positive"))
+	}
+
+	return v, nil
+}
+
 func MustInt(v int, err error) int {
 	if err != nil {
 		panic(err)
@@ -61,6 +76,60 @@ func MustInt(v int, err error) int {
 	return v
 }
 
+func Duration(key string, required bool, defaultValue string) (time.Duration, error) {
+	s, err := String(key, required, defaultValue)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, NewInvalidValueError(key, s, err)
+	}
+
+	if v < 0 {
+		return 0, NewInvalidValueError(key, s, errors.New("duration must not be negative"))
+	}
+
+	return v, nil
+}
+
+func PositiveDuration(key string, required bool, defaultValue string) (time.Duration, error) {
+	v, err := Duration(key, required, defaultValue)
+	if err != nil {
+		return 0, err
+	}
+
+	if v == 0 {
+		return 0, NewInvalidValueError(key, v.String(), errors.New("duration must be positive"))
+	}
+
+	return v, nil
+}
+
+func MustDuration(v time.Duration, err error) time.Duration {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+func OneOf(key string, required bool, defaultValue string, allowed ...string) (string, error) {
+	s, err := String(key, required, defaultValue)
+	if err != nil {
+		return "", err
+	}
+
+	for _, a := range allowed {
+		if s == a {
+			return s, nil
+		}
+	}
+
+	return "", NewInvalidValueError(key, s, fmt.Errorf("value must be one of - (%s)", strings.Join(allowed, ", ")))
+}
+
 func String(key string, required bool, defaultValue string) (string, error) {
 	v, ok := os.LookupEnv(key)
 	if !ok {
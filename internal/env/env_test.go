@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -191,6 +192,87 @@ func TestInt(t *testing.T) {
 	}
 }
 
+func TestPositiveInt(t *testing.T) {
+	const (
+		envKeyFilled   = "TEST_FILLED"
+		envKeyZero     = "TEST_ZERO"
+		envKeyNegative = "TEST_NEGATIVE"
+		envKeyNotSet   = "TEST_NOT_SET"
+	)
+
+	os.Clearenv()
+
+	require.NoError(t, os.Setenv(envKeyFilled, "100"))
+	require.NoError(t, os.Setenv(envKeyZero, "0"))
+	require.NoError(t, os.Setenv(envKeyNegative, "-1"))
+
+	type args struct {
+		key          string
+		required     bool
+		defaultValue string
+	}
+	type exp struct {
+		value int
+		error bool
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "filled",
+			args: args{
+				key: envKeyFilled, required: true, defaultValue: "",
+			},
+			exp: exp{
+				value: 100, error: false,
+			},
+		},
+		{
+			name: "zero",
+			args: args{
+				key: envKeyZero, required: true, defaultValue: "10",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "negative",
+			args: args{
+				key: envKeyNegative, required: true, defaultValue: "10",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "unset with default",
+			args: args{
+				key: envKeyNotSet, required: true, defaultValue: "10",
+			},
+			exp: exp{
+				value: 10, error: false,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := PositiveInt(tc.args.key, tc.args.required, tc.args.defaultValue)
+
+			if tc.exp.error {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.exp.value, v)
+		})
+	}
+}
+
 func TestMustInt(t *testing.T) {
 	os.Clearenv()
 
@@ -207,6 +289,274 @@ func TestMustInt(t *testing.T) {
 	})
 }
 
+func TestDuration(t *testing.T) {
+	const (
+		envKeyFilled   = "TEST_FILLED"
+		envKeyInvalid  = "TEST_INVALID"
+		envKeyNegative = "TEST_NEGATIVE"
+		envKeyEmpty    = "TEST_EMPTY"
+		envKeyNotSet   = "TEST_NOT_SET"
+	)
+
+	os.Clearenv()
+
+	require.NoError(t, os.Setenv(envKeyFilled, "1m30s"))
+	require.NoError(t, os.Setenv(envKeyInvalid, "30"))
+	require.NoError(t, os.Setenv(envKeyNegative, "-1s"))
+	require.NoError(t, os.Setenv(envKeyEmpty, ""))
+
+	type args struct {
+		key          string
+		required     bool
+		defaultValue string
+	}
+	type exp struct {
+		value time.Duration
+		error bool
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "filled",
+			args: args{
+				key: envKeyFilled, required: true, defaultValue: "",
+			},
+			exp: exp{
+				value: 90 * time.Second, error: false,
+			},
+		},
+		{
+			name: "invalid",
+			args: args{
+				key: envKeyInvalid, required: false, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "negative",
+			args: args{
+				key: envKeyNegative, required: false, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "empty with default",
+			args: args{
+				key: envKeyEmpty, required: true, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "unset with default",
+			args: args{
+				key: envKeyNotSet, required: true, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 5 * time.Second, error: false,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Duration(tc.args.key, tc.args.required, tc.args.defaultValue)
+
+			if tc.exp.error {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.exp.value, v)
+		})
+	}
+}
+
+func TestPositiveDuration(t *testing.T) {
+	const (
+		envKeyFilled  = "TEST_FILLED"
+		envKeyZero    = "TEST_ZERO"
+		envKeyInvalid = "TEST_INVALID"
+		envKeyNotSet  = "TEST_NOT_SET"
+	)
+
+	os.Clearenv()
+
+	require.NoError(t, os.Setenv(envKeyFilled, "1m30s"))
+	require.NoError(t, os.Setenv(envKeyZero, "0s"))
+	require.NoError(t, os.Setenv(envKeyInvalid, "30"))
+
+	type args struct {
+		key          string
+		required     bool
+		defaultValue string
+	}
+	type exp struct {
+		value time.Duration
+		error bool
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "filled",
+			args: args{
+				key: envKeyFilled, required: true, defaultValue: "",
+			},
+			exp: exp{
+				value: 90 * time.Second, error: false,
+			},
+		},
+		{
+			name: "zero",
+			args: args{
+				key: envKeyZero, required: true, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "invalid",
+			args: args{
+				key: envKeyInvalid, required: false, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 0, error: true,
+			},
+		},
+		{
+			name: "unset with default",
+			args: args{
+				key: envKeyNotSet, required: true, defaultValue: "5s",
+			},
+			exp: exp{
+				value: 5 * time.Second, error: false,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := PositiveDuration(tc.args.key, tc.args.required, tc.args.defaultValue)
+
+			if tc.exp.error {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.exp.value, v)
+		})
+	}
+}
+
+func TestMustDuration(t *testing.T) {
+	os.Clearenv()
+
+	t.Run("ok", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			MustDuration(Duration("TEST_NOT_SET", false, "0s"))
+		})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert.Panics(t, func() {
+			MustDuration(Duration("TEST_NOT_SET", true, ""))
+		})
+	})
+}
+
+func TestOneOf(t *testing.T) {
+	const (
+		envKeyFilled  = "TEST_FILLED"
+		envKeyInvalid = "TEST_INVALID"
+		envKeyNotSet  = "TEST_NOT_SET"
+	)
+
+	os.Clearenv()
+
+	require.NoError(t, os.Setenv(envKeyFilled, "b"))
+	require.NoError(t, os.Setenv(envKeyInvalid, "c"))
+
+	type args struct {
+		key          string
+		required     bool
+		defaultValue string
+	}
+	type exp struct {
+		value string
+		err   bool
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "filled",
+			args: args{
+				key: envKeyFilled, required: true, defaultValue: "a",
+			},
+			exp: exp{
+				value: "b", err: false,
+			},
+		},
+		{
+			name: "invalid",
+			args: args{
+				key: envKeyInvalid, required: true, defaultValue: "a",
+			},
+			exp: exp{
+				value: "", err: true,
+			},
+		},
+		{
+			name: "unset with default",
+			args: args{
+				key: envKeyNotSet, required: true, defaultValue: "a",
+			},
+			exp: exp{
+				value: "a", err: false,
+			},
+		},
+		{
+			name: "unset required",
+			args: args{
+				key: envKeyNotSet, required: true, defaultValue: "",
+			},
+			exp: exp{
+				value: "", err: true,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := OneOf(tc.args.key, tc.args.required, tc.args.defaultValue, "a", "b")
+
+			if tc.exp.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.exp.value, v)
+		})
+	}
+}
+
 func TestString(t *testing.T) {
 	const (
 		envKeyFilled = "TEST_FILLED"
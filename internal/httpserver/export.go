@@ -0,0 +1,99 @@
+package httpserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/internal/configuration"
+	"app/internal/storage"
+)
+
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+)
+
+var csvExportHeader = []string{
+	configuration.CSVColumnUserId,
+	configuration.CSVColumnName,
+	configuration.CSVColumnAge,
+	"version",
+	"deleted_at",
+	"created_at",
+	"updated_at",
+}
+
+type usersEncoder interface {
+	ContentType() string
+	Begin() error
+	Encode(usr storage.User) error
+	Flush() error
+}
+
+func newUsersEncoder(r *http.Request, w io.Writer) usersEncoder {
+	if strings.Contains(r.Header.Get(headerAccept), contentTypeCSV) {
+		return &csvUsersEncoder{w: csv.NewWriter(w)}
+	}
+
+	return &ndjsonUsersEncoder{enc: json.NewEncoder(w)}
+}
+
+type ndjsonUsersEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonUsersEncoder) ContentType() string {
+	return contentTypeNDJSON
+}
+
+func (e *ndjsonUsersEncoder) Begin() error {
+	return nil
+}
+
+func (e *ndjsonUsersEncoder) Encode(usr storage.User) error {
+	return e.enc.Encode(usr)
+}
+
+func (e *ndjsonUsersEncoder) Flush() error {
+	return nil
+}
+
+type csvUsersEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvUsersEncoder) ContentType() string {
+	return contentTypeCSV
+}
+
+func (e *csvUsersEncoder) Begin() error {
+	return e.w.Write(csvExportHeader)
+}
+
+func (e *csvUsersEncoder) Encode(usr storage.User) error {
+	var deletedAt string
+	if usr.DeletedAt != nil {
+		deletedAt = usr.DeletedAt.Format(time.RFC3339Nano)
+	}
+
+	return e.w.Write([]string{
+		usr.UserId,
+		configuration.EscapeCSVFormula(usr.Name),
+		strconv.Itoa(usr.Age),
+		strconv.Itoa(usr.Version),
+		deletedAt,
+		usr.CreatedAt.Format(time.RFC3339Nano),
+		usr.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvUsersEncoder) Flush() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
@@ -1,41 +1,352 @@
 package httpserver
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"app/internal/configuration"
 	"app/internal/response"
 	"app/internal/storage"
+	"github.com/google/uuid"
 )
 
 type HandlerInterface interface {
 	Users(w http.ResponseWriter, r *http.Request)
 	User(w http.ResponseWriter, r *http.Request)
 	CreateUser(w http.ResponseWriter, r *http.Request)
+	CreateUsers(w http.ResponseWriter, r *http.Request)
 	UpdateUser(w http.ResponseWriter, r *http.Request)
+	PutUser(w http.ResponseWriter, r *http.Request)
 	DeleteUser(w http.ResponseWriter, r *http.Request)
+	RestoreUser(w http.ResponseWriter, r *http.Request)
+	UserHistory(w http.ResponseWriter, r *http.Request)
+	DBStats(w http.ResponseWriter, r *http.Request)
+	ExportUsers(w http.ResponseWriter, r *http.Request)
+	ImportUsers(w http.ResponseWriter, r *http.Request)
+	SearchUsers(w http.ResponseWriter, r *http.Request)
+	UsersStats(w http.ResponseWriter, r *http.Request)
+}
+
+const (
+	headerAccept         = "Accept"
+	headerContentType    = "Content-Type"
+	headerAdminToken     = "X-Admin-Token"
+	headerETag           = "ETag"
+	headerIfMatch        = "If-Match"
+	headerPrincipal      = "X-Principal"
+	headerReadYourWrites = "X-Read-Your-Writes"
+)
+
+const (
+	exportFlushRows = 100
+	queryDryRun     = "dry_run"
+)
+
+const (
+	importActionCreated  = "created"
+	importActionUpdated  = "updated"
+	importActionRejected = "rejected"
+)
+
+var invalidIfMatchErr = errors.New("invalid If-Match header")
+
+type putUserResponse struct {
+	Created bool         `json:"created"`
+	User    storage.User `json:"user"`
+}
+
+type createUsersResponse struct {
+	Created int                        `json:"created"`
+	Errors  []response.ValidationError `json:"errors,omitempty"`
+}
+
+type importUsersResponse struct {
+	DryRun   bool            `json:"dry_run"`
+	Created  int             `json:"created"`
+	Updated  int             `json:"updated"`
+	Rejected int             `json:"rejected"`
+	Rows     []importUserRow `json:"rows"`
+}
+
+type importUserRow struct {
+	Line   int                        `json:"line"`
+	UserId string                     `json:"user_id,omitempty"`
+	Action string                     `json:"action"`
+	Errors []response.ValidationError `json:"errors,omitempty"`
+}
+
+type dbStatsResponse struct {
+	Pools map[string]storage.PoolStats `json:"pools"`
+	Cache *storage.CacheStats          `json:"cache,omitempty"`
 }
 
 type handler struct {
-	ust storage.UserStorage
+	ust        storage.UserStorage
+	adminToken string
+	pools      map[string]*sql.DB
 }
 
-func newHandler(ust storage.UserStorage) HandlerInterface {
+func newHandler(ust storage.UserStorage, adminToken string, pools map[string]*sql.DB) HandlerInterface {
 	return &handler{
-		ust: ust,
+		ust:        ust,
+		adminToken: adminToken,
+		pools:      pools,
 	}
 }
 
-func (h *handler) Users(w http.ResponseWriter, _ *http.Request) {
-	users, err := h.ust.Users()
+func (h *handler) Users(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.UsersRequest
+
+	ok := parseOptionalRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	if rb.Deleted && !h.isAdmin(r) {
+		response.WriteForbiddenError("listing deleted users requires admin token", w)
+		return
+	}
+
+	users, err := h.ust.Users(r.Context(), rb.UsersFilter, rb.PageLimit(), rb.Cursor)
 	if err != nil {
-		response.WriteInternalServerError(err, w)
+		if err == storage.InvalidCursorErr {
+			response.WriteUnprocessableEntitiesError([]response.ValidationError{{Path: "cursor", Message: err.Error()}}, w)
+			return
+		}
+
+		writeStorageError(err, w)
+		return
+	}
+
+	response.WriteJson(http.StatusOK, users, w)
+}
+
+func (h *handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.SearchUsersRequest
+
+	ok := parseRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	users, err := h.ust.SearchUsers(r.Context(), strings.TrimSpace(rb.Query), rb.PageLimit(), rb.Cursor)
+	if err != nil {
+		if err == storage.InvalidCursorErr {
+			response.WriteUnprocessableEntitiesError([]response.ValidationError{{Path: "cursor", Message: err.Error()}}, w)
+			return
+		}
+
+		writeStorageError(err, w)
+		return
+	}
+
+	response.WriteJson(http.StatusOK, users, w)
+}
+
+func (h *handler) UsersStats(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.UsersStatsRequest
+
+	ok := parseOptionalRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	stats, err := h.ust.UsersStats(r.Context(), rb.Buckets(), rb.Period())
+	if err != nil {
+		writeStorageError(err, w)
+		return
+	}
+
+	response.WriteJson(http.StatusOK, stats, w)
+}
+
+func (h *handler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.UsersFilter
+
+	ok := parseOptionalRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	if rb.Deleted && !h.isAdmin(r) {
+		response.WriteForbiddenError("exporting deleted users requires admin token", w)
 		return
 	}
 
-	response.WriteJson(http.StatusOK, storage.UsersResponse{Users: users}, w)
+	enc := newUsersEncoder(r, w)
+	flusher, _ := w.(http.Flusher)
+	started := false
+	exported := 0
+
+	begin := func() error {
+		started = true
+		w.Header().Set(headerContentType, enc.ContentType())
+		w.WriteHeader(http.StatusOK)
+
+		return enc.Begin()
+	}
+
+	flush := func() error {
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return nil
+	}
+
+	err := h.ust.ExportUsers(r.Context(), rb, func(usr storage.User) error {
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+
+		exported++
+
+		if err := enc.Encode(usr); err != nil {
+			return err
+		}
+
+		if exported%exportFlushRows == 0 {
+			return flush()
+		}
+
+		return nil
+	})
+	if err == nil && !started {
+		err = begin()
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if !started {
+			writeStorageError(err, w)
+			return
+		}
+
+		log.Println(fmt.Errorf("user export aborted after %d users - error: %s", exported, err))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (h *handler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil || mediaType != contentTypeCSV {
+		response.WriteUnsupportedMediaTypeError("content type must be text/csv", w)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get(queryDryRun); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			response.WriteBadRequestError("invalid dry_run query parameter", w)
+			return
+		}
+	}
+
+	rq, err := configuration.ParseUsersCSV(r.Body)
+	if err != nil {
+		response.WriteBadRequestError(err.Error(), w)
+		return
+	}
+
+	vErrs := rq.ValidateRows()
+
+	resp := importUsersResponse{DryRun: dryRun, Rows: make([]importUserRow, len(rq.Rows))}
+	users := make([]storage.User, 0, len(rq.Rows))
+	indexes := make([]int, 0, len(rq.Rows))
+
+	for i, row := range rq.Rows {
+		resp.Rows[i] = importUserRow{Line: row.Line, UserId: row.UserId}
+
+		if len(vErrs[i]) > 0 {
+			resp.Rows[i].Action = importActionRejected
+			resp.Rows[i].Errors = vErrs[i]
+			continue
+		}
+
+		if row.UserId == "" {
+			userId, err := uuid.NewV7()
+			if err != nil {
+				response.WriteInternalServerError(err, w)
+				return
+			}
+
+			resp.Rows[i].UserId = userId.String()
+		}
+
+		users = append(users, storage.User{UserId: resp.Rows[i].UserId, Name: row.Name, Age: row.Age})
+		indexes = append(indexes, i)
+	}
+
+	if len(users) > 0 {
+		results, err := h.ust.ImportUsers(r.Context(), users, dryRun)
+		if err != nil {
+			writeStorageError(err, w)
+			return
+		}
+
+		for j, result := range results {
+			i := indexes[j]
+
+			switch {
+			case result.Err != nil:
+				resp.Rows[i].Action = importActionRejected
+				resp.Rows[i].Errors = []response.ValidationError{{Path: configuration.CSVColumnUserId, Message: result.Err.Error()}}
+			case result.Created:
+				resp.Rows[i].Action = importActionCreated
+			default:
+				resp.Rows[i].Action = importActionUpdated
+			}
+		}
+	}
+
+	for _, row := range resp.Rows {
+		switch row.Action {
+		case importActionCreated:
+			resp.Created++
+		case importActionUpdated:
+			resp.Updated++
+		default:
+			resp.Rejected++
+		}
+	}
+
+	response.WriteJson(http.StatusOK, resp, w)
 }
 
 func (h *handler) User(w http.ResponseWriter, r *http.Request) {
@@ -51,22 +362,23 @@ func (h *handler) User(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usr, err := h.ust.User(rb.UserId)
+	usr, err := h.ust.User(r.Context(), rb.UserId)
 	if err != nil {
 		if err == storage.UserNotFoundErr {
 			response.WriteNotFoundError(err.Error(), w)
 			return
 		}
 
-		response.WriteInternalServerError(err, w)
+		writeStorageError(err, w)
 		return
 	}
 
+	w.Header().Set(headerETag, etag(usr.Version))
 	response.WriteJson(http.StatusOK, usr, w)
 }
 
 func (h *handler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var rb configuration.UserRequest
+	var rb configuration.CreateUserRequest
 
 	ok := parseRequestBody(w, r, &rb)
 	if !ok {
@@ -78,22 +390,93 @@ func (h *handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.ust.CreateUser(storage.User{UserId: rb.UserId, Name: rb.Name, Age: rb.Age})
+	if rb.UserId == "" {
+		userId, err := uuid.NewV7()
+		if err != nil {
+			response.WriteInternalServerError(err, w)
+			return
+		}
+
+		rb.UserId = userId.String()
+	}
+
+	usr, err := h.ust.CreateUser(r.Context(), storage.User{UserId: rb.UserId, Name: rb.Name, Age: rb.Age})
 	if err != nil {
 		if err == storage.UserAlreadyExistsErr {
 			response.WriteConflictError(err.Error(), w)
 			return
 		}
 
-		response.WriteInternalServerError(err, w)
+		writeStorageError(err, w)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set(headerETag, etag(usr.Version))
+	response.WriteJson(http.StatusCreated, usr, w)
+}
+
+func (h *handler) CreateUsers(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.CreateUsersRequest
+
+	ok := parseRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	itemErrs := rb.ValidateUsers()
+
+	users := make([]storage.User, 0, len(rb.Users))
+	indexes := make([]int, 0, len(rb.Users))
+	invalid := false
+	for i, usr := range rb.Users {
+		if len(itemErrs[i]) > 0 {
+			invalid = true
+			continue
+		}
+
+		users = append(users, storage.User{UserId: usr.UserId, Name: usr.Name, Age: usr.Age})
+		indexes = append(indexes, i)
+	}
+
+	if invalid && rb.Atomic() {
+		response.WriteUnprocessableEntitiesError(flattenValidationErrors(itemErrs), w)
+		return
+	}
+
+	var created int
+	if len(users) > 0 {
+		errs, err := h.ust.CreateUsers(r.Context(), users, rb.Atomic())
+		if err != nil {
+			writeStorageError(err, w)
+			return
+		}
+
+		for j, err := range errs {
+			if err != nil {
+				i := indexes[j]
+				itemErrs[i] = append(itemErrs[i], response.ValidationError{Path: fmt.Sprintf("users[%d].user_id", i), Message: err.Error()})
+				continue
+			}
+
+			created++
+		}
+
+		if created < len(users) && rb.Atomic() {
+			response.WriteJson(http.StatusConflict, createUsersResponse{Errors: flattenValidationErrors(itemErrs)}, w)
+			return
+		}
+	}
+
+	response.WriteJson(http.StatusOK, createUsersResponse{Created: created, Errors: flattenValidationErrors(itemErrs)}, w)
 }
 
 func (h *handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	var rb configuration.UserRequest
+	var rb configuration.UpdateUserRequest
 
 	ok := parseRequestBody(w, r, &rb)
 	if !ok {
@@ -105,20 +488,72 @@ func (h *handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.ust.UpdateUser(storage.User{UserId: rb.UserId, Name: rb.Name, Age: rb.Age})
+	version, err := parseIfMatch(r)
+	if err != nil {
+		response.WriteBadRequestError(err.Error(), w)
+		return
+	}
+
+	if version == 0 {
+		version = rb.Version
+	} else if rb.Version != 0 && rb.Version != version {
+		response.WritePreconditionFailedError(storage.UserVersionMismatchErr.Error(), w)
+		return
+	}
+
+	usr, err := h.ust.UpdateUser(r.Context(), storage.UserPatch{UserId: rb.UserId, Name: rb.Name, Age: rb.Age, Version: version})
 	if err != nil {
 		if err == storage.UserNotFoundErr {
 			response.WriteNotFoundError(err.Error(), w)
 			return
 		}
 
-		response.WriteInternalServerError(err, w)
+		if err == storage.UserVersionMismatchErr {
+			response.WritePreconditionFailedError(err.Error(), w)
+			return
+		}
+
+		writeStorageError(err, w)
 		return
 	}
 
+	w.Header().Set(headerETag, etag(usr.Version))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *handler) PutUser(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.UserRequest
+
+	ok := parseRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	usr, created, err := h.ust.PutUser(r.Context(), storage.User{UserId: rb.UserId, Name: rb.Name, Age: rb.Age})
+	if err != nil {
+		if err == storage.UserDeletedErr {
+			response.WriteConflictError(err.Error(), w)
+			return
+		}
+
+		writeStorageError(err, w)
+		return
+	}
+
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+
+	w.Header().Set(headerETag, etag(usr.Version))
+	response.WriteJson(code, putUserResponse{Created: created, User: usr}, w)
+}
+
 func (h *handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	var rb configuration.UserIdentifierRequest
 
@@ -132,21 +567,164 @@ func (h *handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.ust.DeleteUser(rb.UserId)
+	err := h.ust.DeleteUser(r.Context(), rb.UserId)
 	if err != nil {
 		if err == storage.UserNotFoundErr {
 			response.WriteNotFoundError(err.Error(), w)
 			return
 		}
 
-		response.WriteInternalServerError(err, w)
+		writeStorageError(err, w)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.UserIdentifierRequest
+
+	ok := parseRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	err := h.ust.RestoreUser(r.Context(), rb.UserId)
+	if err != nil {
+		if err == storage.UserNotFoundErr {
+			response.WriteNotFoundError("deleted user not found", w)
+			return
+		}
+
+		writeStorageError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) UserHistory(w http.ResponseWriter, r *http.Request) {
+	var rb configuration.UserHistoryRequest
+
+	ok := parseRequestBody(w, r, &rb)
+	if !ok {
+		return
+	}
+
+	if vErrs := rb.Validate(); len(vErrs) > 0 {
+		response.WriteUnprocessableEntitiesError(vErrs, w)
+		return
+	}
+
+	if !h.isAdmin(r) {
+		response.WriteForbiddenError("user history requires admin token", w)
+		return
+	}
+
+	history, err := h.ust.UserHistory(r.Context(), rb.UserId, rb.PageLimit(), rb.Cursor)
+	if err != nil {
+		if err == storage.InvalidCursorErr {
+			response.WriteUnprocessableEntitiesError([]response.ValidationError{{Path: "cursor", Message: err.Error()}}, w)
+			return
+		}
+
+		writeStorageError(err, w)
+		return
+	}
+
+	response.WriteJson(http.StatusOK, history, w)
+}
+
+func (h *handler) DBStats(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		response.WriteForbiddenError("database stats require admin token", w)
+		return
+	}
+
+	pools := make(map[string]storage.PoolStats, len(h.pools))
+	for name, db := range h.pools {
+		pools[name] = storage.NewPoolStats(db.Stats())
+	}
+
+	resp := dbStatsResponse{Pools: pools}
+	if cache, ok := h.ust.(storage.CacheStatsProvider); ok {
+		cacheStats := cache.CacheStats()
+		resp.Cache = &cacheStats
+	}
+
+	response.WriteJson(http.StatusOK, resp, w)
+}
+
+func (h *handler) isAdmin(r *http.Request) bool {
+	return validAdminToken(r, h.adminToken)
+}
+
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func parseIfMatch(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get(headerIfMatch))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+
+	if len(v) < 3 || !strings.HasPrefix(v, `"`) || !strings.HasSuffix(v, `"`) {
+		return 0, invalidIfMatchErr
+	}
+
+	version, err := strconv.Atoi(v[1 : len(v)-1])
+	if err != nil || version < 1 {
+		return 0, invalidIfMatchErr
+	}
+
+	return version, nil
+}
+
+func flattenValidationErrors(itemErrs [][]response.ValidationError) []response.ValidationError {
+	var vErrs []response.ValidationError
+	for _, errs := range itemErrs {
+		vErrs = append(vErrs, errs...)
+	}
+
+	return vErrs
+}
+
+func writeStorageError(err error, w http.ResponseWriter) {
+	switch {
+	case err == storage.StatementTimeoutErr:
+		response.WriteGatewayTimeoutError(err.Error(), w)
+	case errors.Is(err, storage.UniqueViolationErr):
+		response.WriteConflictError(storage.UniqueViolationErr.Error(), w)
+	case errors.Is(err, storage.CheckViolationErr):
+		response.WriteBadRequestError(storage.CheckViolationErr.Error(), w)
+	case errors.Is(err, storage.SerializationFailureErr):
+		response.WriteConflictError(storage.SerializationFailureErr.Error(), w)
+	case errors.Is(err, storage.DeadlockErr):
+		response.WriteConflictError(storage.DeadlockErr.Error(), w)
+	case errors.Is(err, storage.ConnectionLostErr):
+		response.WriteServiceUnavailableError(storage.ConnectionLostErr.Error(), w)
+	case err == storage.ReadOnlyErr:
+		response.WriteServiceUnavailableError(err.Error(), w)
+	default:
+		response.WriteInternalServerError(err, w)
+	}
+}
+
 func parseRequestBody(w http.ResponseWriter, r *http.Request, rb interface{}) bool {
+	return readRequestBody(w, r, rb, false)
+}
+
+func parseOptionalRequestBody(w http.ResponseWriter, r *http.Request, rb interface{}) bool {
+	return readRequestBody(w, r, rb, true)
+}
+
+func readRequestBody(w http.ResponseWriter, r *http.Request, rb interface{}, optional bool) bool {
 	rawRb, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		response.WriteInternalServerError(err, w)
@@ -154,6 +732,10 @@ func parseRequestBody(w http.ResponseWriter, r *http.Request, rb interface{}) bo
 	}
 
 	if len(rawRb) == 0 {
+		if optional {
+			return true
+		}
+
 		response.WriteBadRequestError("empty request body", w)
 		return false
 	}
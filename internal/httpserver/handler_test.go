@@ -1,43 +1,57 @@
 package httpserver
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"app/internal/configuration"
 	"app/internal/storage"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var (
 	user1 = storage.User{
-		UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe",
-		Name:   "John Doe",
-		Age:    42,
+		UserId:  "7df661d5-47e3-4533-baa6-5f952d18bffe",
+		Name:    "John Doe",
+		Age:     42,
+		Version: 1,
 	}
 
 	user2 = storage.User{
-		UserId: "63df08d2-fa53-4575-a681-99058f8daba5",
-		Name:   "Josh Brave",
-		Age:    20,
+		UserId:  "63df08d2-fa53-4575-a681-99058f8daba5",
+		Name:    "Josh Brave",
+		Age:     20,
+		Version: 1,
 	}
 )
 
 func Test_newHandler(t *testing.T) {
+	pools := map[string]*sql.DB{"primary": {}}
 	expHandler := &handler{
-		ust: userStorageMock{},
+		ust:        userStorageMock{},
+		adminToken: "secret",
+		pools:      pools,
 	}
 
-	assert.Equal(t, expHandler, newHandler(userStorageMock{}))
+	assert.Equal(t, expHandler, newHandler(userStorageMock{}, "secret", pools))
 }
 
 func TestHandler_Users(t *testing.T) {
 	type args struct {
-		ust storage.UserStorage
+		reqBody    string
+		adminToken string
+		ust        storage.UserStorage
 	}
 	type exp struct {
 		respCode int
@@ -51,23 +65,1684 @@ func TestHandler_Users(t *testing.T) {
 		{
 			name: "ok",
 			args: args{
+				reqBody: ``,
+				ust: userStorageMock{
+					users: func() (storage.UsersResponse, error) {
+						return storage.UsersResponse{Users: []storage.User{user1, user2}}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"users":[{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},{"user_id":"63df08d2-fa53-4575-a681-99058f8daba5","name":"Josh Brave","age":20,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}]}`,
+			},
+		},
+		{
+			name: "ok with next cursor",
+			args: args{
+				reqBody: `{"limit":1}`,
+				ust: userStorageMock{
+					users: func() (storage.UsersResponse, error) {
+						return storage.UsersResponse{Users: []storage.User{user1}, NextCursor: "next"}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"users":[{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}],"next_cursor":"next"}`,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"limit":1001}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"limit","message":"invalid range exceeded - (1-1000)"}]}`,
+			},
+		},
+		{
+			name: "invalid filter in request body",
+			args: args{
+				reqBody: `{"age_min":30,"age_max":20,"sort":[{"field":"email"}]}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"age_max","message":"must be greater than or equal to age_min"},{"path":"sort[0].field","message":"invalid value - (user_id, name, age)"}]}`,
+			},
+		},
+		{
+			name: "ok deleted users",
+			args: args{
+				reqBody:    `{"deleted":true}`,
+				adminToken: "secret",
+				ust: userStorageMock{
+					users: func() (storage.UsersResponse, error) {
+						return storage.UsersResponse{Users: []storage.User{user1}}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"users":[{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}]}`,
+			},
+		},
+		{
+			name: "deleted users without admin token",
+			args: args{
+				reqBody:    `{"deleted":true}`,
+				adminToken: "guess",
+				ust:        userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusForbidden,
+				respBody: `{"error":"listing deleted users requires admin token"}`,
+			},
+		},
+		{
+			name: "invalid cursor error",
+			args: args{
+				reqBody: `{"cursor":"xxx"}`,
+				ust: userStorageMock{
+					users: func() (storage.UsersResponse, error) {
+						return storage.UsersResponse{}, storage.InvalidCursorErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"cursor","message":"invalid cursor"}]}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: ``,
+				ust: userStorageMock{
+					users: func() (storage.UsersResponse, error) {
+						return storage.UsersResponse{}, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+			req.Header.Set(headerAdminToken, tc.args.adminToken)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "secret", nil)
+
+			h.Users(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+		})
+	}
+}
+
+func TestHandler_SearchUsers(t *testing.T) {
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"query":" jon doe ","limit":1}`,
+				ust: userStorageMock{
+					searchUsers: func(query string) (storage.SearchUsersResponse, error) {
+						if query != "jon doe" {
+							return storage.SearchUsersResponse{}, errors.New("unexpected query")
+						}
+
+						return storage.SearchUsersResponse{
+							Users: []storage.ScoredUser{
+								{
+									User:  storage.User{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42, Version: 1},
+									Score: 0.5,
+								},
+							},
+							NextCursor: "next",
+						}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"users":[{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","score":0.5}],"next_cursor":"next"}`,
+			},
+		},
+		{
+			name: "empty request body",
+			args: args{
+				reqBody: ``,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"empty request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"query":"","limit":1001}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"query","message":"invalid length exceeded - (1-100)"},{"path":"limit","message":"invalid range exceeded - (1-1000)"}]}`,
+			},
+		},
+		{
+			name: "invalid cursor",
+			args: args{
+				reqBody: `{"query":"jon","cursor":"invalid"}`,
+				ust: userStorageMock{
+					searchUsers: func(_ string) (storage.SearchUsersResponse, error) {
+						return storage.SearchUsersResponse{}, storage.InvalidCursorErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"cursor","message":"invalid cursor"}]}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"query":"jon"}`,
+				ust: userStorageMock{
+					searchUsers: func(_ string) (storage.SearchUsersResponse, error) {
+						return storage.SearchUsersResponse{}, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "secret", nil)
+
+			h.SearchUsers(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+		})
+	}
+}
+
+func TestHandler_UsersStats(t *testing.T) {
+	age, mean, bound := 42, 42.0, 40
+	stats := storage.UsersStats{
+		Total: 1,
+		Age: storage.AgeStats{
+			Min:  &age,
+			Max:  &age,
+			Mean: &mean,
+			Histogram: []storage.AgeBucket{
+				{From: 0, To: &bound, Count: 0},
+				{From: 40, Count: 1},
+			},
+		},
+		Created: []storage.PeriodCount{{Period: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Count: 1}},
+	}
+
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"age_buckets":[40],"created_period":"year"}`,
+				ust: userStorageMock{
+					usersStats: func(ageBuckets []int, period string) (storage.UsersStats, error) {
+						if !reflect.DeepEqual(ageBuckets, []int{40}) || period != configuration.StatsPeriodYear {
+							return storage.UsersStats{}, errors.New("unexpected arguments")
+						}
+
+						return stats, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"total":1,"age":{"min":42,"max":42,"mean":42,"histogram":[{"from":0,"to":40,"count":0},{"from":40,"count":1}]},"created":[{"period":"2022-01-01T00:00:00Z","count":1}]}`,
+			},
+		},
+		{
+			name: "ok defaults",
+			args: args{
+				reqBody: ``,
+				ust: userStorageMock{
+					usersStats: func(ageBuckets []int, period string) (storage.UsersStats, error) {
+						if !reflect.DeepEqual(ageBuckets, configuration.DefaultAgeBuckets) || period != configuration.StatsPeriodMonth {
+							return storage.UsersStats{}, errors.New("unexpected arguments")
+						}
+
+						return storage.UsersStats{Age: storage.AgeStats{Histogram: []storage.AgeBucket{{From: 0}}}, Created: []storage.PeriodCount{}}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"total":0,"age":{"min":null,"max":null,"mean":null,"histogram":[{"from":0,"count":0}]},"created":[]}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"age_buckets":[30,18,0],"created_period":"hour"}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"age_buckets[1]","message":"must be greater than the previous bucket"},{"path":"age_buckets[2]","message":"invalid range exceeded - (1-1000)"},{"path":"created_period","message":"invalid value - (day, week, month, year)"}]}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: ``,
+				ust: userStorageMock{
+					usersStats: func(_ []int, _ string) (storage.UsersStats, error) {
+						return storage.UsersStats{}, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "secret", nil)
+
+			h.UsersStats(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+		})
+	}
+}
+
+func TestHandler_ExportUsers(t *testing.T) {
+	type args struct {
+		reqBody    string
+		adminToken string
+		ust        storage.UserStorage
+	}
+	type exp struct {
+		respCode    int
+		respBody    string
+		contentType string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: ``,
+				ust: userStorageMock{
+					exportUsers: func(fn func(usr storage.User) error) error {
+						for _, usr := range []storage.User{user1, user2} {
+							if err := fn(usr); err != nil {
+								return err
+							}
+						}
+
+						return nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n" +
+					`{"user_id":"63df08d2-fa53-4575-a681-99058f8daba5","name":"Josh Brave","age":20,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n",
+				contentType: contentTypeNDJSON,
+			},
+		},
+		{
+			name: "ok no users",
+			args: args{
+				reqBody: `{"name_prefix":"Jo"}`,
+				ust: userStorageMock{
+					exportUsers: func(fn func(usr storage.User) error) error {
+						return nil
+					},
+				},
+			},
+			exp: exp{
+				respCode:    http.StatusOK,
+				respBody:    ``,
+				contentType: contentTypeNDJSON,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode:    http.StatusBadRequest,
+				respBody:    `{"error":"invalid request body"}`,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"age_min":-1}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode:    http.StatusUnprocessableEntity,
+				respBody:    `{"errors":[{"path":"age_min","message":"invalid min value exceeded - (0)"}]}`,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "deleted without admin token error",
+			args: args{
+				reqBody: `{"deleted":true}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode:    http.StatusForbidden,
+				respBody:    `{"error":"exporting deleted users requires admin token"}`,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "statement timeout error",
+			args: args{
+				reqBody: ``,
+				ust: userStorageMock{
+					exportUsers: func(fn func(usr storage.User) error) error {
+						return storage.StatementTimeoutErr
+					},
+				},
+			},
+			exp: exp{
+				respCode:    http.StatusGatewayTimeout,
+				respBody:    `{"error":"statement timeout"}`,
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+			req.Header.Set(headerAdminToken, tc.args.adminToken)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "secret", nil)
+
+			h.ExportUsers(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+			assert.Equal(t, tc.exp.contentType, rec.Header().Get(headerContentType), "unexpected content type")
+		})
+	}
+
+	t.Run("ok csv", func(t *testing.T) {
+		req, err := http.NewRequest("", "", strings.NewReader(``))
+		require.NoError(t, err)
+		req.Header.Set(headerAccept, "text/csv, application/json;q=0.5")
+
+		rec := httptest.NewRecorder()
+
+		deletedAt := time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)
+		deleted := user2
+		deleted.Name = "Brave, Josh"
+		deleted.DeletedAt = &deletedAt
+		formula := user1
+		formula.Name = `=HYPERLINK("http://evil")`
+
+		h := newHandler(userStorageMock{
+			exportUsers: func(fn func(usr storage.User) error) error {
+				for _, usr := range []storage.User{user1, deleted, formula} {
+					if err := fn(usr); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			},
+		}, "secret", nil)
+
+		h.ExportUsers(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, contentTypeCSV, rec.Header().Get(headerContentType))
+		assert.Equal(t, "user_id,name,age,version,deleted_at,created_at,updated_at\n"+
+			"7df661d5-47e3-4533-baa6-5f952d18bffe,John Doe,42,1,,0001-01-01T00:00:00Z,0001-01-01T00:00:00Z\n"+
+			"63df08d2-fa53-4575-a681-99058f8daba5,\"Brave, Josh\",20,1,2022-01-02T00:00:00Z,0001-01-01T00:00:00Z,0001-01-01T00:00:00Z\n"+
+			"7df661d5-47e3-4533-baa6-5f952d18bffe,\"'=HYPERLINK(\"\"http://evil\"\")\",42,1,,0001-01-01T00:00:00Z,0001-01-01T00:00:00Z\n",
+			rec.Body.String())
+	})
+
+	t.Run("ok csv no users", func(t *testing.T) {
+		req, err := http.NewRequest("", "", strings.NewReader(``))
+		require.NoError(t, err)
+		req.Header.Set(headerAccept, contentTypeCSV)
+
+		rec := httptest.NewRecorder()
+
+		h := newHandler(userStorageMock{
+			exportUsers: func(fn func(usr storage.User) error) error {
+				return nil
+			},
+		}, "secret", nil)
+
+		h.ExportUsers(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user_id,name,age,version,deleted_at,created_at,updated_at\n", rec.Body.String())
+	})
+
+	t.Run("aborts on error after first user", func(t *testing.T) {
+		req, err := http.NewRequest("", "", strings.NewReader(``))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+
+		h := newHandler(userStorageMock{
+			exportUsers: func(fn func(usr storage.User) error) error {
+				if err := fn(user1); err != nil {
+					return err
+				}
+
+				return storage.ConnectionLostErr
+			},
+		}, "secret", nil)
+
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			h.ExportUsers(rec, req)
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestHandler_ImportUsers(t *testing.T) {
+	type args struct {
+		reqBody     string
+		contentType string
+		query       string
+		ust         storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: "user_id,name,age\n" +
+					"7df661d5-47e3-4533-baa6-5f952d18bffe,John Doe,42\n" +
+					"63df08d2-fa53-4575-a681-99058f8daba5,Josh Brave,20\n" +
+					"7a1bd83c-0a3a-4bd5-a8ec-ed5f4e0b1c8e,Jo,0\n" +
+					"1f0e6a9d-3b54-4d2a-9b0b-d2b3a0b0a3c1,Jane Gone,30\n",
+				contentType: "text/csv; charset=utf-8",
+				ust: userStorageMock{
+					importUsers: func(users []storage.User, dryRun bool) ([]storage.ImportResult, error) {
+						if dryRun || len(users) != 3 {
+							return nil, errors.New("unexpected import")
+						}
+
+						return []storage.ImportResult{{Created: true}, {Created: false}, {Err: storage.UserDeletedErr}}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"dry_run":false,"created":1,"updated":1,"rejected":2,"rows":[` +
+					`{"line":2,"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","action":"created"},` +
+					`{"line":3,"user_id":"63df08d2-fa53-4575-a681-99058f8daba5","action":"updated"},` +
+					`{"line":4,"user_id":"7a1bd83c-0a3a-4bd5-a8ec-ed5f4e0b1c8e","action":"rejected","errors":[{"path":"name","message":"invalid length exceeded - (4-100)"},{"path":"age","message":"invalid min value exceeded - (1)"}]},` +
+					`{"line":5,"user_id":"1f0e6a9d-3b54-4d2a-9b0b-d2b3a0b0a3c1","action":"rejected","errors":[{"path":"user_id","message":"user is deleted"}]}]}`,
+			},
+		},
+		{
+			name: "ok dry run",
+			args: args{
+				reqBody:     "user_id,name,age\n7df661d5-47e3-4533-baa6-5f952d18bffe,John Doe,42\n",
+				contentType: contentTypeCSV,
+				query:       "?dry_run=true",
+				ust: userStorageMock{
+					importUsers: func(users []storage.User, dryRun bool) ([]storage.ImportResult, error) {
+						if !dryRun {
+							return nil, errors.New("unexpected import")
+						}
+
+						return []storage.ImportResult{{Created: true}}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"dry_run":true,"created":1,"updated":0,"rejected":0,"rows":[{"line":2,"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","action":"created"}]}`,
+			},
+		},
+		{
+			name: "ok all rejected",
+			args: args{
+				reqBody:     "name,age\nJo,1\n",
+				contentType: contentTypeCSV,
+				ust:         userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"dry_run":false,"created":0,"updated":0,"rejected":1,"rows":[{"line":2,"action":"rejected","errors":[{"path":"name","message":"invalid length exceeded - (4-100)"}]}]}`,
+			},
+		},
+		{
+			name: "unsupported content type error",
+			args: args{
+				reqBody:     `{}`,
+				contentType: "application/json",
+				ust:         userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnsupportedMediaType,
+				respBody: `{"error":"content type must be text/csv"}`,
+			},
+		},
+		{
+			name: "invalid dry run error",
+			args: args{
+				reqBody:     "name,age\n",
+				contentType: contentTypeCSV,
+				query:       "?dry_run=maybe",
+				ust:         userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid dry_run query parameter"}`,
+			},
+		},
+		{
+			name: "invalid csv error",
+			args: args{
+				reqBody:     "user_id,name\n",
+				contentType: contentTypeCSV,
+				ust:         userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid csv - missing column age"}`,
+			},
+		},
+		{
+			name: "read-only error",
+			args: args{
+				reqBody:     "name,age\nJohn Doe,42\n",
+				contentType: contentTypeCSV,
+				ust: userStorageMock{
+					importUsers: func(users []storage.User, dryRun bool) ([]storage.ImportResult, error) {
+						return nil, storage.ReadOnlyErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusServiceUnavailable,
+				respBody: `{"error":"storage is read-only"}`,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "/import-users"+tc.args.query, strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+			req.Header.Set(headerContentType, tc.args.contentType)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "secret", nil)
+
+			h.ImportUsers(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+		})
+	}
+
+	t.Run("ok generated user_id", func(t *testing.T) {
+		req, err := http.NewRequest("", "/import-users", strings.NewReader("name,age\nJohn Doe,42\n"))
+		require.NoError(t, err)
+		req.Header.Set(headerContentType, contentTypeCSV)
+
+		rec := httptest.NewRecorder()
+
+		var imported []storage.User
+		h := newHandler(userStorageMock{
+			importUsers: func(users []storage.User, dryRun bool) ([]storage.ImportResult, error) {
+				imported = users
+				return []storage.ImportResult{{Created: true}}, nil
+			},
+		}, "secret", nil)
+
+		h.ImportUsers(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, imported, 1)
+
+		userId, err := uuid.Parse(imported[0].UserId)
+		require.NoError(t, err)
+		assert.Equal(t, uuid.Version(7), userId.Version())
+		assert.Contains(t, rec.Body.String(), imported[0].UserId)
+	})
+}
+
+func TestHandler_User(t *testing.T) {
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+		etag     string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					user: func() (storage.User, error) {
+						return user1, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+				etag:     `"1"`,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"user_id":"u-1"}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+			},
+		},
+		{
+			name: "user not found error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					user: func() (storage.User, error) {
+						return storage.User{}, storage.UserNotFoundErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNotFound,
+				respBody: `{"error":"user not found"}`,
+			},
+		},
+		{
+			name: "statement timeout error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					user: func() (storage.User, error) {
+						return storage.User{}, storage.StatementTimeoutErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusGatewayTimeout,
+				respBody: `{"error":"statement timeout"}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					user: func() (storage.User, error) {
+						return storage.User{}, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "", nil)
+
+			h.User(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+			assert.Equal(t, tc.exp.etag, rec.Header().Get(headerETag), "unexpected etag")
+		})
+	}
+}
+
+func TestHandler_CreateUser(t *testing.T) {
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+		etag     string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					createUser: func(usr storage.User) (storage.User, error) {
+						assert.Equal(t, storage.User{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42}, usr)
+						return user1, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusCreated,
+				respBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+				etag:     `"1"`,
+			},
+		},
+		{
+			name: "ok generated user id",
+			args: args{
+				reqBody: `{"name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					createUser: func(usr storage.User) (storage.User, error) {
+						userId, err := uuid.Parse(usr.UserId)
+						require.NoError(t, err)
+						assert.Equal(t, uuid.Version(7), userId.Version())
+
+						return storage.User{UserId: "01890a5d-ac96-774b-bcce-b302099a8057", Name: usr.Name, Age: usr.Age, Version: 1}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusCreated,
+				respBody: `{"user_id":"01890a5d-ac96-774b-bcce-b302099a8057","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+				etag:     `"1"`,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"user_id":"u-1","name":"John Doe","age":42}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+			},
+		},
+		{
+			name: "user already exists error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					createUser: func(_ storage.User) (storage.User, error) {
+						return storage.User{}, storage.UserAlreadyExistsErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusConflict,
+				respBody: `{"error":"user already exists"}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					createUser: func(_ storage.User) (storage.User, error) {
+						return storage.User{}, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "", nil)
+
+			h.CreateUser(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+			assert.Equal(t, tc.exp.etag, rec.Header().Get(headerETag), "unexpected etag")
+		})
+	}
+}
+
+func TestHandler_CreateUsers(t *testing.T) {
+	const (
+		validUser1  = `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`
+		validUser2  = `{"user_id":"63df08d2-fa53-4575-a681-99058f8daba5","name":"Josh Brave","age":20}`
+		invalidUser = `{"user_id":"0f2e5c1a-3b9d-4c7e-8a61-2d5f9b0e4c33","name":"Jo","age":20}`
+	)
+
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"users":[` + validUser1 + `,` + validUser2 + `]}`,
+				ust: userStorageMock{
+					createUsers: func(users []storage.User, atomic bool) ([]error, error) {
+						if len(users) != 2 || !atomic {
+							return nil, errors.New("unexpected arguments")
+						}
+
+						return []error{nil, nil}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"created":2}`,
+			},
+		},
+		{
+			name: "ok best effort",
+			args: args{
+				reqBody: `{"mode":"best_effort","users":[` + validUser1 + `,` + invalidUser + `,` + validUser2 + `]}`,
+				ust: userStorageMock{
+					createUsers: func(users []storage.User, atomic bool) ([]error, error) {
+						if len(users) != 2 || atomic {
+							return nil, errors.New("unexpected arguments")
+						}
+
+						return []error{nil, storage.UserAlreadyExistsErr}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"created":1,"errors":[{"path":"users[1].name","message":"invalid length exceeded - (4-100)"},{"path":"users[2].user_id","message":"user already exists"}]}`,
+			},
+		},
+		{
+			name: "ok best effort all invalid",
+			args: args{
+				reqBody: `{"mode":"best_effort","users":[` + invalidUser + `]}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"created":0,"errors":[{"path":"users[0].name","message":"invalid length exceeded - (4-100)"}]}`,
+			},
+		},
+		{
+			name: "empty request body",
+			args: args{
+				reqBody: ``,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"empty request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"users":[],"mode":"sometimes"}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"users","message":"invalid length exceeded - (1-1000)"},{"path":"mode","message":"invalid value - (all_or_nothing, best_effort)"}]}`,
+			},
+		},
+		{
+			name: "invalid users in request body",
+			args: args{
+				reqBody: `{"users":[` + validUser1 + `,` + invalidUser + `,` + validUser1 + `]}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"users[1].name","message":"invalid length exceeded - (4-100)"},{"path":"users[2].user_id","message":"duplicate user_id"}]}`,
+			},
+		},
+		{
+			name: "user already exists error",
+			args: args{
+				reqBody: `{"users":[` + validUser1 + `,` + validUser2 + `]}`,
+				ust: userStorageMock{
+					createUsers: func(users []storage.User, atomic bool) ([]error, error) {
+						return []error{nil, storage.UserAlreadyExistsErr}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusConflict,
+				respBody: `{"created":0,"errors":[{"path":"users[1].user_id","message":"user already exists"}]}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"users":[` + validUser1 + `]}`,
+				ust: userStorageMock{
+					createUsers: func(users []storage.User, atomic bool) ([]error, error) {
+						return nil, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "", nil)
+
+			h.CreateUsers(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+		})
+	}
+}
+
+func TestHandler_UpdateUser(t *testing.T) {
+	updatedUser := func(version int) func(patch storage.UserPatch) (storage.User, error) {
+		return func(patch storage.UserPatch) (storage.User, error) {
+			if patch.Version != version {
+				return storage.User{}, fmt.Errorf("unexpected version %d", patch.Version)
+			}
+
+			return storage.User{UserId: patch.UserId, Version: version + 1}, nil
+		}
+	}
+
+	type args struct {
+		reqBody string
+		ifMatch string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+		etag     string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					updateUser: updatedUser(0),
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNoContent,
+				respBody: ``,
+				etag:     `"1"`,
+			},
+		},
+		{
+			name: "ok version in request body",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":3}`,
+				ust: userStorageMock{
+					updateUser: updatedUser(3),
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNoContent,
+				respBody: ``,
+				etag:     `"4"`,
+			},
+		},
+		{
+			name: "ok if match header",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ifMatch: `"5"`,
+				ust: userStorageMock{
+					updateUser: updatedUser(5),
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNoContent,
+				respBody: ``,
+				etag:     `"6"`,
+			},
+		},
+		{
+			name: "ok partial",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","age":43}`,
+				ust: userStorageMock{
+					updateUser: func(patch storage.UserPatch) (storage.User, error) {
+						if patch.Name != nil || patch.Age == nil || *patch.Age != 43 {
+							return storage.User{}, errors.New("unexpected patch")
+						}
+
+						return storage.User{UserId: patch.UserId, Name: "John Doe", Age: 43, Version: 2}, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNoContent,
+				respBody: ``,
+				etag:     `"2"`,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "no fields to update",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"name","message":"at least one of name, age is required"}]}`,
+			},
+		},
+		{
+			name: "invalid if match header",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ifMatch: `W/"5"`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid If-Match header"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"user_id":"u-1","name":"John Doe","age":42}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+			},
+		},
+		{
+			name: "if match header and request body version differ",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":4}`,
+				ifMatch: `"5"`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusPreconditionFailed,
+				respBody: `{"error":"user version mismatch"}`,
+			},
+		},
+		{
+			name: "user not found error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					updateUser: func(_ storage.UserPatch) (storage.User, error) {
+						return storage.User{}, storage.UserNotFoundErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNotFound,
+				respBody: `{"error":"user not found"}`,
+			},
+		},
+		{
+			name: "user version mismatch error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ifMatch: `"2"`,
+				ust: userStorageMock{
+					updateUser: func(_ storage.UserPatch) (storage.User, error) {
+						return storage.User{}, storage.UserVersionMismatchErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusPreconditionFailed,
+				respBody: `{"error":"user version mismatch"}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					updateUser: func(_ storage.UserPatch) (storage.User, error) {
+						return storage.User{}, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+			req.Header.Set(headerIfMatch, tc.args.ifMatch)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "", nil)
+
+			h.UpdateUser(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+			assert.Equal(t, tc.exp.etag, rec.Header().Get(headerETag), "unexpected etag")
+		})
+	}
+}
+
+func Test_parseIfMatch(t *testing.T) {
+	tcs := []struct {
+		ifMatch string
+		version int
+		err     error
+	}{
+		{ifMatch: ``, version: 0, err: nil},
+		{ifMatch: `*`, version: 0, err: nil},
+		{ifMatch: `"12"`, version: 12, err: nil},
+		{ifMatch: `12`, version: 0, err: invalidIfMatchErr},
+		{ifMatch: `""`, version: 0, err: invalidIfMatchErr},
+		{ifMatch: `"0"`, version: 0, err: invalidIfMatchErr},
+		{ifMatch: `"x"`, version: 0, err: invalidIfMatchErr},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.ifMatch, func(t *testing.T) {
+			req, err := http.NewRequest("", "", nil)
+			require.NoError(t, err)
+			req.Header.Set(headerIfMatch, tc.ifMatch)
+
+			version, err := parseIfMatch(req)
+
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func TestHandler_PutUser(t *testing.T) {
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+		etag     string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok created",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					putUser: func() (storage.User, bool, error) {
+						return storage.User{
+							UserId:    "7df661d5-47e3-4533-baa6-5f952d18bffe",
+							Name:      "John Doe",
+							Age:       42,
+							Version:   1,
+							CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+							UpdatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+						}, true, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusCreated,
+				respBody: `{"created":true,"user":{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"2022-01-01T00:00:00Z","updated_at":"2022-01-01T00:00:00Z"}}`,
+				etag:     `"1"`,
+			},
+		},
+		{
+			name: "ok updated",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					putUser: func() (storage.User, bool, error) {
+						return storage.User{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42, Version: 3}, false, nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusOK,
+				respBody: `{"created":false,"user":{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":3,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}}`,
+				etag:     `"3"`,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"user_id":"u-1","name":"John Doe","age":42}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+			},
+		},
+		{
+			name: "user deleted error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					putUser: func() (storage.User, bool, error) {
+						return storage.User{}, false, storage.UserDeletedErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusConflict,
+				respBody: `{"error":"user is deleted"}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				ust: userStorageMock{
+					putUser: func() (storage.User, bool, error) {
+						return storage.User{}, false, errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "", nil)
+
+			h.PutUser(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+			assert.Equal(t, tc.exp.etag, rec.Header().Get(headerETag), "unexpected etag")
+		})
+	}
+}
+
+func TestHandler_DeleteUser(t *testing.T) {
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					deleteUser: func() error {
+						return nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNoContent,
+				respBody: ``,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"user_id":"u-1"}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+			},
+		},
+		{
+			name: "user not found error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					deleteUser: func() error {
+						return storage.UserNotFoundErr
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNotFound,
+				respBody: `{"error":"user not found"}`,
+			},
+		},
+		{
+			name: "database error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					deleteUser: func() error {
+						return errors.New("database error")
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusInternalServerError,
+				respBody: ``,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+
+			h := newHandler(tc.args.ust, "", nil)
+
+			h.DeleteUser(rec, req)
+
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+		})
+	}
+}
+
+func TestHandler_RestoreUser(t *testing.T) {
+	type args struct {
+		reqBody string
+		ust     storage.UserStorage
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				ust: userStorageMock{
+					restoreUser: func() error {
+						return nil
+					},
+				},
+			},
+			exp: exp{
+				respCode: http.StatusNoContent,
+				respBody: ``,
+			},
+		},
+		{
+			name: "invalid request body",
+			args: args{
+				reqBody: `{`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusBadRequest,
+				respBody: `{"error":"invalid request body"}`,
+			},
+		},
+		{
+			name: "invalid values in request body",
+			args: args{
+				reqBody: `{"user_id":"u-1"}`,
+				ust:     userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+			},
+		},
+		{
+			name: "user not found error",
+			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
 				ust: userStorageMock{
-					users: func() ([]storage.User, error) {
-						return []storage.User{user1, user2}, nil
+					restoreUser: func() error {
+						return storage.UserNotFoundErr
 					},
 				},
 			},
 			exp: exp{
-				respCode: http.StatusOK,
-				respBody: `{"users":[{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42},{"user_id":"63df08d2-fa53-4575-a681-99058f8daba5","name":"Josh Brave","age":20}]}`,
+				respCode: http.StatusNotFound,
+				respBody: `{"error":"deleted user not found"}`,
 			},
 		},
 		{
 			name: "database error",
 			args: args{
+				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
 				ust: userStorageMock{
-					users: func() ([]storage.User, error) {
-						return nil, errors.New("database error")
+					restoreUser: func() error {
+						return errors.New("database error")
 					},
 				},
 			},
@@ -80,14 +1755,14 @@ func TestHandler_Users(t *testing.T) {
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := http.NewRequest("", "", nil)
+			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
 			require.NoError(t, err)
 
 			rec := httptest.NewRecorder()
 
-			h := newHandler(tc.args.ust)
+			h := newHandler(tc.args.ust, "", nil)
 
-			h.Users(rec, req)
+			h.RestoreUser(rec, req)
 
 			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
 			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
@@ -95,10 +1770,13 @@ func TestHandler_Users(t *testing.T) {
 	}
 }
 
-func TestHandler_User(t *testing.T) {
+func TestHandler_UserHistory(t *testing.T) {
+	changedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
 	type args struct {
-		reqBody string
-		ust     storage.UserStorage
+		reqBody    string
+		adminToken string
+		ust        storage.UserStorage
 	}
 	type exp struct {
 		respCode int
@@ -112,62 +1790,91 @@ func TestHandler_User(t *testing.T) {
 		{
 			name: "ok",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				reqBody:    `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","limit":1}`,
+				adminToken: "secret",
 				ust: userStorageMock{
-					user: func() (storage.User, error) {
-						return user1, nil
+					userHistory: func() (storage.UserHistoryResponse, error) {
+						return storage.UserHistoryResponse{
+							History: []storage.UserChange{
+								{
+									HistoryId: 1,
+									UserId:    "7df661d5-47e3-4533-baa6-5f952d18bffe",
+									Operation: storage.OperationCreate,
+									After:     &storage.User{UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe", Name: "John Doe", Age: 42, Version: 1},
+									Principal: "support",
+									ChangedAt: changedAt,
+								},
+							},
+							NextCursor: "next",
+						}, nil
 					},
 				},
 			},
 			exp: exp{
 				respCode: http.StatusOK,
-				respBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
+				respBody: `{"history":[{"history_id":1,"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","operation":"create","before":null,"after":{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},"principal":"support","changed_at":"2022-01-01T00:00:00Z"}],"next_cursor":"next"}`,
 			},
 		},
 		{
-			name: "invalid request body",
+			name: "empty request body",
 			args: args{
-				reqBody: `{`,
-				ust:     userStorageMock{},
+				reqBody:    ``,
+				adminToken: "secret",
+				ust:        userStorageMock{},
 			},
 			exp: exp{
 				respCode: http.StatusBadRequest,
-				respBody: `{"error":"invalid request body"}`,
+				respBody: `{"error":"empty request body"}`,
 			},
 		},
 		{
 			name: "invalid values in request body",
 			args: args{
-				reqBody: `{"user_id":"u-1"}`,
-				ust:     userStorageMock{},
+				reqBody:    `{"user_id":"u-1","limit":-1}`,
+				adminToken: "secret",
+				ust:        userStorageMock{},
 			},
 			exp: exp{
 				respCode: http.StatusUnprocessableEntity,
-				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"},{"path":"limit","message":"invalid range exceeded - (1-1000)"}]}`,
 			},
 		},
 		{
-			name: "user not found error",
+			name: "missing admin token",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				reqBody:    `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				adminToken: "",
+				ust:        userStorageMock{},
+			},
+			exp: exp{
+				respCode: http.StatusForbidden,
+				respBody: `{"error":"user history requires admin token"}`,
+			},
+		},
+		{
+			name: "invalid cursor",
+			args: args{
+				reqBody:    `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","cursor":"invalid"}`,
+				adminToken: "secret",
 				ust: userStorageMock{
-					user: func() (storage.User, error) {
-						return storage.User{}, storage.UserNotFoundErr
+					userHistory: func() (storage.UserHistoryResponse, error) {
+						return storage.UserHistoryResponse{}, storage.InvalidCursorErr
 					},
 				},
 			},
 			exp: exp{
-				respCode: http.StatusNotFound,
-				respBody: `{"error":"user not found"}`,
+				respCode: http.StatusUnprocessableEntity,
+				respBody: `{"errors":[{"path":"cursor","message":"invalid cursor"}]}`,
 			},
 		},
 		{
 			name: "database error",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				reqBody:    `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
+				adminToken: "secret",
 				ust: userStorageMock{
-					user: func() (storage.User, error) {
-						return storage.User{}, errors.New("database error")
+					userHistory: func() (storage.UserHistoryResponse, error) {
+						return storage.UserHistoryResponse{}, errors.New("database error")
 					},
 				},
 			},
@@ -182,12 +1889,13 @@ func TestHandler_User(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
 			require.NoError(t, err)
+			req.Header.Set(headerAdminToken, tc.args.adminToken)
 
 			rec := httptest.NewRecorder()
 
-			h := newHandler(tc.args.ust)
+			h := newHandler(tc.args.ust, "secret", nil)
 
-			h.User(rec, req)
+			h.UserHistory(rec, req)
 
 			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
 			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
@@ -195,10 +1903,16 @@ func TestHandler_User(t *testing.T) {
 	}
 }
 
-func TestHandler_CreateUser(t *testing.T) {
+func TestHandler_DBStats(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(10)
+
 	type args struct {
-		reqBody string
-		ust     storage.UserStorage
+		adminToken string
+		ust        storage.UserStorage
+		pools      map[string]*sql.DB
 	}
 	type exp struct {
 		respCode int
@@ -212,82 +1926,64 @@ func TestHandler_CreateUser(t *testing.T) {
 		{
 			name: "ok",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
-				ust: userStorageMock{
-					createUser: func() error {
-						return nil
-					},
-				},
-			},
-			exp: exp{
-				respCode: http.StatusNoContent,
-				respBody: ``,
-			},
-		},
-		{
-			name: "invalid request body",
-			args: args{
-				reqBody: `{`,
-				ust:     userStorageMock{},
+				adminToken: "secret",
+				pools:      map[string]*sql.DB{"primary": db},
 			},
 			exp: exp{
-				respCode: http.StatusBadRequest,
-				respBody: `{"error":"invalid request body"}`,
+				respCode: http.StatusOK,
+				respBody: `{"pools":{"primary":{"max_open_connections":10,"open_connections":1,"in_use":0,"idle":1,"wait_count":0,"wait_duration_ms":0,"max_idle_closed":0,"max_idle_time_closed":0,"max_lifetime_closed":0}}}`,
 			},
 		},
 		{
-			name: "invalid values in request body",
+			name: "ok with cache",
 			args: args{
-				reqBody: `{"user_id":"u-1","name":"John Doe","age":42}`,
-				ust:     userStorageMock{},
+				adminToken: "secret",
+				ust:        cachedStorageMock{stats: storage.CacheStats{Hits: 7, Misses: 3, Entries: 2}},
 			},
 			exp: exp{
-				respCode: http.StatusUnprocessableEntity,
-				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+				respCode: http.StatusOK,
+				respBody: `{"pools":{},"cache":{"hits":7,"misses":3,"entries":2}}`,
 			},
 		},
 		{
-			name: "user already exists error",
+			name: "ok without pools",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
-				ust: userStorageMock{
-					createUser: func() error {
-						return storage.UserAlreadyExistsErr
-					},
-				},
+				adminToken: "secret",
 			},
 			exp: exp{
-				respCode: http.StatusConflict,
-				respBody: `{"error":"user already exists"}`,
+				respCode: http.StatusOK,
+				respBody: `{"pools":{}}`,
 			},
 		},
 		{
-			name: "database error",
+			name: "missing admin token",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
-				ust: userStorageMock{
-					createUser: func() error {
-						return errors.New("database error")
-					},
-				},
+				adminToken: "",
+				pools:      map[string]*sql.DB{"primary": db},
 			},
 			exp: exp{
-				respCode: http.StatusInternalServerError,
-				respBody: ``,
+				respCode: http.StatusForbidden,
+				respBody: `{"error":"database stats require admin token"}`,
 			},
 		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			req, err := http.NewRequest("", "", nil)
 			require.NoError(t, err)
+			req.Header.Set(headerAdminToken, tc.args.adminToken)
 
 			rec := httptest.NewRecorder()
 
-			h := newHandler(tc.args.ust)
+			ust := tc.args.ust
+			if ust == nil {
+				ust = userStorageMock{}
+			}
 
-			h.CreateUser(rec, req)
+			h := newHandler(ust, "secret", tc.args.pools)
+
+			h.DBStats(rec, req)
 
 			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
 			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
@@ -295,14 +1991,16 @@ func TestHandler_CreateUser(t *testing.T) {
 	}
 }
 
-func TestHandler_UpdateUser(t *testing.T) {
+func Test_principalMiddleware(t *testing.T) {
+	const adminToken = "secret"
+
 	type args struct {
-		reqBody string
-		ust     storage.UserStorage
+		adminToken string
+		principal  string
 	}
 	type exp struct {
-		respCode int
-		respBody string
+		respCode  int
+		principal string
 	}
 	tcs := []struct {
 		name string
@@ -312,97 +2010,89 @@ func TestHandler_UpdateUser(t *testing.T) {
 		{
 			name: "ok",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
-				ust: userStorageMock{
-					updateUser: func() error {
-						return nil
-					},
-				},
+				adminToken: adminToken,
+				principal:  " support ",
 			},
 			exp: exp{
-				respCode: http.StatusNoContent,
-				respBody: ``,
+				respCode:  http.StatusOK,
+				principal: "support",
 			},
 		},
 		{
-			name: "invalid request body",
+			name: "ok anonymous",
 			args: args{
-				reqBody: `{`,
-				ust:     userStorageMock{},
+				adminToken: adminToken,
+				principal:  "",
 			},
 			exp: exp{
-				respCode: http.StatusBadRequest,
-				respBody: `{"error":"invalid request body"}`,
+				respCode:  http.StatusOK,
+				principal: storage.AnonymousPrincipal,
 			},
 		},
 		{
-			name: "invalid values in request body",
+			name: "ok anonymous without admin token",
 			args: args{
-				reqBody: `{"user_id":"u-1","name":"John Doe","age":42}`,
-				ust:     userStorageMock{},
+				adminToken: "",
+				principal:  "support",
 			},
 			exp: exp{
-				respCode: http.StatusUnprocessableEntity,
-				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+				respCode:  http.StatusOK,
+				principal: storage.AnonymousPrincipal,
 			},
 		},
 		{
-			name: "user not found error",
+			name: "ok anonymous with invalid admin token",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
-				ust: userStorageMock{
-					updateUser: func() error {
-						return storage.UserNotFoundErr
-					},
-				},
+				adminToken: "invalid",
+				principal:  "support",
 			},
 			exp: exp{
-				respCode: http.StatusNotFound,
-				respBody: `{"error":"user not found"}`,
+				respCode:  http.StatusOK,
+				principal: storage.AnonymousPrincipal,
 			},
 		},
 		{
-			name: "database error",
+			name: "too long principal",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42}`,
-				ust: userStorageMock{
-					updateUser: func() error {
-						return errors.New("database error")
-					},
-				},
+				adminToken: adminToken,
+				principal:  strings.Repeat("a", maxPrincipalLength+1),
 			},
 			exp: exp{
-				respCode: http.StatusInternalServerError,
-				respBody: ``,
+				respCode:  http.StatusBadRequest,
+				principal: "",
 			},
 		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			req, err := http.NewRequest("", "", nil)
 			require.NoError(t, err)
+			req.Header.Set(headerPrincipal, tc.args.principal)
+			if tc.args.adminToken != "" {
+				req.Header.Set(headerAdminToken, tc.args.adminToken)
+			}
 
 			rec := httptest.NewRecorder()
 
-			h := newHandler(tc.args.ust)
-
-			h.UpdateUser(rec, req)
+			var principal string
+			principalMiddleware(adminToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal = storage.Principal(r.Context())
+			})).ServeHTTP(rec, req)
 
 			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
-			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
+			assert.Equal(t, tc.exp.principal, principal)
 		})
 	}
 }
 
-func TestHandler_DeleteUser(t *testing.T) {
+func Test_readYourWritesMiddleware(t *testing.T) {
 	type args struct {
-		reqBody string
-		ust     storage.UserStorage
+		readYourWrites string
 	}
 	type exp struct {
-		respCode int
-		respBody string
+		respCode       int
+		readYourWrites bool
 	}
 	tcs := []struct {
 		name string
@@ -412,82 +2102,124 @@ func TestHandler_DeleteUser(t *testing.T) {
 		{
 			name: "ok",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
-				ust: userStorageMock{
-					deleteUser: func() error {
-						return nil
-					},
-				},
-			},
-			exp: exp{
-				respCode: http.StatusNoContent,
-				respBody: ``,
-			},
-		},
-		{
-			name: "invalid request body",
-			args: args{
-				reqBody: `{`,
-				ust:     userStorageMock{},
+				readYourWrites: "true",
 			},
 			exp: exp{
-				respCode: http.StatusBadRequest,
-				respBody: `{"error":"invalid request body"}`,
+				respCode:       http.StatusOK,
+				readYourWrites: true,
 			},
 		},
 		{
-			name: "invalid values in request body",
+			name: "ok disabled",
 			args: args{
-				reqBody: `{"user_id":"u-1"}`,
-				ust:     userStorageMock{},
+				readYourWrites: "false",
 			},
 			exp: exp{
-				respCode: http.StatusUnprocessableEntity,
-				respBody: `{"errors":[{"path":"user_id","message":"invalid UUID length: 3"}]}`,
+				respCode:       http.StatusOK,
+				readYourWrites: false,
 			},
 		},
 		{
-			name: "user not found error",
+			name: "ok missing",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
-				ust: userStorageMock{
-					deleteUser: func() error {
-						return storage.UserNotFoundErr
-					},
-				},
+				readYourWrites: "",
 			},
 			exp: exp{
-				respCode: http.StatusNotFound,
-				respBody: `{"error":"user not found"}`,
+				respCode:       http.StatusOK,
+				readYourWrites: false,
 			},
 		},
 		{
-			name: "database error",
+			name: "invalid value",
 			args: args{
-				reqBody: `{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe"}`,
-				ust: userStorageMock{
-					deleteUser: func() error {
-						return errors.New("database error")
-					},
-				},
+				readYourWrites: "always",
 			},
 			exp: exp{
-				respCode: http.StatusInternalServerError,
-				respBody: ``,
+				respCode:       http.StatusBadRequest,
+				readYourWrites: false,
 			},
 		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := http.NewRequest("", "", strings.NewReader(tc.args.reqBody))
+			req, err := http.NewRequest("", "", nil)
 			require.NoError(t, err)
+			req.Header.Set(headerReadYourWrites, tc.args.readYourWrites)
 
 			rec := httptest.NewRecorder()
 
-			h := newHandler(tc.args.ust)
+			var readYourWrites bool
+			readYourWritesMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				readYourWrites = storage.ReadYourWrites(r.Context())
+			})).ServeHTTP(rec, req)
 
-			h.DeleteUser(rec, req)
+			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
+			assert.Equal(t, tc.exp.readYourWrites, readYourWrites)
+		})
+	}
+}
+
+func Test_writeStorageError(t *testing.T) {
+	type args struct {
+		err error
+	}
+	type exp struct {
+		respCode int
+		respBody string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "statement timeout",
+			args: args{err: storage.StatementTimeoutErr},
+			exp:  exp{respCode: http.StatusGatewayTimeout, respBody: `{"error":"statement timeout"}`},
+		},
+		{
+			name: "unique violation",
+			args: args{err: fmt.Errorf("%w: duplicate key", storage.UniqueViolationErr)},
+			exp:  exp{respCode: http.StatusConflict, respBody: `{"error":"unique constraint violated"}`},
+		},
+		{
+			name: "check violation",
+			args: args{err: fmt.Errorf("%w: users_age_check", storage.CheckViolationErr)},
+			exp:  exp{respCode: http.StatusBadRequest, respBody: `{"error":"check constraint violated"}`},
+		},
+		{
+			name: "serialization failure",
+			args: args{err: fmt.Errorf("%w: could not serialize access", storage.SerializationFailureErr)},
+			exp:  exp{respCode: http.StatusConflict, respBody: `{"error":"serialization failure"}`},
+		},
+		{
+			name: "deadlock",
+			args: args{err: fmt.Errorf("%w: deadlock detected", storage.DeadlockErr)},
+			exp:  exp{respCode: http.StatusConflict, respBody: `{"error":"deadlock detected"}`},
+		},
+		{
+			name: "connection lost",
+			args: args{err: fmt.Errorf("%w: broken pipe", storage.ConnectionLostErr)},
+			exp:  exp{respCode: http.StatusServiceUnavailable, respBody: `{"error":"database connection lost"}`},
+		},
+		{
+			name: "read-only",
+			args: args{err: storage.ReadOnlyErr},
+			exp:  exp{respCode: http.StatusServiceUnavailable, respBody: `{"error":"storage is read-only"}`},
+		},
+		{
+			name: "database error",
+			args: args{err: errors.New("database error")},
+			exp:  exp{respCode: http.StatusInternalServerError, respBody: ``},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			writeStorageError(tc.args.err, rec)
 
 			assert.Equal(t, tc.exp.respCode, rec.Code, "unexpected response code")
 			assert.Equal(t, tc.exp.respBody, rec.Body.String(), "unexpected response body")
@@ -566,30 +2298,110 @@ func Test_parseRequestBody(t *testing.T) {
 	}
 }
 
+func Test_parseOptionalRequestBody(t *testing.T) {
+	t.Run("empty request body", func(t *testing.T) {
+		var rb configuration.UsersRequest
+		req, err := http.NewRequest("", "", strings.NewReader(""))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+
+		assert.True(t, parseOptionalRequestBody(rec, req, &rb))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, configuration.UsersRequest{}, rb)
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		var rb configuration.UsersRequest
+		req, err := http.NewRequest("", "", strings.NewReader("{"))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+
+		assert.False(t, parseOptionalRequestBody(rec, req, &rb))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, `{"error":"invalid request body"}`, rec.Body.String())
+	})
+}
+
 type userStorageMock struct {
-	users      func() ([]storage.User, error)
-	user       func() (storage.User, error)
-	createUser func() error
-	updateUser func() error
-	deleteUser func() error
+	users       func() (storage.UsersResponse, error)
+	exportUsers func(fn func(usr storage.User) error) error
+	user        func() (storage.User, error)
+	createUser  func(usr storage.User) (storage.User, error)
+	createUsers func(users []storage.User, atomic bool) ([]error, error)
+	updateUser  func(patch storage.UserPatch) (storage.User, error)
+	putUser     func() (storage.User, bool, error)
+	importUsers func(users []storage.User, dryRun bool) ([]storage.ImportResult, error)
+	deleteUser  func() error
+	restoreUser func() error
+	purgeUsers  func() (int64, error)
+	searchUsers func(query string) (storage.SearchUsersResponse, error)
+	usersStats  func(ageBuckets []int, period string) (storage.UsersStats, error)
+	userHistory func() (storage.UserHistoryResponse, error)
+}
+
+type cachedStorageMock struct {
+	userStorageMock
+	stats storage.CacheStats
 }
 
-func (u userStorageMock) Users() ([]storage.User, error) {
+func (c cachedStorageMock) CacheStats() storage.CacheStats {
+	return c.stats
+}
+
+func (u userStorageMock) Users(_ context.Context, _ configuration.UsersFilter, _ int, _ string) (storage.UsersResponse, error) {
 	return u.users()
 }
 
-func (u userStorageMock) User(_ string) (storage.User, error) {
+func (u userStorageMock) ExportUsers(_ context.Context, _ configuration.UsersFilter, fn func(usr storage.User) error) error {
+	return u.exportUsers(fn)
+}
+
+func (u userStorageMock) User(_ context.Context, _ string) (storage.User, error) {
 	return u.user()
 }
 
-func (u userStorageMock) CreateUser(_ storage.User) error {
-	return u.createUser()
+func (u userStorageMock) CreateUser(_ context.Context, usr storage.User) (storage.User, error) {
+	return u.createUser(usr)
 }
 
-func (u userStorageMock) UpdateUser(_ storage.User) error {
-	return u.updateUser()
+func (u userStorageMock) CreateUsers(_ context.Context, users []storage.User, atomic bool) ([]error, error) {
+	return u.createUsers(users, atomic)
 }
 
-func (u userStorageMock) DeleteUser(_ string) error {
+func (u userStorageMock) UpdateUser(_ context.Context, patch storage.UserPatch) (storage.User, error) {
+	return u.updateUser(patch)
+}
+
+func (u userStorageMock) PutUser(_ context.Context, _ storage.User) (storage.User, bool, error) {
+	return u.putUser()
+}
+
+func (u userStorageMock) ImportUsers(_ context.Context, users []storage.User, dryRun bool) ([]storage.ImportResult, error) {
+	return u.importUsers(users, dryRun)
+}
+
+func (u userStorageMock) DeleteUser(_ context.Context, _ string) error {
 	return u.deleteUser()
 }
+
+func (u userStorageMock) RestoreUser(_ context.Context, _ string) error {
+	return u.restoreUser()
+}
+
+func (u userStorageMock) PurgeUsers(_ context.Context, _ time.Time) (int64, error) {
+	return u.purgeUsers()
+}
+
+func (u userStorageMock) SearchUsers(_ context.Context, query string, _ int, _ string) (storage.SearchUsersResponse, error) {
+	return u.searchUsers(query)
+}
+
+func (u userStorageMock) UsersStats(_ context.Context, ageBuckets []int, period string) (storage.UsersStats, error) {
+	return u.usersStats(ageBuckets, period)
+}
+
+func (u userStorageMock) UserHistory(_ context.Context, _ string, _ int, _ string) (storage.UserHistoryResponse, error) {
+	return u.userHistory()
+}
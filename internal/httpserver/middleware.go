@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"app/internal/response"
+	"app/internal/storage"
+)
+
+const maxPrincipalLength = 255
+
+func principalMiddleware(adminToken string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !validAdminToken(r, adminToken) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal := strings.TrimSpace(r.Header.Get(headerPrincipal))
+			if len(principal) > maxPrincipalLength {
+				response.WriteBadRequestError("invalid X-Principal header", w)
+				return
+			}
+
+			if principal != "" {
+				r = r.WithContext(storage.WithPrincipal(r.Context(), principal))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func validAdminToken(r *http.Request, adminToken string) bool {
+	if adminToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(headerAdminToken)), []byte(adminToken)) == 1
+}
+
+func readYourWritesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := strings.TrimSpace(r.Header.Get(headerReadYourWrites))
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		readYourWrites, err := strconv.ParseBool(value)
+		if err != nil {
+			response.WriteBadRequestError("invalid X-Read-Your-Writes header", w)
+			return
+		}
+
+		if readYourWrites {
+			r = r.WithContext(storage.WithReadYourWrites(r.Context()))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
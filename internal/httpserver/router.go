@@ -6,14 +6,26 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func newRouter(h HandlerInterface) *mux.Router {
+func newRouter(h HandlerInterface, adminToken string) *mux.Router {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/users", h.Users).Methods(http.MethodPost)
 	router.HandleFunc("/user", h.User).Methods(http.MethodPost)
 	router.HandleFunc("/create-user", h.CreateUser).Methods(http.MethodPost)
+	router.HandleFunc("/create-users", h.CreateUsers).Methods(http.MethodPost)
 	router.HandleFunc("/update-user", h.UpdateUser).Methods(http.MethodPost)
+	router.HandleFunc("/put-user", h.PutUser).Methods(http.MethodPost)
 	router.HandleFunc("/delete-user", h.DeleteUser).Methods(http.MethodPost)
+	router.HandleFunc("/restore-user", h.RestoreUser).Methods(http.MethodPost)
+	router.HandleFunc("/user-history", h.UserHistory).Methods(http.MethodPost)
+	router.HandleFunc("/db-stats", h.DBStats).Methods(http.MethodPost)
+	router.HandleFunc("/export-users", h.ExportUsers).Methods(http.MethodPost)
+	router.HandleFunc("/import-users", h.ImportUsers).Methods(http.MethodPost)
+	router.HandleFunc("/search-users", h.SearchUsers).Methods(http.MethodPost)
+	router.HandleFunc("/users-stats", h.UsersStats).Methods(http.MethodPost)
+
+	router.Use(principalMiddleware(adminToken))
+	router.Use(readYourWritesMiddleware)
 
 	return router
 }
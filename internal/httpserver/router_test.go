@@ -10,16 +10,25 @@ import (
 )
 
 const (
-	expResponseBodyUsers      = "users OK"
-	expResponseBodyUser       = "user OK"
-	expResponseBodyCreateUser = "create-user OK"
-	expResponseBodyUpdateUser = "update-user OK"
-	expResponseBodyDeleteUser = "delete-user OK"
+	expResponseBodyUsers       = "users OK"
+	expResponseBodyUser        = "user OK"
+	expResponseBodyCreateUser  = "create-user OK"
+	expResponseBodyCreateUsers = "create-users OK"
+	expResponseBodyUpdateUser  = "update-user OK"
+	expResponseBodyPutUser     = "put-user OK"
+	expResponseBodyDeleteUser  = "delete-user OK"
+	expResponseBodyRestoreUser = "restore-user OK"
+	expResponseBodyUserHistory = "user-history OK"
+	expResponseBodyDBStats     = "db-stats OK"
+	expResponseBodyExportUsers = "export-users OK"
+	expResponseBodyImportUsers = "import-users OK"
+	expResponseBodySearchUsers = "search-users OK"
+	expResponseBodyUsersStats  = "users-stats OK"
 )
 
 func Test_newRouter(t *testing.T) {
 	bh := &baseHandlerMock{}
-	router := newRouter(bh)
+	router := newRouter(bh, "secret")
 
 	type args struct {
 		method string
@@ -63,6 +72,16 @@ func Test_newRouter(t *testing.T) {
 				respBody: expResponseBodyCreateUser,
 			},
 		},
+		{
+			name: "create-users",
+			args: args{
+				method: http.MethodPost,
+				url:    "/create-users",
+			},
+			exp: exp{
+				respBody: expResponseBodyCreateUsers,
+			},
+		},
 		{
 			name: "update-user",
 			args: args{
@@ -73,6 +92,16 @@ func Test_newRouter(t *testing.T) {
 				respBody: expResponseBodyUpdateUser,
 			},
 		},
+		{
+			name: "put-user",
+			args: args{
+				method: http.MethodPost,
+				url:    "/put-user",
+			},
+			exp: exp{
+				respBody: expResponseBodyPutUser,
+			},
+		},
 		{
 			name: "delete-user",
 			args: args{
@@ -83,6 +112,76 @@ func Test_newRouter(t *testing.T) {
 				respBody: expResponseBodyDeleteUser,
 			},
 		},
+		{
+			name: "restore-user",
+			args: args{
+				method: http.MethodPost,
+				url:    "/restore-user",
+			},
+			exp: exp{
+				respBody: expResponseBodyRestoreUser,
+			},
+		},
+		{
+			name: "user-history",
+			args: args{
+				method: http.MethodPost,
+				url:    "/user-history",
+			},
+			exp: exp{
+				respBody: expResponseBodyUserHistory,
+			},
+		},
+		{
+			name: "db-stats",
+			args: args{
+				method: http.MethodPost,
+				url:    "/db-stats",
+			},
+			exp: exp{
+				respBody: expResponseBodyDBStats,
+			},
+		},
+		{
+			name: "export-users",
+			args: args{
+				method: http.MethodPost,
+				url:    "/export-users",
+			},
+			exp: exp{
+				respBody: expResponseBodyExportUsers,
+			},
+		},
+		{
+			name: "import-users",
+			args: args{
+				method: http.MethodPost,
+				url:    "/import-users",
+			},
+			exp: exp{
+				respBody: expResponseBodyImportUsers,
+			},
+		},
+		{
+			name: "search-users",
+			args: args{
+				method: http.MethodPost,
+				url:    "/search-users",
+			},
+			exp: exp{
+				respBody: expResponseBodySearchUsers,
+			},
+		},
+		{
+			name: "users-stats",
+			args: args{
+				method: http.MethodPost,
+				url:    "/users-stats",
+			},
+			exp: exp{
+				respBody: expResponseBodyUsersStats,
+			},
+		},
 	}
 
 	for _, tc := range okTcs {
@@ -133,14 +232,50 @@ func (bh *baseHandlerMock) CreateUser(w http.ResponseWriter, r *http.Request) {
 	bh.write(w, expResponseBodyCreateUser)
 }
 
+func (bh *baseHandlerMock) CreateUsers(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyCreateUsers)
+}
+
 func (bh *baseHandlerMock) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	bh.write(w, expResponseBodyUpdateUser)
 }
 
+func (bh *baseHandlerMock) PutUser(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyPutUser)
+}
+
 func (bh *baseHandlerMock) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	bh.write(w, expResponseBodyDeleteUser)
 }
 
+func (bh *baseHandlerMock) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyRestoreUser)
+}
+
+func (bh *baseHandlerMock) UserHistory(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyUserHistory)
+}
+
+func (bh *baseHandlerMock) DBStats(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyDBStats)
+}
+
+func (bh *baseHandlerMock) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyExportUsers)
+}
+
+func (bh *baseHandlerMock) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyImportUsers)
+}
+
+func (bh *baseHandlerMock) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodySearchUsers)
+}
+
+func (bh *baseHandlerMock) UsersStats(w http.ResponseWriter, r *http.Request) {
+	bh.write(w, expResponseBodyUsersStats)
+}
+
 func (bh *baseHandlerMock) write(w http.ResponseWriter, responseBody string) {
 	_, err := w.Write([]byte(responseBody))
 	if err != nil {
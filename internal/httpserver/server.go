@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,6 +16,8 @@ type server struct {
 func New(
 	port int,
 	userStorage storage.UserStorage,
+	adminToken string,
+	pools map[string]*sql.DB,
 ) *server {
 	return &server{
 		srv: &http.Server{
@@ -22,7 +25,10 @@ func New(
 			Handler: newRouter(
 				newHandler(
 					userStorage,
+					adminToken,
+					pools,
 				),
+				adminToken,
 			),
 		},
 	}
@@ -0,0 +1,417 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed queries/create_migrations_table_query.sql
+	createMigrationsTableSQL string
+	//go:embed queries/select_migrations_table_query.sql
+	selectMigrationsTableSQL string
+	//go:embed queries/select_migrations_query.sql
+	selectMigrationsSQL string
+	//go:embed queries/insert_migration_query.sql
+	insertMigrationSQL string
+	//go:embed queries/delete_migration_query.sql
+	deleteMigrationSQL string
+	//go:embed queries/select_legacy_table_query.sql
+	selectLegacyTableSQL string
+	//go:embed queries/select_legacy_version_query.sql
+	selectLegacyVersionSQL string
+	//go:embed queries/lock_query.sql
+	lockSQL string
+	//go:embed queries/unlock_query.sql
+	unlockSQL string
+)
+
+const advisoryLockKey = 7236841920515
+
+var (
+	DirtyLegacyVersionErr = errors.New("legacy schema_migrations version is dirty")
+	UnknownMigrationErr   = errors.New("applied migration has no source file")
+)
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Mismatch struct {
+	Pending []Migration
+	Unknown []int
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, file := range files {
+		match := fileNameRe.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", m.Version, m.Name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func New(db *sql.DB, migrations []Migration) *migrator {
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+func (m *migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		appliedAt, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := appliedAt[migration.Version]; ok {
+				continue
+			}
+
+			if err := inTx(ctx, conn, migration.Up, insertMigrationSQL, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %d_%s up failed: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+func (m *migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		appliedAt, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(appliedAt))
+		for version := range appliedAt {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			migration, ok := m.migration(version)
+			if !ok {
+				return fmt.Errorf("migration %d: %w", version, UnknownMigrationErr)
+			}
+
+			if err := inTx(ctx, conn, migration.Down, deleteMigrationSQL, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s down failed: %w", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+func (m *migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		appliedAt, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if at, ok := appliedAt[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (m *migrator) Mismatch(ctx context.Context) (Mismatch, error) {
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, selectMigrationsTableSQL).Scan(&exists); err != nil {
+		return Mismatch{}, err
+	}
+
+	appliedAt := make(map[int]time.Time)
+	if exists {
+		var err error
+		appliedAt, err = selectAppliedVersions(ctx, m.db)
+		if err != nil {
+			return Mismatch{}, err
+		}
+	}
+
+	legacyVersion := 0
+	if len(appliedAt) == 0 {
+		version, ok, err := selectLegacyVersion(ctx, m.db)
+		if err != nil {
+			return Mismatch{}, err
+		}
+
+		if ok {
+			legacyVersion = version
+		}
+	}
+
+	var mismatch Mismatch
+	for _, migration := range m.migrations {
+		if _, ok := appliedAt[migration.Version]; ok || migration.Version <= legacyVersion {
+			continue
+		}
+
+		mismatch.Pending = append(mismatch.Pending, migration)
+	}
+
+	for version := range appliedAt {
+		if _, ok := m.migration(version); !ok {
+			mismatch.Unknown = append(mismatch.Unknown, version)
+		}
+	}
+
+	if _, ok := m.migration(legacyVersion); legacyVersion > 0 && !ok {
+		mismatch.Unknown = append(mismatch.Unknown, legacyVersion)
+	}
+
+	sort.Ints(mismatch.Unknown)
+
+	return mismatch, nil
+}
+
+func (m *migrator) migration(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+func (m *migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, lockSQL, advisoryLockKey); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), unlockSQL, advisoryLockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, createMigrationsTableSQL); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	appliedAt, err := selectAppliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(appliedAt) > 0 {
+		return appliedAt, nil
+	}
+
+	adopted, err := m.adoptLegacyVersion(ctx, conn)
+	if err != nil || !adopted {
+		return appliedAt, err
+	}
+
+	return selectAppliedVersions(ctx, conn)
+}
+
+func (m *migrator) adoptLegacyVersion(ctx context.Context, conn *sql.Conn) (bool, error) {
+	version, ok, err := selectLegacyVersion(ctx, conn)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+
+		if _, err := tx.ExecContext(ctx, insertMigrationSQL, migration.Version, migration.Name); err != nil {
+			_ = tx.Rollback()
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func selectLegacyVersion(ctx context.Context, q queryer) (int, bool, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, selectLegacyTableSQL).Scan(&exists); err != nil || !exists {
+		return 0, false, err
+	}
+
+	var (
+		version int
+		dirty   bool
+	)
+	if err := q.QueryRowContext(ctx, selectLegacyVersionSQL).Scan(&version, &dirty); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+
+		return 0, false, err
+	}
+
+	if dirty {
+		return 0, false, DirtyLegacyVersionErr
+	}
+
+	return version, true, nil
+}
+
+func selectAppliedVersions(ctx context.Context, q queryer) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, selectMigrationsSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+
+	for rows.Next() {
+		var (
+			version int
+			name    string
+			at      time.Time
+		)
+
+		if err := rows.Scan(&version, &name, &at); err != nil {
+			return nil, err
+		}
+
+		appliedAt[version] = at
+	}
+
+	return appliedAt, rows.Err()
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, migrationSQL string, versionSQL string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, migrationSQL); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, versionSQL, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
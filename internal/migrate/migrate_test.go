@@ -0,0 +1,430 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	migrations "app/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	migration1 = Migration{Version: 1, Name: "initial_env", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"}
+	migration2 = Migration{Version: 2, Name: "soft_delete", Up: "ALTER TABLE a ADD b INT;", Down: "ALTER TABLE a DROP b;"}
+)
+
+func TestLoad(t *testing.T) {
+	type args struct {
+		fsys fstest.MapFS
+	}
+
+	type exp struct {
+		migrations []Migration
+		err        bool
+	}
+
+	cases := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				fsys: fstest.MapFS{
+					"02_soft_delete.up.sql":   {Data: []byte(migration2.Up)},
+					"02_soft_delete.down.sql": {Data: []byte(migration2.Down)},
+					"01_initial_env.up.sql":   {Data: []byte(migration1.Up)},
+					"01_initial_env.down.sql": {Data: []byte(migration1.Down)},
+				},
+			},
+			exp: exp{
+				migrations: []Migration{migration1, migration2},
+			},
+		},
+		{
+			name: "invalid file name",
+			args: args{
+				fsys: fstest.MapFS{
+					"initial_env.up.sql": {Data: []byte(migration1.Up)},
+				},
+			},
+			exp: exp{
+				err: true,
+			},
+		},
+		{
+			name: "missing down file",
+			args: args{
+				fsys: fstest.MapFS{
+					"01_initial_env.up.sql": {Data: []byte(migration1.Up)},
+				},
+			},
+			exp: exp{
+				err: true,
+			},
+		},
+		{
+			name: "conflicting names",
+			args: args{
+				fsys: fstest.MapFS{
+					"01_initial_env.up.sql": {Data: []byte(migration1.Up)},
+					"01_other.down.sql":     {Data: []byte(migration1.Down)},
+				},
+			},
+			exp: exp{
+				err: true,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			migrations, err := Load(c.args.fsys)
+			if c.exp.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, c.exp.migrations, migrations)
+		})
+	}
+}
+
+func TestLoad_embedded(t *testing.T) {
+	src, err := fs.Sub(migrations.Migrations, "src")
+	require.NoError(t, err)
+
+	loaded, err := Load(src)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+
+	for i, migration := range loaded {
+		assert.Equal(t, i+1, migration.Version)
+	}
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta(lockSQL)).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(createMigrationsTableSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta(unlockSQL)).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func migrationRows(versions ...int) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, version := range versions {
+		rows.AddRow(version, "migration", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+
+	return rows
+}
+
+func TestMigrator_Up(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(migration2.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(insertMigrationSQL)).WithArgs(2, "soft_delete").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+
+		applied, err := New(db, []Migration{migration1, migration2}).Up(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []Migration{migration2}, applied)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("adopts legacy version", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows())
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyVersionSQL)).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(1, false))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(insertMigrationSQL)).WithArgs(1, "initial_env").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(migration2.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(insertMigrationSQL)).WithArgs(2, "soft_delete").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+
+		applied, err := New(db, []Migration{migration1, migration2}).Up(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []Migration{migration2}, applied)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok unknown applied versions", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1, 2, 3, 4))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Unknown: []int{3, 4}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok unknown legacy version", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyVersionSQL)).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(3, false))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Unknown: []int{3}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dirty legacy version error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows())
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyVersionSQL)).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(1, true))
+		expectUnlock(mock)
+
+		_, err = New(db, []Migration{migration1, migration2}).Up(context.Background())
+		assert.ErrorIs(t, err, DirtyLegacyVersionErr)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("migration error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expErr := errors.New("syntax error")
+
+		expectLock(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(migration2.Up)).WillReturnError(expErr)
+		mock.ExpectRollback()
+		expectUnlock(mock)
+
+		applied, err := New(db, []Migration{migration1, migration2}).Up(context.Background())
+		assert.ErrorIs(t, err, expErr)
+		assert.Empty(t, applied)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("lock error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expErr := errors.New("lock error")
+
+		mock.ExpectExec(regexp.QuoteMeta(lockSQL)).WithArgs(advisoryLockKey).WillReturnError(expErr)
+
+		_, err = New(db, []Migration{migration1}).Up(context.Background())
+		assert.ErrorIs(t, err, expErr)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Down(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1, 2))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(migration2.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(deleteMigrationSQL)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+
+		reverted, err := New(db, []Migration{migration1, migration2}).Down(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, []Migration{migration2}, reverted)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown migration error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1, 2))
+		expectUnlock(mock)
+
+		_, err = New(db, []Migration{migration1}).Down(context.Background(), 1)
+		assert.ErrorIs(t, err, UnknownMigrationErr)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Status(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	appliedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1))
+	expectUnlock(mock)
+
+	statuses, err := New(db, []Migration{migration1, migration2}).Status(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Status{
+		{Version: 1, Name: "initial_env", AppliedAt: &appliedAt},
+		{Version: 2, Name: "soft_delete"},
+	}, statuses)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Mismatch(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Pending: []Migration{migration2}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok up to date", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1, 2))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok legacy version", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyVersionSQL)).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(1, false))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Pending: []Migration{migration2}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok unmigrated database", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Pending: []Migration{migration1, migration2}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok unknown applied versions", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsSQL)).WillReturnRows(migrationRows(1, 2, 3, 4))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Unknown: []int{3, 4}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok unknown legacy version", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyVersionSQL)).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(3, false))
+
+		mismatch, err := New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Mismatch{Unknown: []int{3}}, mismatch)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dirty legacy version error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectMigrationsTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyTableSQL)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectLegacyVersionSQL)).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(1, true))
+
+		_, err = New(db, []Migration{migration1, migration2}).Mismatch(context.Background())
+		assert.ErrorIs(t, err, DirtyLegacyVersionErr)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS "public"."user_service_migrations" (
+    "version" INTEGER NOT NULL PRIMARY KEY,
+    "name" VARCHAR(255) NOT NULL,
+    "applied_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
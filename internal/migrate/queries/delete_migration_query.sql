@@ -0,0 +1,4 @@
+DELETE FROM
+    "public"."user_service_migrations"
+WHERE
+    "version" = $1;
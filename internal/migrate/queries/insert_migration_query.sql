@@ -0,0 +1,8 @@
+INSERT INTO
+    "public"."user_service_migrations" (
+        "version",
+        "name"
+    )
+VALUES (
+    $1, $2
+);
@@ -0,0 +1,2 @@
+SELECT
+    pg_advisory_lock($1);
@@ -0,0 +1,2 @@
+SELECT
+    to_regclass('"public"."schema_migrations"') IS NOT NULL;
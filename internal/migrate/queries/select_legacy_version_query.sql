@@ -0,0 +1,6 @@
+SELECT
+    "version",
+    "dirty"
+FROM
+    "public"."schema_migrations"
+LIMIT 1;
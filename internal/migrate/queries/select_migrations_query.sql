@@ -0,0 +1,8 @@
+SELECT
+    "version",
+    "name",
+    "applied_at"
+FROM
+    "public"."user_service_migrations"
+ORDER BY
+    "version";
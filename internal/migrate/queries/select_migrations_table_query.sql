@@ -0,0 +1,2 @@
+SELECT
+    to_regclass('"public"."user_service_migrations"') IS NOT NULL;
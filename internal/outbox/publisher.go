@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"app/internal/storage"
+)
+
+const (
+	headerContentType = "Content-Type"
+	headerEventId     = "X-Event-Id"
+	headerEventType   = "X-Event-Type"
+	headerSignature   = "X-Signature"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, evt storage.Event) error
+	Close() error
+}
+
+type writerPublisher struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+func NewStdoutPublisher() Publisher {
+	return &writerPublisher{w: os.Stdout}
+}
+
+func NewFilePublisher(path string) (Publisher, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writerPublisher{w: file, file: file}, nil
+}
+
+func (p *writerPublisher) Publish(_ context.Context, evt storage.Event) error {
+	content, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(append(content, '\n')); err != nil {
+		return err
+	}
+
+	if p.file != nil {
+		return p.file.Sync()
+	}
+
+	return nil
+}
+
+func (p *writerPublisher) Close() error {
+	if p.file != nil {
+		return p.file.Close()
+	}
+
+	return nil
+}
+
+type webhookPublisher struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+func NewWebhookPublisher(url string, secret string, timeout time.Duration) Publisher {
+	return &webhookPublisher{
+		client: &http.Client{Timeout: timeout},
+		url:    url,
+		secret: secret,
+	}
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, evt storage.Event) error {
+	content, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(headerContentType, "application/json")
+	req.Header.Set(headerEventId, evt.EventId)
+	req.Header.Set(headerEventType, evt.Type)
+
+	if p.secret != "" {
+		req.Header.Set(headerSignature, "sha256="+sign(p.secret, content))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *webhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+
+	return nil
+}
+
+func sign(secret string, content []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
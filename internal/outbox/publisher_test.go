@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"app/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var event = storage.Event{
+	EventId:    "0186a0b4-0000-7000-8000-000000000001",
+	Type:       storage.EventUserCreated,
+	UserId:     userId,
+	After:      &storage.User{UserId: userId, Name: "John Doe", Age: 42, Version: 1},
+	Principal:  storage.AnonymousPrincipal,
+	OccurredAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+const expEventBody = `{"event_id":"0186a0b4-0000-7000-8000-000000000001","type":"user.created","user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","before":null,"after":{"user_id":"7df661d5-47e3-4533-baa6-5f952d18bffe","name":"John Doe","age":42,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},"principal":"anonymous","occurred_at":"2022-01-01T00:00:00Z"}`
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	p := &writerPublisher{w: &buf}
+
+	require.NoError(t, p.Publish(context.Background(), event))
+	require.NoError(t, p.Publish(context.Background(), event))
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, expEventBody+"\n"+expEventBody+"\n", buf.String())
+}
+
+func TestNewFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	for i := 0; i < 2; i++ {
+		p, err := NewFilePublisher(path)
+		require.NoError(t, err)
+		require.NoError(t, p.Publish(context.Background(), event))
+		require.NoError(t, p.Close())
+	}
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expEventBody+"\n"+expEventBody+"\n", string(content))
+
+	_, err = NewFilePublisher(filepath.Join(t.TempDir(), "missing", "events.ndjson"))
+	assert.Error(t, err)
+}
+
+func TestWebhookPublisher_Publish(t *testing.T) {
+	type args struct {
+		secret     string
+		statusCode int
+	}
+	type exp struct {
+		signature string
+		err       string
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				statusCode: http.StatusNoContent,
+			},
+			exp: exp{},
+		},
+		{
+			name: "ok signed",
+			args: args{
+				secret:     "secret",
+				statusCode: http.StatusOK,
+			},
+			exp: exp{
+				signature: "sha256=" + sign("secret", []byte(expEventBody)),
+			},
+		},
+		{
+			name: "status error",
+			args: args{
+				statusCode: http.StatusServiceUnavailable,
+			},
+			exp: exp{
+				err: "webhook responded with status 503",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var req *http.Request
+			var body []byte
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req = r
+				body, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(tc.args.statusCode)
+			}))
+			defer srv.Close()
+
+			p := NewWebhookPublisher(srv.URL, tc.args.secret, time.Second)
+			defer p.Close()
+
+			err := p.Publish(context.Background(), event)
+			if tc.exp.err != "" {
+				assert.EqualError(t, err, tc.exp.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			require.NotNil(t, req)
+			assert.Equal(t, http.MethodPost, req.Method)
+			assert.Equal(t, "application/json", req.Header.Get(headerContentType))
+			assert.Equal(t, event.EventId, req.Header.Get(headerEventId))
+			assert.Equal(t, event.Type, req.Header.Get(headerEventType))
+			assert.Equal(t, tc.exp.signature, req.Header.Get(headerSignature))
+			assert.Equal(t, expEventBody, string(body))
+		})
+	}
+}
+
+func TestWebhookPublisher_Publish_unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	p := NewWebhookPublisher(srv.URL, "", time.Second)
+
+	assert.Error(t, p.Publish(context.Background(), event))
+}
@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"app/internal/helpers"
+	"app/internal/storage"
+)
+
+type relay struct {
+	outbox      storage.EventOutbox
+	publisher   Publisher
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	ctx         context.Context
+	cancel      context.CancelFunc
+	stopCh      chan struct{}
+	doneCh      chan struct{}
+}
+
+func New(
+	outbox storage.EventOutbox,
+	publisher Publisher,
+	interval time.Duration,
+	batchSize int,
+	maxAttempts int,
+) *relay {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &relay{
+		outbox:      outbox,
+		publisher:   publisher,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		ctx:         ctx,
+		cancel:      cancel,
+		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
+	}
+}
+
+func (r *relay) Run() {
+	defer close(r.doneCh)
+
+	log.Println(fmt.Sprintf("outbox relay started - interval %s, batch size %d, max attempts %d", r.interval, r.batchSize, r.maxAttempts))
+
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	for {
+		r.relay()
+
+		select {
+		case <-r.stopCh:
+			log.Println("outbox relay run method finished")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (r *relay) Stop() {
+	log.Println("outbox relay stopping")
+
+	close(r.stopCh)
+	r.cancel()
+	<-r.doneCh
+
+	if err := r.publisher.Close(); err != nil {
+		log.Println(fmt.Errorf("closing event publisher failed with error - %s", err))
+	}
+
+	log.Println("outbox relay successfully stopped")
+}
+
+func (r *relay) relay() {
+	for {
+		published, err := r.relayBatch()
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+
+			log.Println(fmt.Errorf("relaying events failed with error - %s", err))
+			return
+		}
+
+		if published < r.batchSize {
+			return
+		}
+
+		select {
+		case <-r.stopCh:
+			return
+		default:
+		}
+	}
+}
+
+func (r *relay) relayBatch() (int, error) {
+	return r.outbox.RelayEvents(r.ctx, r.batchSize, r.maxAttempts, func(evt storage.Event) error {
+		ctx, cancel := context.WithTimeout(r.ctx, helpers.DefaultTimeout)
+		defer cancel()
+
+		err := r.publisher.Publish(ctx, evt)
+		if err != nil && r.ctx.Err() == nil && evt.Attempts+1 >= r.maxAttempts {
+			log.Println(fmt.Errorf("parking event %s of user %s after %d failed attempts, last error - %s", evt.EventId, evt.UserId, evt.Attempts+1, err))
+		}
+
+		return err
+	})
+}
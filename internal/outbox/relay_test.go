@@ -0,0 +1,164 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"app/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userId = "7df661d5-47e3-4533-baa6-5f952d18bffe"
+
+type publisherMock struct {
+	mu           sync.Mutex
+	events       []storage.Event
+	fail         bool
+	poisonUserId string
+	closed       bool
+}
+
+func (p *publisherMock) Publish(_ context.Context, evt storage.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fail {
+		return errors.New("publisher unavailable")
+	}
+
+	if evt.UserId == p.poisonUserId {
+		return errors.New("event rejected")
+	}
+
+	p.events = append(p.events, evt)
+	return nil
+}
+
+func (p *publisherMock) Close() error {
+	p.closed = true
+	return nil
+}
+
+func (p *publisherMock) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	types := make([]string, 0, len(p.events))
+	for _, evt := range p.events {
+		types = append(types, evt.Type)
+	}
+
+	return types
+}
+
+func TestNew(t *testing.T) {
+	ust := storage.NewMemoryUserStorage().(storage.EventOutbox)
+	publisher := &publisherMock{}
+
+	r := New(ust, publisher, time.Second, 10, 3)
+
+	assert.Equal(t, ust, r.outbox)
+	assert.Equal(t, publisher, r.publisher)
+	assert.Equal(t, time.Second, r.interval)
+	assert.Equal(t, 10, r.batchSize)
+	assert.Equal(t, 3, r.maxAttempts)
+}
+
+func TestRelay_Run(t *testing.T) {
+	ctx := context.Background()
+	ust := storage.NewMemoryUserStorage()
+	_, err := ust.CreateUser(ctx, storage.User{UserId: userId, Name: "John Doe", Age: 42})
+	require.NoError(t, err)
+	require.NoError(t, ust.DeleteUser(ctx, userId))
+	require.NoError(t, ust.RestoreUser(ctx, userId))
+
+	publisher := &publisherMock{fail: true}
+
+	r := New(ust.(storage.EventOutbox), publisher, 10*time.Millisecond, 2, 100)
+	go r.Run()
+	time.Sleep(30 * time.Millisecond)
+
+	assert.Empty(t, publisher.types())
+
+	publisher.mu.Lock()
+	publisher.fail = false
+	publisher.mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+
+	assert.True(t, stopsInTime(r))
+	assert.True(t, publisher.closed)
+	assert.Equal(t, []string{storage.EventUserCreated, storage.EventUserDeleted, storage.EventUserRestored}, publisher.types())
+}
+
+func TestRelay_Run_poisonEvent(t *testing.T) {
+	const otherUserId = "0f2e5c1a-3b9d-4c7e-8a61-2d5f9b0e4c33"
+
+	ctx := context.Background()
+	ust := storage.NewMemoryUserStorage()
+	_, err := ust.CreateUser(ctx, storage.User{UserId: userId, Name: "John Doe", Age: 42})
+	require.NoError(t, err)
+	_, err = ust.CreateUser(ctx, storage.User{UserId: otherUserId, Name: "Jane Roe", Age: 30})
+	require.NoError(t, err)
+	require.NoError(t, ust.DeleteUser(ctx, otherUserId))
+
+	publisher := &publisherMock{poisonUserId: userId}
+
+	r := New(ust.(storage.EventOutbox), publisher, time.Millisecond, 10, 3)
+	go r.Run()
+
+	assert.Eventually(t, func() bool {
+		return len(publisher.types()) == 2
+	}, time.Second, time.Millisecond)
+	assert.True(t, stopsInTime(r))
+	assert.Equal(t, []string{storage.EventUserCreated, storage.EventUserDeleted}, publisher.types())
+
+	for _, evt := range publisher.events {
+		assert.Equal(t, otherUserId, evt.UserId)
+	}
+}
+
+func stopsInTime(r *relay) bool {
+	doneCh := make(chan struct{})
+	go func() {
+		r.Stop()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+type blockingPublisher struct {
+	publisherMock
+	started chan struct{}
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, _ storage.Event) error {
+	close(p.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRelay_Stop(t *testing.T) {
+	ctx := context.Background()
+	ust := storage.NewMemoryUserStorage()
+	_, err := ust.CreateUser(ctx, storage.User{UserId: userId, Name: "John Doe", Age: 42})
+	require.NoError(t, err)
+
+	publisher := &blockingPublisher{started: make(chan struct{})}
+
+	r := New(ust.(storage.EventOutbox), publisher, time.Hour, 10, 3)
+	go r.Run()
+	<-publisher.started
+
+	assert.True(t, stopsInTime(r))
+	assert.True(t, publisher.closed)
+}
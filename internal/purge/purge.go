@@ -0,0 +1,77 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"app/internal/helpers"
+	"app/internal/storage"
+)
+
+type purger struct {
+	ust       storage.UserStorage
+	retention time.Duration
+	interval  time.Duration
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+func New(
+	userStorage storage.UserStorage,
+	retention time.Duration,
+	interval time.Duration,
+) *purger {
+	return &purger{
+		ust:       userStorage,
+		retention: retention,
+		interval:  interval,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+func (p *purger) Run() {
+	defer close(p.doneCh)
+
+	log.Println(fmt.Sprintf("purger started - retention %s, interval %s", p.retention, p.interval))
+
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for {
+		p.purge()
+
+		select {
+		case <-p.stopCh:
+			log.Println("purger run method finished")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (p *purger) Stop() {
+	log.Println("purger stopping")
+
+	close(p.stopCh)
+	<-p.doneCh
+
+	log.Println("purger successfully stopped")
+}
+
+func (p *purger) purge() {
+	ctx, cancel := context.WithTimeout(context.Background(), helpers.DefaultTimeout)
+	defer cancel()
+
+	purged, err := p.ust.PurgeUsers(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		log.Println(fmt.Errorf("purging deleted users failed with error - %s", err))
+		return
+	}
+
+	if purged > 0 {
+		log.Println(fmt.Sprintf("purged %d deleted users", purged))
+	}
+}
@@ -0,0 +1,65 @@
+package purge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"app/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userId = "7df661d5-47e3-4533-baa6-5f952d18bffe"
+
+func TestNew(t *testing.T) {
+	ust := storage.NewMemoryUserStorage()
+
+	p := New(ust, time.Hour, time.Minute)
+
+	assert.Equal(t, ust, p.ust)
+	assert.Equal(t, time.Hour, p.retention)
+	assert.Equal(t, time.Minute, p.interval)
+}
+
+func TestPurger_Run(t *testing.T) {
+	ctx := context.Background()
+	ust := storage.NewMemoryUserStorage()
+	_, err := ust.CreateUser(ctx, storage.User{UserId: userId, Name: "John Doe", Age: 42})
+	require.NoError(t, err)
+	require.NoError(t, ust.DeleteUser(ctx, userId))
+
+	t.Run("within retention", func(t *testing.T) {
+		p := New(ust, time.Hour, 10*time.Millisecond)
+		go p.Run()
+		time.Sleep(30 * time.Millisecond)
+
+		assert.True(t, stopsInTime(p))
+		assert.NoError(t, ust.RestoreUser(ctx, userId))
+		require.NoError(t, ust.DeleteUser(ctx, userId))
+	})
+
+	t.Run("past retention", func(t *testing.T) {
+		p := New(ust, -time.Hour, 10*time.Millisecond)
+		go p.Run()
+		time.Sleep(30 * time.Millisecond)
+
+		assert.True(t, stopsInTime(p))
+		assert.Equal(t, storage.UserNotFoundErr, ust.RestoreUser(ctx, userId))
+	})
+}
+
+func stopsInTime(p *purger) bool {
+	doneCh := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
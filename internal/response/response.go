@@ -36,6 +36,14 @@ func WriteBadRequestError(err string, w http.ResponseWriter) {
 	WriteJson(http.StatusBadRequest, badRequestError{Error: err}, w)
 }
 
+type forbiddenError struct {
+	Error string `json:"error"`
+}
+
+func WriteForbiddenError(err string, w http.ResponseWriter) {
+	WriteJson(http.StatusForbidden, forbiddenError{Error: err}, w)
+}
+
 type notFoundError struct {
 	Error string `json:"error"`
 }
@@ -52,6 +60,38 @@ func WriteConflictError(err string, w http.ResponseWriter) {
 	WriteJson(http.StatusConflict, conflictError{Error: err}, w)
 }
 
+type gatewayTimeoutError struct {
+	Error string `json:"error"`
+}
+
+func WriteGatewayTimeoutError(err string, w http.ResponseWriter) {
+	WriteJson(http.StatusGatewayTimeout, gatewayTimeoutError{Error: err}, w)
+}
+
+type serviceUnavailableError struct {
+	Error string `json:"error"`
+}
+
+func WriteServiceUnavailableError(err string, w http.ResponseWriter) {
+	WriteJson(http.StatusServiceUnavailable, serviceUnavailableError{Error: err}, w)
+}
+
+type unsupportedMediaTypeError struct {
+	Error string `json:"error"`
+}
+
+func WriteUnsupportedMediaTypeError(err string, w http.ResponseWriter) {
+	WriteJson(http.StatusUnsupportedMediaType, unsupportedMediaTypeError{Error: err}, w)
+}
+
+type preconditionFailedError struct {
+	Error string `json:"error"`
+}
+
+func WritePreconditionFailedError(err string, w http.ResponseWriter) {
+	WriteJson(http.StatusPreconditionFailed, preconditionFailedError{Error: err}, w)
+}
+
 type ValidationErrors struct {
 	Errors []ValidationError `json:"errors"`
 }
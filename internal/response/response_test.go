@@ -26,6 +26,21 @@ func Test_WriteBadRequestError(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, res.Code)
 }
 
+func TestWriteForbiddenError(t *testing.T) {
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteForbiddenError("forbidden", w)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "", strings.NewReader(""))
+	require.NoError(t, err)
+
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Equal(t, `{"error":"forbidden"}`, res.Body.String())
+}
+
 func TestWriteNotFoundError(t *testing.T) {
 	res := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -54,6 +69,66 @@ func Test_WriteConflictError(t *testing.T) {
 	assert.Equal(t, http.StatusConflict, res.Code)
 }
 
+func Test_WritePreconditionFailedError(t *testing.T) {
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WritePreconditionFailedError("precondition failed", w)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "", strings.NewReader(""))
+	require.NoError(t, err)
+
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, `{"error":"precondition failed"}`, res.Body.String())
+}
+
+func Test_WriteGatewayTimeoutError(t *testing.T) {
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteGatewayTimeoutError("timeout", w)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "", strings.NewReader(""))
+	require.NoError(t, err)
+
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, res.Code)
+	assert.Equal(t, `{"error":"timeout"}`, res.Body.String())
+}
+
+func Test_WriteServiceUnavailableError(t *testing.T) {
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceUnavailableError("unavailable", w)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "", strings.NewReader(""))
+	require.NoError(t, err)
+
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, `{"error":"unavailable"}`, res.Body.String())
+}
+
+func Test_WriteUnsupportedMediaTypeError(t *testing.T) {
+	res := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteUnsupportedMediaTypeError("unsupported", w)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "", strings.NewReader(""))
+	require.NoError(t, err)
+
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.Code)
+	assert.Equal(t, `{"error":"unsupported"}`, res.Body.String())
+}
+
 func Test_WriteUnprocessableEntitiesError(t *testing.T) {
 	res := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
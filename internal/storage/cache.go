@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/internal/configuration"
+)
+
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+type CacheStatsProvider interface {
+	CacheStats() CacheStats
+}
+
+type cacheEntry struct {
+	userId    string
+	usr       User
+	expiresAt time.Time
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	usr   User
+	err   error
+	stale bool
+}
+
+type cachedStorage struct {
+	hits        int64
+	misses      int64
+	ust         UserStorage
+	size        int
+	ttl         time.Duration
+	loadTimeout time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	calls   map[string]*cacheCall
+}
+
+func NewCachedUserStorage(ust UserStorage, size int, ttl time.Duration, loadTimeout time.Duration) UserStorage {
+	return &cachedStorage{
+		ust:         ust,
+		size:        size,
+		ttl:         ttl,
+		loadTimeout: loadTimeout,
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		calls:       make(map[string]*cacheCall),
+	}
+}
+
+func (st *cachedStorage) CacheStats() CacheStats {
+	st.mu.Lock()
+	entries := st.lru.Len()
+	st.mu.Unlock()
+
+	return CacheStats{
+		Hits:    atomic.LoadInt64(&st.hits),
+		Misses:  atomic.LoadInt64(&st.misses),
+		Entries: entries,
+	}
+}
+
+func (st *cachedStorage) Users(ctx context.Context, filter configuration.UsersFilter, limit int, cursor string) (UsersResponse, error) {
+	return st.ust.Users(ctx, filter, limit, cursor)
+}
+
+func (st *cachedStorage) ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error {
+	return st.ust.ExportUsers(ctx, filter, fn)
+}
+
+func (st *cachedStorage) User(ctx context.Context, userId string) (User, error) {
+	if ReadYourWrites(ctx) {
+		return st.ust.User(ctx, userId)
+	}
+
+	st.mu.Lock()
+	if usr, ok := st.get(userId); ok {
+		st.mu.Unlock()
+		atomic.AddInt64(&st.hits, 1)
+		return usr, nil
+	}
+
+	atomic.AddInt64(&st.misses, 1)
+
+	call, ok := st.calls[userId]
+	if !ok {
+		call = &cacheCall{done: make(chan struct{})}
+		st.calls[userId] = call
+		go st.load(userId, call)
+	}
+	st.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return User{}, ctx.Err()
+	case <-call.done:
+		return call.usr, call.err
+	}
+}
+
+func (st *cachedStorage) load(userId string, call *cacheCall) {
+	ctx, cancel := st.loadContext()
+	defer cancel()
+
+	call.usr, call.err = st.ust.User(ctx, userId)
+	if call.err != nil && ctx.Err() == context.DeadlineExceeded {
+		call.err = StatementTimeoutErr
+	}
+
+	st.mu.Lock()
+	if !call.stale {
+		delete(st.calls, userId)
+		if call.err == nil {
+			st.put(userId, call.usr)
+		}
+	}
+	st.mu.Unlock()
+
+	close(call.done)
+}
+
+func (st *cachedStorage) loadContext() (context.Context, context.CancelFunc) {
+	ctx := WithReadYourWrites(context.Background())
+
+	if st.loadTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, st.loadTimeout)
+}
+
+func (st *cachedStorage) CreateUser(ctx context.Context, usr User) (User, error) {
+	defer st.invalidate(usr.UserId)
+
+	return st.ust.CreateUser(ctx, usr)
+}
+
+func (st *cachedStorage) CreateUsers(ctx context.Context, users []User, atomic bool) ([]error, error) {
+	defer func() {
+		for _, usr := range users {
+			st.invalidate(usr.UserId)
+		}
+	}()
+
+	return st.ust.CreateUsers(ctx, users, atomic)
+}
+
+func (st *cachedStorage) UpdateUser(ctx context.Context, patch UserPatch) (User, error) {
+	defer st.invalidate(patch.UserId)
+
+	return st.ust.UpdateUser(ctx, patch)
+}
+
+func (st *cachedStorage) PutUser(ctx context.Context, usr User) (User, bool, error) {
+	defer st.invalidate(usr.UserId)
+
+	return st.ust.PutUser(ctx, usr)
+}
+
+func (st *cachedStorage) ImportUsers(ctx context.Context, users []User, dryRun bool) ([]ImportResult, error) {
+	if !dryRun {
+		defer func() {
+			for _, usr := range users {
+				st.invalidate(usr.UserId)
+			}
+		}()
+	}
+
+	return st.ust.ImportUsers(ctx, users, dryRun)
+}
+
+func (st *cachedStorage) DeleteUser(ctx context.Context, userId string) error {
+	defer st.invalidate(userId)
+
+	return st.ust.DeleteUser(ctx, userId)
+}
+
+func (st *cachedStorage) RestoreUser(ctx context.Context, userId string) error {
+	defer st.invalidate(userId)
+
+	return st.ust.RestoreUser(ctx, userId)
+}
+
+func (st *cachedStorage) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return st.ust.PurgeUsers(ctx, deletedBefore)
+}
+
+func (st *cachedStorage) SearchUsers(ctx context.Context, query string, limit int, cursor string) (SearchUsersResponse, error) {
+	return st.ust.SearchUsers(ctx, query, limit, cursor)
+}
+
+func (st *cachedStorage) UsersStats(ctx context.Context, ageBuckets []int, period string) (UsersStats, error) {
+	return st.ust.UsersStats(ctx, ageBuckets, period)
+}
+
+func (st *cachedStorage) UserHistory(ctx context.Context, userId string, limit int, cursor string) (UserHistoryResponse, error) {
+	return st.ust.UserHistory(ctx, userId, limit, cursor)
+}
+
+func (st *cachedStorage) get(userId string) (User, bool) {
+	elem, ok := st.entries[userId]
+	if !ok {
+		return User{}, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		st.lru.Remove(elem)
+		delete(st.entries, userId)
+		return User{}, false
+	}
+
+	st.lru.MoveToFront(elem)
+
+	return entry.usr, true
+}
+
+func (st *cachedStorage) put(userId string, usr User) {
+	entry := &cacheEntry{userId: userId, usr: usr, expiresAt: time.Now().Add(st.ttl)}
+
+	if elem, ok := st.entries[userId]; ok {
+		elem.Value = entry
+		st.lru.MoveToFront(elem)
+		return
+	}
+
+	st.entries[userId] = st.lru.PushFront(entry)
+
+	for st.lru.Len() > st.size {
+		oldest := st.lru.Back()
+		st.lru.Remove(oldest)
+		delete(st.entries, oldest.Value.(*cacheEntry).userId)
+	}
+}
+
+func (st *cachedStorage) invalidate(userId string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if elem, ok := st.entries[userId]; ok {
+		st.lru.Remove(elem)
+		delete(st.entries, userId)
+	}
+
+	if call, ok := st.calls[userId]; ok {
+		call.stale = true
+		delete(st.calls, userId)
+	}
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingStorage struct {
+	UserStorage
+	mu             sync.Mutex
+	calls          int
+	readYourWrites bool
+	release        chan struct{}
+}
+
+func (st *countingStorage) User(ctx context.Context, userId string) (User, error) {
+	st.mu.Lock()
+	st.calls++
+	st.readYourWrites = ReadYourWrites(ctx)
+	st.mu.Unlock()
+
+	if st.release != nil {
+		select {
+		case <-st.release:
+		case <-ctx.Done():
+			return User{}, ctx.Err()
+		}
+	}
+
+	return st.UserStorage.User(ctx, userId)
+}
+
+func (st *countingStorage) userCalls() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.calls
+}
+
+func TestCachedStorage_User(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("hit after miss", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1)}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		for i := 0; i < 3; i++ {
+			usr, err := st.User(ctx, user1.UserId)
+			require.NoError(t, err)
+			assert.Equal(t, user1, untimed(usr))
+		}
+
+		assert.Equal(t, 1, ust.userCalls())
+		assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Entries: 1}, st.(CacheStatsProvider).CacheStats())
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t)}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		for i := 0; i < 2; i++ {
+			_, err := st.User(ctx, user1.UserId)
+			assert.Equal(t, UserNotFoundErr, err)
+		}
+
+		assert.Equal(t, 2, ust.userCalls())
+	})
+
+	t.Run("expired entry", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1)}
+		st := NewCachedUserStorage(ust, 10, time.Millisecond, time.Second)
+
+		_, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+
+		time.Sleep(2 * time.Millisecond)
+
+		_, err = st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, ust.userCalls())
+	})
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1, user2, user3)}
+		st := NewCachedUserStorage(ust, 2, time.Minute, time.Second)
+
+		for _, userId := range []string{user1.UserId, user2.UserId, user1.UserId, user3.UserId, user1.UserId, user2.UserId} {
+			_, err := st.User(ctx, userId)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, 4, ust.userCalls())
+		assert.Equal(t, 2, st.(CacheStatsProvider).CacheStats().Entries)
+	})
+
+	t.Run("read your writes bypasses the cache", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1)}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		_, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+
+		_, err = st.User(WithReadYourWrites(ctx), user1.UserId)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, ust.userCalls())
+	})
+
+	t.Run("concurrent misses are collapsed", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1), release: make(chan struct{})}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				usr, err := st.User(ctx, user1.UserId)
+				assert.NoError(t, err)
+				assert.Equal(t, user1.UserId, usr.UserId)
+			}()
+		}
+
+		require.Eventually(t, func() bool {
+			return st.(CacheStatsProvider).CacheStats().Misses == 10
+		}, time.Second, time.Millisecond)
+		close(ust.release)
+		wg.Wait()
+
+		assert.Equal(t, 1, ust.userCalls())
+	})
+
+	t.Run("misses are loaded from the primary", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1)}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		_, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+
+		assert.True(t, ust.readYourWrites)
+	})
+
+	t.Run("canceled caller does not fail waiting callers", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1), release: make(chan struct{})}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		canceledCtx, cancel := context.WithCancel(ctx)
+
+		canceled := make(chan error)
+		go func() {
+			_, err := st.User(canceledCtx, user1.UserId)
+			canceled <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			return ust.userCalls() == 1
+		}, time.Second, time.Millisecond)
+
+		waiting := make(chan error)
+		go func() {
+			_, err := st.User(ctx, user1.UserId)
+			waiting <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			return st.(CacheStatsProvider).CacheStats().Misses == 2
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-canceled)
+
+		close(ust.release)
+		assert.NoError(t, <-waiting)
+		assert.Equal(t, 1, ust.userCalls())
+		assert.Equal(t, 1, st.(CacheStatsProvider).CacheStats().Entries)
+	})
+
+	t.Run("load timeout", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1), release: make(chan struct{})}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Millisecond)
+
+		_, err := st.User(ctx, user1.UserId)
+		assert.Equal(t, StatementTimeoutErr, err)
+		assert.Equal(t, 0, st.(CacheStatsProvider).CacheStats().Entries)
+	})
+}
+
+func TestCachedStorage_invalidation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("writes invalidate entries", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1)}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		_, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+
+		_, err = st.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Age: intPtr(43)})
+		require.NoError(t, err)
+
+		usr, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, 43, usr.Age)
+
+		require.NoError(t, st.DeleteUser(ctx, user1.UserId))
+
+		_, err = st.User(ctx, user1.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+
+		assert.Equal(t, 3, ust.userCalls())
+	})
+
+	t.Run("create invalidates entries", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t)}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		_, err := st.User(ctx, user1.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+
+		_, err = st.CreateUser(ctx, user1)
+		require.NoError(t, err)
+
+		usr, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, user1, untimed(usr))
+	})
+
+	t.Run("in flight lookup is not cached after invalidation", func(t *testing.T) {
+		ust := &countingStorage{UserStorage: newFilledMemoryStorage(t, user1), release: make(chan struct{})}
+		st := NewCachedUserStorage(ust, 10, time.Minute, time.Second)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			_, err := st.User(ctx, user1.UserId)
+			assert.NoError(t, err)
+		}()
+
+		require.Eventually(t, func() bool {
+			return ust.userCalls() == 1
+		}, time.Second, time.Millisecond)
+
+		st.(*cachedStorage).invalidate(user1.UserId)
+		close(ust.release)
+		<-done
+
+		assert.Equal(t, 0, st.(CacheStatsProvider).CacheStats().Entries)
+	})
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"app/internal/configuration"
+	"github.com/google/uuid"
+)
+
+var InvalidCursorErr = errors.New("invalid cursor")
+
+type usersCursor struct {
+	Sort   string `json:"sort"`
+	UserId string `json:"user_id"`
+	Name   string `json:"name"`
+	Age    int    `json:"age"`
+}
+
+func encodeCursor(usr User, sortKeys []configuration.UsersSort) string {
+	content, _ := json.Marshal(usersCursor{
+		Sort:   sortSignature(sortKeys),
+		UserId: usr.UserId,
+		Name:   usr.Name,
+		Age:    usr.Age,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeCursor(s string, sortKeys []configuration.UsersSort) (usersCursor, error) {
+	if s == "" {
+		return usersCursor{}, nil
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return usersCursor{}, InvalidCursorErr
+	}
+
+	var c usersCursor
+	if err := json.Unmarshal(content, &c); err != nil {
+		return usersCursor{}, InvalidCursorErr
+	}
+
+	if _, err := uuid.Parse(c.UserId); err != nil {
+		return usersCursor{}, InvalidCursorErr
+	}
+
+	if c.Sort != sortSignature(sortKeys) {
+		return usersCursor{}, InvalidCursorErr
+	}
+
+	return c, nil
+}
+
+func (c usersCursor) value(field string) interface{} {
+	switch field {
+	case configuration.SortFieldName:
+		return c.Name
+	case configuration.SortFieldAge:
+		return c.Age
+	default:
+		return c.UserId
+	}
+}
+
+func (c usersCursor) user() User {
+	return User{UserId: c.UserId, Name: c.Name, Age: c.Age}
+}
+
+func sortSignature(sortKeys []configuration.UsersSort) string {
+	parts := make([]string, 0, len(sortKeys))
+	for _, srt := range sortKeys {
+		parts = append(parts, srt.Field+":"+srt.Direction)
+	}
+
+	return strings.Join(parts, ",")
+}
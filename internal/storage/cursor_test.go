@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"app/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_decodeCursor(t *testing.T) {
+	ageSortKeys := []configuration.UsersSort{
+		{Field: configuration.SortFieldAge, Direction: configuration.SortDirectionDesc},
+		{Field: configuration.SortFieldUserId, Direction: configuration.SortDirectionAsc},
+	}
+
+	type args struct {
+		cursor   string
+		sortKeys []configuration.UsersSort
+	}
+	type exp struct {
+		cursor usersCursor
+		err    error
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "ok",
+			args: args{
+				cursor:   encodeCursor(user1, ageSortKeys),
+				sortKeys: ageSortKeys,
+			},
+			exp: exp{
+				cursor: usersCursor{Sort: "age:desc,user_id:asc", UserId: user1.UserId, Name: user1.Name, Age: user1.Age},
+				err:    nil,
+			},
+		},
+		{
+			name: "ok empty",
+			args: args{
+				cursor:   "",
+				sortKeys: defaultSortKeys,
+			},
+			exp: exp{
+				cursor: usersCursor{},
+				err:    nil,
+			},
+		},
+		{
+			name: "invalid encoding",
+			args: args{
+				cursor:   "!!!",
+				sortKeys: defaultSortKeys,
+			},
+			exp: exp{
+				cursor: usersCursor{},
+				err:    InvalidCursorErr,
+			},
+		},
+		{
+			name: "invalid content",
+			args: args{
+				cursor:   base64.RawURLEncoding.EncodeToString([]byte("{")),
+				sortKeys: defaultSortKeys,
+			},
+			exp: exp{
+				cursor: usersCursor{},
+				err:    InvalidCursorErr,
+			},
+		},
+		{
+			name: "invalid user id",
+			args: args{
+				cursor:   base64.RawURLEncoding.EncodeToString([]byte(`{"sort":"user_id:asc","user_id":"u-1"}`)),
+				sortKeys: defaultSortKeys,
+			},
+			exp: exp{
+				cursor: usersCursor{},
+				err:    InvalidCursorErr,
+			},
+		},
+		{
+			name: "sort mismatch",
+			args: args{
+				cursor:   encodeCursor(user1, ageSortKeys),
+				sortKeys: defaultSortKeys,
+			},
+			exp: exp{
+				cursor: usersCursor{},
+				err:    InvalidCursorErr,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := decodeCursor(tc.args.cursor, tc.args.sortKeys)
+
+			assert.Equal(t, tc.exp.err, err)
+			assert.Equal(t, tc.exp.cursor, c)
+		})
+	}
+}
+
+func TestUsersCursor_value(t *testing.T) {
+	c := usersCursor{UserId: user1.UserId, Name: user1.Name, Age: user1.Age}
+
+	assert.Equal(t, user1.UserId, c.value(configuration.SortFieldUserId))
+	assert.Equal(t, user1.Name, c.value(configuration.SortFieldName))
+	assert.Equal(t, user1.Age, c.value(configuration.SortFieldAge))
+}
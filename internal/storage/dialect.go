@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+type dialect struct {
+	selectUsersSQL string
+	selectUserSQL  string
+	insertUserSQL  string
+	updateUserSQL  string
+	deleteUserSQL  string
+	restoreUserSQL string
+	purgeUsersSQL  string
+
+	insertUserIfAbsentSQL  string
+	upsertUserSQL          string
+	selectUserForUpdateSQL string
+	selectUsersDeletedSQL  string
+	insertUserHistorySQL   string
+	selectUserHistorySQL   string
+	searchUsersSQL         string
+
+	selectUsersSummarySQL      string
+	selectUsersAgeHistogramSQL string
+	selectUsersCreatedSQL      string
+
+	insertUserEventSQL  string
+	lockUserOutboxSQL   string
+	unlockUserOutboxSQL string
+	selectUserEventsSQL string
+	deleteUserEventSQL  string
+	failUserEventSQL    string
+
+	placeholderPrefix string
+	likeOperator      string
+	classifyErr       func(err error) error
+}
+
+var postgresDialect = &dialect{
+	selectUsersSQL: selectUsersSQL,
+	selectUserSQL:  selectUserSQL,
+	insertUserSQL:  insertUserSQL,
+	updateUserSQL:  updateUserSQL,
+	deleteUserSQL:  deleteUserSQL,
+	restoreUserSQL: restoreUserSQL,
+	purgeUsersSQL:  purgeUsersSQL,
+
+	insertUserIfAbsentSQL:  insertUserIfAbsentSQL,
+	upsertUserSQL:          upsertUserSQL,
+	selectUserForUpdateSQL: selectUserForUpdateSQL,
+	selectUsersDeletedSQL:  selectUsersDeletedSQL,
+	insertUserHistorySQL:   insertUserHistorySQL,
+	selectUserHistorySQL:   selectUserHistorySQL,
+	searchUsersSQL:         searchUsersSQL,
+
+	selectUsersSummarySQL:      selectUsersSummarySQL,
+	selectUsersAgeHistogramSQL: selectUsersAgeHistogramSQL,
+	selectUsersCreatedSQL:      selectUsersCreatedSQL,
+
+	insertUserEventSQL:  insertUserEventSQL,
+	lockUserOutboxSQL:   lockUserOutboxSQL,
+	unlockUserOutboxSQL: unlockUserOutboxSQL,
+	selectUserEventsSQL: selectUserEventsSQL,
+	deleteUserEventSQL:  deleteUserEventSQL,
+	failUserEventSQL:    failUserEventSQL,
+
+	placeholderPrefix: "$",
+	likeOperator:      "ILIKE",
+	classifyErr:       classifyPostgresErr,
+}
+
+func (d *dialect) placeholder(n int) string {
+	return fmt.Sprintf("%s%d", d.placeholderPrefix, n)
+}
+
+func (d *dialect) like(column string, placeholder string) string {
+	return fmt.Sprintf(`%s %s %s ESCAPE '\'`, column, d.likeOperator, placeholder)
+}
+
+func (d *dialect) selectUsersBaseSQL() string {
+	return strings.TrimSpace(d.selectUsersSQL)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+var (
+	UniqueViolationErr      = errors.New("unique constraint violated")
+	CheckViolationErr       = errors.New("check constraint violated")
+	SerializationFailureErr = errors.New("serialization failure")
+	DeadlockErr             = errors.New("deadlock detected")
+	ConnectionLostErr       = errors.New("database connection lost")
+)
+
+const (
+	pqUniqueViolation      = "23505"
+	pqCheckViolation       = "23514"
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+	pqAdminShutdown        = "57P01"
+	pqCrashShutdown        = "57P02"
+	pqCannotConnectNow     = "57P03"
+
+	pqConnectionExceptionClass = "08"
+)
+
+type classifiedErr struct {
+	kind  error
+	cause error
+}
+
+func (e *classifiedErr) Error() string {
+	return e.kind.Error() + ": " + e.cause.Error()
+}
+
+func (e *classifiedErr) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *classifiedErr) Unwrap() error {
+	return e.cause
+}
+
+func classify(kind error, cause error) error {
+	return &classifiedErr{kind: kind, cause: cause}
+}
+
+type noRetryErr struct {
+	cause error
+}
+
+func (e *noRetryErr) Error() string {
+	return e.cause.Error()
+}
+
+func (e *noRetryErr) Unwrap() error {
+	return e.cause
+}
+
+func noRetry(err error) error {
+	return &noRetryErr{cause: err}
+}
+
+func classifyPostgresErr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == pqUniqueViolation:
+			return classify(UniqueViolationErr, err)
+		case pqErr.Code == pqCheckViolation:
+			return classify(CheckViolationErr, err)
+		case pqErr.Code == pqSerializationFailure:
+			return classify(SerializationFailureErr, err)
+		case pqErr.Code == pqDeadlockDetected:
+			return classify(DeadlockErr, err)
+		case pqErr.Code.Class() == pqConnectionExceptionClass,
+			pqErr.Code == pqAdminShutdown,
+			pqErr.Code == pqCrashShutdown,
+			pqErr.Code == pqCannotConnectNow:
+			return classify(ConnectionLostErr, err)
+		}
+
+		return err
+	}
+
+	return classifyConnectionErr(err)
+}
+
+func classifyConnectionErr(err error) error {
+	var netErr *net.OpError
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return classify(ConnectionLostErr, err)
+	}
+
+	return err
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_classifyPostgresErr(t *testing.T) {
+	type args struct {
+		err error
+	}
+	type exp struct {
+		kind error
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "unique violation",
+			args: args{err: &pq.Error{Code: "23505"}},
+			exp:  exp{kind: UniqueViolationErr},
+		},
+		{
+			name: "check violation",
+			args: args{err: &pq.Error{Code: "23514"}},
+			exp:  exp{kind: CheckViolationErr},
+		},
+		{
+			name: "serialization failure",
+			args: args{err: &pq.Error{Code: "40001"}},
+			exp:  exp{kind: SerializationFailureErr},
+		},
+		{
+			name: "deadlock",
+			args: args{err: &pq.Error{Code: "40P01"}},
+			exp:  exp{kind: DeadlockErr},
+		},
+		{
+			name: "connection exception",
+			args: args{err: &pq.Error{Code: "08006"}},
+			exp:  exp{kind: ConnectionLostErr},
+		},
+		{
+			name: "admin shutdown",
+			args: args{err: &pq.Error{Code: "57P01"}},
+			exp:  exp{kind: ConnectionLostErr},
+		},
+		{
+			name: "bad connection",
+			args: args{err: driver.ErrBadConn},
+			exp:  exp{kind: ConnectionLostErr},
+		},
+		{
+			name: "network error",
+			args: args{err: &net.OpError{Op: "read", Err: databaseError}},
+			exp:  exp{kind: ConnectionLostErr},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyPostgresErr(tc.args.err)
+
+			assert.ErrorIs(t, err, tc.exp.kind)
+			assert.ErrorIs(t, err, tc.args.err, "cause must stay reachable")
+		})
+	}
+
+	t.Run("unclassified errors", func(t *testing.T) {
+		notNullErr := &pq.Error{Code: "23502"}
+
+		assert.Equal(t, notNullErr, classifyPostgresErr(notNullErr))
+		assert.Equal(t, sql.ErrNoRows, classifyPostgresErr(sql.ErrNoRows))
+		assert.Equal(t, databaseError, classifyPostgresErr(databaseError))
+	})
+}
+
+func Test_classifiedErr(t *testing.T) {
+	cause := &pq.Error{Code: "40001", Message: "could not serialize access"}
+	err := classify(SerializationFailureErr, cause)
+
+	assert.Equal(t, "serialization failure: pq: could not serialize access", err.Error())
+
+	var pqErr *pq.Error
+	assert.ErrorAs(t, err, &pqErr)
+	assert.Equal(t, cause, pqErr)
+	assert.NotErrorIs(t, err, DeadlockErr)
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	OperationCreate  = "create"
+	OperationUpdate  = "update"
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+)
+
+const AnonymousPrincipal = "anonymous"
+
+type UserChange struct {
+	HistoryId int64     `json:"history_id"`
+	UserId    string    `json:"user_id"`
+	Operation string    `json:"operation"`
+	Before    *User     `json:"before"`
+	After     *User     `json:"after"`
+	Principal string    `json:"principal"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type UserHistoryResponse struct {
+	History    []UserChange `json:"history"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func Principal(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok && principal != "" {
+		return principal
+	}
+
+	return AnonymousPrincipal
+}
+
+func (st *storage) UserHistory(ctx context.Context, userId string, limit int, cursor string) (UserHistoryResponse, error) {
+	before, err := decodeHistoryCursor(cursor)
+	if err != nil {
+		return UserHistoryResponse{}, err
+	}
+
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	rows, err := st.db.QueryContext(stmtCtx, st.dialect.selectUserHistorySQL, userId, before, limit+1)
+	if err != nil {
+		return UserHistoryResponse{}, st.statementErr(ctx, stmtCtx, err)
+	}
+	defer rows.Close()
+
+	history := make([]UserChange, 0)
+
+	for rows.Next() {
+		change, err := scanUserChange(rows)
+		if err != nil {
+			return UserHistoryResponse{}, st.statementErr(ctx, stmtCtx, err)
+		}
+
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return UserHistoryResponse{}, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return pageUserHistory(history, limit), nil
+}
+
+func (st *storage) recordChange(ctx context.Context, tx *sql.Tx, operation string, before *User, after *User) error {
+	userId := after.UserId
+	if before != nil {
+		userId = before.UserId
+	}
+
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	if _, err := tx.ExecContext(
+		stmtCtx,
+		st.dialect.insertUserHistorySQL,
+		userId,
+		operation,
+		userSnapshot(before),
+		userSnapshot(after),
+		Principal(ctx),
+	); err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return st.recordEvent(ctx, tx, operation, before, after)
+}
+
+func userSnapshot(usr *User) sql.NullString {
+	if usr == nil {
+		return sql.NullString{}
+	}
+
+	content, _ := json.Marshal(usr)
+
+	return sql.NullString{String: string(content), Valid: true}
+}
+
+func scanUserChange(s scanner) (UserChange, error) {
+	var (
+		change        UserChange
+		before, after sql.NullString
+	)
+
+	if err := s.Scan(
+		&change.HistoryId,
+		&change.UserId,
+		&change.Operation,
+		&before,
+		&after,
+		&change.Principal,
+		&change.ChangedAt,
+	); err != nil {
+		return UserChange{}, err
+	}
+
+	var err error
+	if change.Before, err = parseUserSnapshot(before); err != nil {
+		return UserChange{}, err
+	}
+
+	if change.After, err = parseUserSnapshot(after); err != nil {
+		return UserChange{}, err
+	}
+
+	return change, nil
+}
+
+func parseUserSnapshot(snapshot sql.NullString) (*User, error) {
+	if !snapshot.Valid {
+		return nil, nil
+	}
+
+	var usr User
+	if err := json.Unmarshal([]byte(snapshot.String), &usr); err != nil {
+		return nil, err
+	}
+
+	return &usr, nil
+}
+
+func pageUserHistory(history []UserChange, limit int) UserHistoryResponse {
+	var nextCursor string
+	if len(history) > limit {
+		history = history[:limit]
+		nextCursor = encodeHistoryCursor(history[limit-1].HistoryId)
+	}
+
+	return UserHistoryResponse{History: history, NextCursor: nextCursor}
+}
+
+func encodeHistoryCursor(historyId int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(historyId, 10)))
+}
+
+func decodeHistoryCursor(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, InvalidCursorErr
+	}
+
+	historyId, err := strconv.ParseInt(string(content), 10, 64)
+	if err != nil || historyId < 1 {
+		return 0, InvalidCursorErr
+	}
+
+	return historyId, nil
+}
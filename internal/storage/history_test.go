@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var historyColumns = []string{"history_id", "user_id", "operation", "before", "after", "principal", "changed_at"}
+
+func TestPrincipal(t *testing.T) {
+	assert.Equal(t, AnonymousPrincipal, Principal(context.Background()))
+	assert.Equal(t, AnonymousPrincipal, Principal(WithPrincipal(context.Background(), "")))
+	assert.Equal(t, "support", Principal(WithPrincipal(context.Background(), "support")))
+}
+
+func TestStorage_UserHistory(t *testing.T) {
+	changedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated := User{UserId: user1.UserId, Name: user1.Name, Age: 43, Version: 2}
+
+	change1 := UserChange{HistoryId: 1, UserId: user1.UserId, Operation: OperationCreate, After: &user1, Principal: "support", ChangedAt: changedAt}
+	change2 := UserChange{HistoryId: 2, UserId: user1.UserId, Operation: OperationUpdate, Before: &user1, After: &updated, Principal: "support", ChangedAt: changedAt}
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(historyColumns).
+			AddRow(2, user1.UserId, OperationUpdate, userSnapshot(&user1).String, userSnapshot(&updated).String, "support", changedAt).
+			AddRow(1, user1.UserId, OperationCreate, nil, userSnapshot(&user1).String, "support", changedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserHistorySQL)).WithArgs(user1.UserId, 0, 3).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		history, err := s.UserHistory(context.Background(), user1.UserId, 2, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, UserHistoryResponse{History: []UserChange{change2, change1}}, history)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok next page", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(historyColumns).
+			AddRow(2, user1.UserId, OperationUpdate, userSnapshot(&user1).String, userSnapshot(&updated).String, "support", changedAt).
+			AddRow(1, user1.UserId, OperationCreate, nil, userSnapshot(&user1).String, "support", changedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserHistorySQL)).WithArgs(user1.UserId, 3, 2).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		history, err := s.UserHistory(context.Background(), user1.UserId, 1, encodeHistoryCursor(3))
+
+		assert.NoError(t, err)
+		assert.Equal(t, UserHistoryResponse{History: []UserChange{change2}, NextCursor: encodeHistoryCursor(2)}, history)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UserHistory(context.Background(), user1.UserId, 1, "invalid")
+
+		assert.Equal(t, InvalidCursorErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid snapshot error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(historyColumns).AddRow(1, user1.UserId, OperationCreate, nil, "{", "support", changedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserHistorySQL)).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UserHistory(context.Background(), user1.UserId, 1, "")
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserHistorySQL)).WillReturnError(databaseError)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UserHistory(context.Background(), user1.UserId, 1, "")
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_decodeHistoryCursor(t *testing.T) {
+	historyId, err := decodeHistoryCursor(encodeHistoryCursor(42))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), historyId)
+
+	historyId, err = decodeHistoryCursor("")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), historyId)
+
+	for _, cursor := range []string{"!", "YWJj", encodeHistoryCursor(0), encodeHistoryCursor(-1)} {
+		_, err := decodeHistoryCursor(cursor)
+		assert.Equal(t, InvalidCursorErr, err, cursor)
+	}
+}
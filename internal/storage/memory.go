@@ -0,0 +1,567 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"app/internal/configuration"
+)
+
+type memoryStorage struct {
+	mu             sync.RWMutex
+	relayMu        sync.Mutex
+	users          map[string]User
+	history        []UserChange
+	outbox         []Event
+	eventsDisabled bool
+}
+
+func NewMemoryUserStorage() UserStorage {
+	return &memoryStorage{
+		users: make(map[string]User),
+	}
+}
+
+func (st *memoryStorage) Users(ctx context.Context, filter configuration.UsersFilter, limit int, cursor string) (UsersResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return UsersResponse{}, err
+	}
+
+	sortKeys := filter.SortKeys()
+
+	after, err := decodeCursor(cursor, sortKeys)
+	if err != nil {
+		return UsersResponse{}, err
+	}
+
+	st.mu.RLock()
+	users := make([]User, 0)
+	for _, usr := range st.users {
+		if !matchUser(usr, filter) {
+			continue
+		}
+
+		if after.UserId != "" && compareUsers(usr, after.user(), sortKeys) <= 0 {
+			continue
+		}
+
+		users = append(users, usr)
+	}
+	st.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return compareUsers(users[i], users[j], sortKeys) < 0
+	})
+
+	var nextCursor string
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = encodeCursor(users[limit-1], sortKeys)
+	}
+
+	return UsersResponse{Users: users, NextCursor: nextCursor}, nil
+}
+
+func (st *memoryStorage) ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error {
+	sortKeys := filter.SortKeys()
+
+	st.mu.RLock()
+	users := make([]User, 0)
+	for _, usr := range st.users {
+		if matchUser(usr, filter) {
+			users = append(users, usr)
+		}
+	}
+	st.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return compareUsers(users[i], users[j], sortKeys) < 0
+	})
+
+	for _, usr := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(usr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (st *memoryStorage) User(ctx context.Context, userId string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	usr, ok := st.users[userId]
+	if !ok || usr.DeletedAt != nil {
+		return User{}, UserNotFoundErr
+	}
+
+	return usr, nil
+}
+
+func (st *memoryStorage) CreateUser(ctx context.Context, usr User) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.users[usr.UserId]; ok {
+		return User{}, UserAlreadyExistsErr
+	}
+
+	usr.Version = 1
+	usr.CreatedAt = time.Now()
+	usr.UpdatedAt = usr.CreatedAt
+	st.users[usr.UserId] = usr
+	st.recordChange(ctx, OperationCreate, nil, &usr)
+
+	return usr, nil
+}
+
+func (st *memoryStorage) CreateUsers(ctx context.Context, users []User, atomic bool) ([]error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	errs := make([]error, len(users))
+	conflict := false
+	for i, usr := range users {
+		if _, ok := st.users[usr.UserId]; ok {
+			errs[i] = UserAlreadyExistsErr
+			conflict = true
+		}
+	}
+
+	if atomic && conflict {
+		return errs, nil
+	}
+
+	for i, usr := range users {
+		if _, ok := st.users[usr.UserId]; ok {
+			errs[i] = UserAlreadyExistsErr
+			continue
+		}
+
+		created := usr
+		created.Version = 1
+		created.CreatedAt = time.Now()
+		created.UpdatedAt = created.CreatedAt
+		st.users[created.UserId] = created
+		st.recordChange(ctx, OperationCreate, nil, &created)
+	}
+
+	return errs, nil
+}
+
+func (st *memoryStorage) UpdateUser(ctx context.Context, patch UserPatch) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	current, ok := st.users[patch.UserId]
+	if !ok || current.DeletedAt != nil {
+		return User{}, UserNotFoundErr
+	}
+
+	if patch.Version != 0 && patch.Version != current.Version {
+		return User{}, UserVersionMismatchErr
+	}
+
+	usr := current
+	if patch.Name != nil {
+		usr.Name = *patch.Name
+	}
+	if patch.Age != nil {
+		usr.Age = *patch.Age
+	}
+	usr.Version = current.Version + 1
+	usr.UpdatedAt = time.Now()
+	st.users[usr.UserId] = usr
+	st.recordChange(ctx, OperationUpdate, &current, &usr)
+
+	return usr, nil
+}
+
+func (st *memoryStorage) PutUser(ctx context.Context, usr User) (User, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, false, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.putUser(ctx, usr)
+}
+
+func (st *memoryStorage) ImportUsers(ctx context.Context, users []User, dryRun bool) ([]ImportResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	results := make([]ImportResult, len(users))
+	for i, usr := range users {
+		if dryRun {
+			current, ok := st.users[usr.UserId]
+			if ok && current.DeletedAt != nil {
+				results[i].Err = UserDeletedErr
+			}
+
+			results[i].Created = !ok
+			continue
+		}
+
+		_, created, err := st.putUser(ctx, usr)
+		results[i] = ImportResult{Created: created, Err: err}
+	}
+
+	return results, nil
+}
+
+func (st *memoryStorage) putUser(ctx context.Context, usr User) (User, bool, error) {
+	current, ok := st.users[usr.UserId]
+	if !ok {
+		usr.Version = 1
+		usr.CreatedAt = time.Now()
+		usr.UpdatedAt = usr.CreatedAt
+		st.users[usr.UserId] = usr
+		st.recordChange(ctx, OperationCreate, nil, &usr)
+
+		return usr, true, nil
+	}
+
+	if current.DeletedAt != nil {
+		return User{}, false, UserDeletedErr
+	}
+
+	usr.Version = current.Version + 1
+	usr.CreatedAt = current.CreatedAt
+	usr.UpdatedAt = time.Now()
+	st.users[usr.UserId] = usr
+	st.recordChange(ctx, OperationUpdate, &current, &usr)
+
+	return usr, false, nil
+}
+
+func (st *memoryStorage) DeleteUser(ctx context.Context, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	current, ok := st.users[userId]
+	if !ok || current.DeletedAt != nil {
+		return UserNotFoundErr
+	}
+
+	usr := current
+	deletedAt := time.Now()
+	usr.DeletedAt = &deletedAt
+	usr.UpdatedAt = deletedAt
+	st.users[userId] = usr
+	st.recordChange(ctx, OperationDelete, &current, &usr)
+
+	return nil
+}
+
+func (st *memoryStorage) RestoreUser(ctx context.Context, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	current, ok := st.users[userId]
+	if !ok || current.DeletedAt == nil {
+		return UserNotFoundErr
+	}
+
+	usr := current
+	usr.DeletedAt = nil
+	usr.UpdatedAt = time.Now()
+	st.users[userId] = usr
+	st.recordChange(ctx, OperationRestore, &current, &usr)
+
+	return nil
+}
+
+func (st *memoryStorage) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var purged int64
+	for userId, usr := range st.users {
+		if usr.DeletedAt != nil && usr.DeletedAt.Before(deletedBefore) {
+			delete(st.users, userId)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (st *memoryStorage) SearchUsers(ctx context.Context, query string, limit int, cursor string) (SearchUsersResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return SearchUsersResponse{}, err
+	}
+
+	after, err := decodeSearchCursor(cursor, query)
+	if err != nil {
+		return SearchUsersResponse{}, err
+	}
+
+	st.mu.RLock()
+	users := make([]User, 0)
+	for _, usr := range st.users {
+		if usr.DeletedAt == nil {
+			users = append(users, usr)
+		}
+	}
+	st.mu.RUnlock()
+
+	return searchUsersPage(rankUsers(users, query, after, limit+1), query, limit), nil
+}
+
+func (st *memoryStorage) UsersStats(ctx context.Context, ageBuckets []int, period string) (UsersStats, error) {
+	if err := ctx.Err(); err != nil {
+		return UsersStats{}, err
+	}
+
+	stats := UsersStats{
+		Age:     AgeStats{Histogram: newAgeHistogram(ageBuckets)},
+		Created: make([]PeriodCount, 0),
+	}
+
+	var (
+		minAge, maxAge, sumAge int
+		created                = make(map[time.Time]int64)
+	)
+
+	st.mu.RLock()
+	for _, usr := range st.users {
+		if usr.DeletedAt != nil {
+			continue
+		}
+
+		if stats.Total == 0 || usr.Age < minAge {
+			minAge = usr.Age
+		}
+		if stats.Total == 0 || usr.Age > maxAge {
+			maxAge = usr.Age
+		}
+
+		stats.Total++
+		sumAge += usr.Age
+		stats.Age.Histogram[ageBucket(usr.Age, ageBuckets)].Count++
+		created[truncatePeriod(usr.CreatedAt, period)]++
+	}
+	st.mu.RUnlock()
+
+	if stats.Total > 0 {
+		meanAge := float64(sumAge) / float64(stats.Total)
+		stats.Age.Min = &minAge
+		stats.Age.Max = &maxAge
+		stats.Age.Mean = &meanAge
+	}
+
+	for periodStart, count := range created {
+		stats.Created = append(stats.Created, PeriodCount{Period: periodStart, Count: count})
+	}
+
+	sort.Slice(stats.Created, func(i, j int) bool {
+		return stats.Created[i].Period.Before(stats.Created[j].Period)
+	})
+
+	return stats, nil
+}
+
+func (st *memoryStorage) UserHistory(ctx context.Context, userId string, limit int, cursor string) (UserHistoryResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return UserHistoryResponse{}, err
+	}
+
+	before, err := decodeHistoryCursor(cursor)
+	if err != nil {
+		return UserHistoryResponse{}, err
+	}
+
+	st.mu.RLock()
+	history := make([]UserChange, 0)
+	for i := len(st.history) - 1; i >= 0 && len(history) <= limit; i-- {
+		change := st.history[i]
+		if change.UserId != userId || (before != 0 && change.HistoryId >= before) {
+			continue
+		}
+
+		history = append(history, change)
+	}
+	st.mu.RUnlock()
+
+	return pageUserHistory(history, limit), nil
+}
+
+func (st *memoryStorage) recordChange(ctx context.Context, operation string, before *User, after *User) {
+	afterUsr := *after
+	change := UserChange{
+		HistoryId: int64(len(st.history) + 1),
+		UserId:    after.UserId,
+		Operation: operation,
+		After:     &afterUsr,
+		Principal: Principal(ctx),
+		ChangedAt: time.Now(),
+	}
+
+	if before != nil {
+		beforeUsr := *before
+		change.Before = &beforeUsr
+	}
+
+	st.history = append(st.history, change)
+
+	if st.eventsDisabled {
+		return
+	}
+
+	if evt, err := newEvent(ctx, operation, change.Before, change.After); err == nil {
+		st.outbox = append(st.outbox, evt)
+	}
+}
+
+func (st *memoryStorage) DisableEvents() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.eventsDisabled = true
+}
+
+func (st *memoryStorage) RelayEvents(ctx context.Context, limit int, maxAttempts int, publish func(evt Event) error) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	st.relayMu.Lock()
+	defer st.relayMu.Unlock()
+
+	st.mu.RLock()
+	events := make([]Event, 0, limit)
+	for i := 0; i < len(st.outbox) && len(events) < limit; i++ {
+		if st.outbox[i].Attempts < maxAttempts {
+			events = append(events, st.outbox[i])
+		}
+	}
+	st.mu.RUnlock()
+
+	published := 0
+	for _, evt := range events {
+		if err := publish(evt); err != nil {
+			st.mu.Lock()
+			if i := st.outboxIndex(evt.EventId); i >= 0 {
+				st.outbox[i].Attempts++
+			}
+			st.mu.Unlock()
+
+			return published, err
+		}
+
+		st.mu.Lock()
+		if i := st.outboxIndex(evt.EventId); i >= 0 {
+			st.outbox = append(st.outbox[:i], st.outbox[i+1:]...)
+		}
+		st.mu.Unlock()
+
+		published++
+	}
+
+	return published, nil
+}
+
+func (st *memoryStorage) outboxIndex(eventId string) int {
+	for i, evt := range st.outbox {
+		if evt.EventId == eventId {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func matchUser(usr User, filter configuration.UsersFilter) bool {
+	if filter.Deleted != (usr.DeletedAt != nil) {
+		return false
+	}
+
+	name := strings.ToLower(usr.Name)
+
+	if filter.NamePrefix != "" && !strings.HasPrefix(name, strings.ToLower(filter.NamePrefix)) {
+		return false
+	}
+
+	if filter.NameContains != "" && !strings.Contains(name, strings.ToLower(filter.NameContains)) {
+		return false
+	}
+
+	if filter.AgeMin > 0 && usr.Age < filter.AgeMin {
+		return false
+	}
+
+	if filter.AgeMax > 0 && usr.Age > filter.AgeMax {
+		return false
+	}
+
+	return true
+}
+
+func compareUsers(a User, b User, sortKeys []configuration.UsersSort) int {
+	for _, srt := range sortKeys {
+		var c int
+
+		switch srt.Field {
+		case configuration.SortFieldName:
+			c = strings.Compare(a.Name, b.Name)
+		case configuration.SortFieldAge:
+			c = a.Age - b.Age
+		default:
+			c = strings.Compare(a.UserId, b.UserId)
+		}
+
+		if c == 0 {
+			continue
+		}
+
+		if srt.Desc() {
+			return -c
+		}
+
+		return c
+	}
+
+	return 0
+}
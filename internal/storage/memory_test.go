@@ -0,0 +1,597 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"app/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var user3 = User{
+	UserId:  "0f2e5c1a-3b9d-4c7e-8a61-2d5f9b0e4c33",
+	Name:    "Jane Roe",
+	Age:     42,
+	Version: 1,
+}
+
+func newFilledMemoryStorage(t *testing.T, users ...User) UserStorage {
+	s := NewMemoryUserStorage()
+
+	for _, usr := range users {
+		_, err := s.CreateUser(context.Background(), usr)
+		require.NoError(t, err)
+	}
+
+	return s
+}
+
+func TestMemoryStorage_Users(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		s := newFilledMemoryStorage(t, user1, user2, user3)
+
+		users, err := s.Users(context.Background(), configuration.UsersFilter{}, 10, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, UsersResponse{Users: []User{user3, user2, user1}}, untimedResponse(users))
+	})
+
+	t.Run("ok empty", func(t *testing.T) {
+		s := NewMemoryUserStorage()
+
+		users, err := s.Users(context.Background(), configuration.UsersFilter{}, 10, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, UsersResponse{Users: []User{}}, users)
+	})
+
+	t.Run("ok pages", func(t *testing.T) {
+		s := newFilledMemoryStorage(t, user1, user2, user3)
+		filter := configuration.UsersFilter{
+			Sort: []configuration.UsersSort{
+				{Field: configuration.SortFieldAge, Direction: configuration.SortDirectionDesc},
+			},
+		}
+
+		page1, err := s.Users(context.Background(), filter, 2, "")
+		require.NoError(t, err)
+		assert.Equal(t, []User{user3, user1}, untimedUsers(page1.Users))
+		require.NotEmpty(t, page1.NextCursor)
+
+		page2, err := s.Users(context.Background(), filter, 2, page1.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, UsersResponse{Users: []User{user2}}, untimedResponse(page2))
+	})
+
+	t.Run("ok filter", func(t *testing.T) {
+		s := newFilledMemoryStorage(t, user1, user2, user3)
+
+		users, err := s.Users(context.Background(), configuration.UsersFilter{NamePrefix: "jo", AgeMin: 30}, 10, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []User{user1}, untimedUsers(users.Users))
+
+		users, err = s.Users(context.Background(), configuration.UsersFilter{NameContains: "ROE", AgeMax: 42}, 10, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []User{user3}, untimedUsers(users.Users))
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		s := NewMemoryUserStorage()
+
+		_, err := s.Users(context.Background(), configuration.UsersFilter{}, 10, "xxx")
+
+		assert.Equal(t, InvalidCursorErr, err)
+	})
+
+	t.Run("context canceled error", func(t *testing.T) {
+		s := NewMemoryUserStorage()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.Users(ctx, configuration.UsersFilter{}, 10, "")
+
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestMemoryStorage_ExportUsers(t *testing.T) {
+	st := NewMemoryUserStorage()
+	for _, usr := range []User{user1, user2} {
+		_, err := st.CreateUser(context.Background(), usr)
+		require.NoError(t, err)
+	}
+
+	var userIds []string
+	err := st.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+		userIds = append(userIds, usr.UserId)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{user2.UserId, user1.UserId}, userIds)
+
+	expErr := errors.New("broken pipe")
+	err = st.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+		return expErr
+	})
+
+	assert.Equal(t, expErr, err)
+}
+
+func TestMemoryStorage_User(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1)
+
+	t.Run("ok", func(t *testing.T) {
+		usr, err := s.User(context.Background(), user1.UserId)
+
+		assert.NoError(t, err)
+		assert.Equal(t, user1, untimed(usr))
+	})
+
+	t.Run("user not found error", func(t *testing.T) {
+		_, err := s.User(context.Background(), user2.UserId)
+
+		assert.Equal(t, UserNotFoundErr, err)
+	})
+}
+
+func TestMemoryStorage_CreateUser(t *testing.T) {
+	s := NewMemoryUserStorage()
+
+	t.Run("ok", func(t *testing.T) {
+		usr, err := s.CreateUser(context.Background(), user1)
+		assert.NoError(t, err)
+		assert.Equal(t, user1, untimed(usr))
+	})
+
+	t.Run("user already exists error", func(t *testing.T) {
+		_, err := s.CreateUser(context.Background(), user1)
+		assert.Equal(t, UserAlreadyExistsErr, err)
+	})
+}
+
+func TestMemoryStorage_CreateUsers(t *testing.T) {
+	t.Run("atomic", func(t *testing.T) {
+		s := newFilledMemoryStorage(t, user1)
+
+		errs, err := s.CreateUsers(context.Background(), []User{user1, user2}, true)
+		require.NoError(t, err)
+		assert.Equal(t, []error{UserAlreadyExistsErr, nil}, errs)
+
+		_, err = s.User(context.Background(), user2.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		s := newFilledMemoryStorage(t, user1)
+
+		errs, err := s.CreateUsers(context.Background(), []User{user1, user2}, false)
+		require.NoError(t, err)
+		assert.Equal(t, []error{UserAlreadyExistsErr, nil}, errs)
+
+		usr, err := s.User(context.Background(), user2.UserId)
+		assert.NoError(t, err)
+		assert.Equal(t, user2, untimed(usr))
+	})
+
+	t.Run("history and events of every created user", func(t *testing.T) {
+		s := NewMemoryUserStorage()
+		users := []User{user1, user2, user3}
+
+		errs, err := s.CreateUsers(context.Background(), users, true)
+		require.NoError(t, err)
+		assert.Equal(t, []error{nil, nil, nil}, errs)
+
+		for _, usr := range users {
+			history, err := s.UserHistory(context.Background(), usr.UserId, 10, "")
+			require.NoError(t, err)
+			require.Len(t, history.History, 1)
+			assert.Equal(t, usr.UserId, history.History[0].After.UserId)
+			assert.Equal(t, usr.Name, history.History[0].After.Name)
+		}
+
+		var events []Event
+		_, err = s.(EventOutbox).RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+			events = append(events, evt)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, events, len(users))
+
+		for i, usr := range users {
+			assert.Equal(t, usr.UserId, events[i].UserId)
+			assert.Equal(t, &usr, untimedPtr(events[i].After))
+		}
+	})
+}
+
+func TestMemoryStorage_UpdateUser(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1)
+
+	t.Run("ok", func(t *testing.T) {
+		updated, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Name: stringPtr("John Updated"), Age: intPtr(43)})
+		require.NoError(t, err)
+		assert.Equal(t, User{UserId: user1.UserId, Name: "John Updated", Age: 43, Version: 2}, untimed(updated))
+
+		usr, err := s.User(context.Background(), user1.UserId)
+		assert.NoError(t, err)
+		assert.Equal(t, updated, usr)
+	})
+
+	t.Run("ok expected version", func(t *testing.T) {
+		updated, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Name: stringPtr("John Doe"), Age: intPtr(44), Version: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, updated.Version)
+	})
+
+	t.Run("ok partial", func(t *testing.T) {
+		updated, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Name: stringPtr("John Partial")})
+		require.NoError(t, err)
+		assert.Equal(t, User{UserId: user1.UserId, Name: "John Partial", Age: 44, Version: 4}, untimed(updated))
+
+		updated, err = s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Age: intPtr(50)})
+		require.NoError(t, err)
+		assert.Equal(t, User{UserId: user1.UserId, Name: "John Partial", Age: 50, Version: 5}, untimed(updated))
+	})
+
+	t.Run("user version mismatch error", func(t *testing.T) {
+		_, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Name: stringPtr("John Doe"), Age: intPtr(45), Version: 2})
+		assert.Equal(t, UserVersionMismatchErr, err)
+	})
+
+	t.Run("user not found error", func(t *testing.T) {
+		_, err := s.UpdateUser(context.Background(), patchOf(user2))
+		assert.Equal(t, UserNotFoundErr, err)
+	})
+}
+
+func TestMemoryStorage_PutUser(t *testing.T) {
+	s := newFilledMemoryStorage(t, user2)
+
+	usr, created, err := s.PutUser(context.Background(), user1)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, user1, untimed(usr))
+
+	usr, created, err = s.PutUser(context.Background(), User{UserId: user1.UserId, Name: "John Replaced", Age: 50})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, User{UserId: user1.UserId, Name: "John Replaced", Age: 50, Version: 2}, untimed(usr))
+
+	require.NoError(t, s.DeleteUser(context.Background(), user2.UserId))
+	_, _, err = s.PutUser(context.Background(), user2)
+	assert.Equal(t, UserDeletedErr, err)
+}
+
+func TestMemoryStorage_ImportUsers(t *testing.T) {
+	st := NewMemoryUserStorage()
+	ctx := context.Background()
+
+	_, err := st.CreateUser(ctx, user1)
+	require.NoError(t, err)
+
+	users := []User{{UserId: user1.UserId, Name: "John Imported", Age: 43}, user2}
+	expResults := []ImportResult{{Created: false}, {Created: true}}
+
+	results, err := st.ImportUsers(ctx, users, true)
+	require.NoError(t, err)
+	assert.Equal(t, expResults, results)
+
+	_, err = st.User(ctx, user2.UserId)
+	assert.Equal(t, UserNotFoundErr, err)
+
+	results, err = st.ImportUsers(ctx, users, false)
+	require.NoError(t, err)
+	assert.Equal(t, expResults, results)
+
+	usr, err := st.User(ctx, user1.UserId)
+	require.NoError(t, err)
+	assert.Equal(t, "John Imported", usr.Name)
+	assert.Equal(t, 2, usr.Version)
+
+	require.NoError(t, st.DeleteUser(ctx, user2.UserId))
+
+	results, err = st.ImportUsers(ctx, []User{user2}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []ImportResult{{Err: UserDeletedErr}}, results)
+
+	results, err = st.ImportUsers(ctx, []User{user2}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []ImportResult{{Err: UserDeletedErr}}, results)
+}
+
+func TestMemoryStorage_DeleteUser(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1)
+
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, s.DeleteUser(context.Background(), user1.UserId))
+
+		_, err := s.User(context.Background(), user1.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+	})
+
+	t.Run("user not found error", func(t *testing.T) {
+		assert.Equal(t, UserNotFoundErr, s.DeleteUser(context.Background(), user1.UserId))
+	})
+
+	t.Run("deleted user is kept", func(t *testing.T) {
+		_, err := s.CreateUser(context.Background(), user1)
+		assert.Equal(t, UserAlreadyExistsErr, err)
+		_, err = s.UpdateUser(context.Background(), patchOf(user1))
+		assert.Equal(t, UserNotFoundErr, err)
+
+		deleted, err := s.Users(context.Background(), configuration.UsersFilter{Deleted: true}, 10, "")
+		require.NoError(t, err)
+		require.Len(t, deleted.Users, 1)
+		assert.NotNil(t, deleted.Users[0].DeletedAt)
+	})
+}
+
+func TestMemoryStorage_RestoreUser(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1, user2)
+	require.NoError(t, s.DeleteUser(context.Background(), user1.UserId))
+
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, s.RestoreUser(context.Background(), user1.UserId))
+
+		usr, err := s.User(context.Background(), user1.UserId)
+		assert.NoError(t, err)
+		assert.Equal(t, user1, untimed(usr))
+	})
+
+	t.Run("user not found error", func(t *testing.T) {
+		assert.Equal(t, UserNotFoundErr, s.RestoreUser(context.Background(), user2.UserId))
+		assert.Equal(t, UserNotFoundErr, s.RestoreUser(context.Background(), user3.UserId))
+	})
+}
+
+func TestMemoryStorage_PurgeUsers(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1, user2)
+	require.NoError(t, s.DeleteUser(context.Background(), user1.UserId))
+
+	purged, err := s.PurgeUsers(context.Background(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	purged, err = s.PurgeUsers(context.Background(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	assert.Equal(t, UserNotFoundErr, s.RestoreUser(context.Background(), user1.UserId))
+
+	usr, err := s.User(context.Background(), user2.UserId)
+	assert.NoError(t, err)
+	assert.Equal(t, user2, untimed(usr))
+}
+
+func TestMemoryStorage_UserHistory(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1, user2)
+	ctx := WithPrincipal(context.Background(), "support")
+
+	updated, err := s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Name: stringPtr(user1.Name), Age: intPtr(43)})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteUser(ctx, user1.UserId))
+
+	page1, err := s.UserHistory(context.Background(), user1.UserId, 2, "")
+	require.NoError(t, err)
+	require.Len(t, page1.History, 2)
+	assert.NotEmpty(t, page1.NextCursor)
+
+	assert.Equal(t, OperationDelete, page1.History[0].Operation)
+	assert.Equal(t, "support", page1.History[0].Principal)
+	assert.Equal(t, &updated, page1.History[0].Before)
+	assert.NotNil(t, page1.History[0].After.DeletedAt)
+
+	assert.Equal(t, OperationUpdate, page1.History[1].Operation)
+	assert.Equal(t, &user1, untimedPtr(page1.History[1].Before))
+	assert.Equal(t, &updated, page1.History[1].After)
+
+	page2, err := s.UserHistory(context.Background(), user1.UserId, 2, page1.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, page2.History, 1)
+	assert.Empty(t, page2.NextCursor)
+	assert.Equal(t, OperationCreate, page2.History[0].Operation)
+	assert.Equal(t, AnonymousPrincipal, page2.History[0].Principal)
+	assert.Nil(t, page2.History[0].Before)
+	assert.Equal(t, &user1, untimedPtr(page2.History[0].After))
+
+	_, err = s.UserHistory(context.Background(), user1.UserId, 2, "invalid")
+	assert.Equal(t, InvalidCursorErr, err)
+}
+
+func TestMemoryStorage_SearchUsers(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1, user2, user3)
+	require.NoError(t, s.DeleteUser(context.Background(), user3.UserId))
+
+	page1, err := s.SearchUsers(context.Background(), "JÓ", 1, "")
+	require.NoError(t, err)
+	require.Len(t, page1.Users, 1)
+	assert.NotEmpty(t, page1.NextCursor)
+	assert.Equal(t, user2, untimed(page1.Users[0].User))
+	assert.InDelta(t, 2.0/3, page1.Users[0].Score, 1e-9)
+
+	page2, err := s.SearchUsers(context.Background(), "JÓ", 1, page1.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, page2.Users, 1)
+	assert.Empty(t, page2.NextCursor)
+	assert.Equal(t, user1, untimed(page2.Users[0].User))
+
+	deleted, err := s.SearchUsers(context.Background(), "Jane Roe", 10, "")
+	require.NoError(t, err)
+	assert.Equal(t, SearchUsersResponse{Users: []ScoredUser{}}, deleted)
+
+	_, err = s.SearchUsers(context.Background(), "josh", 1, page1.NextCursor)
+	assert.Equal(t, InvalidCursorErr, err)
+}
+
+func TestMemoryStorage_UsersStats(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1, user2, user3)
+	require.NoError(t, s.DeleteUser(context.Background(), user3.UserId))
+
+	stats, err := s.UsersStats(context.Background(), []int{18, 30}, configuration.StatsPeriodYear)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Total)
+	assert.Equal(t, intPtr(20), stats.Age.Min)
+	assert.Equal(t, intPtr(42), stats.Age.Max)
+	assert.Equal(t, float64Ptr(31), stats.Age.Mean)
+	assert.Equal(t, []AgeBucket{
+		{From: 0, To: intPtr(18), Count: 0},
+		{From: 18, To: intPtr(30), Count: 1},
+		{From: 30, Count: 1},
+	}, stats.Age.Histogram)
+	assert.Equal(t, []PeriodCount{{Period: truncatePeriod(time.Now(), configuration.StatsPeriodYear), Count: 2}}, stats.Created)
+
+	empty, err := NewMemoryUserStorage().UsersStats(context.Background(), []int{18}, configuration.StatsPeriodDay)
+
+	require.NoError(t, err)
+	assert.Equal(t, UsersStats{
+		Age:     AgeStats{Histogram: []AgeBucket{{From: 0, To: intPtr(18)}, {From: 18}}},
+		Created: []PeriodCount{},
+	}, empty)
+}
+
+func TestMemoryStorage_RelayEvents(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1)
+	ctx := WithPrincipal(context.Background(), "support")
+
+	_, err := s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Age: intPtr(43)})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteUser(ctx, user1.UserId))
+
+	outbox := s.(EventOutbox)
+	publishErr := errors.New("webhook unavailable")
+
+	var events []Event
+	published, err := outbox.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+		if evt.Type == EventUserDeleted && evt.Attempts == 0 {
+			return publishErr
+		}
+
+		events = append(events, evt)
+		return nil
+	})
+	assert.Equal(t, publishErr, err)
+	assert.Equal(t, 2, published)
+
+	published, err = outbox.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+		events = append(events, evt)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	require.Len(t, events, 3)
+	assert.Equal(t, EventUserCreated, events[0].Type)
+	assert.Equal(t, AnonymousPrincipal, events[0].Principal)
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, EventUserUpdated, events[1].Type)
+	assert.Equal(t, "support", events[1].Principal)
+	assert.Equal(t, 43, events[1].After.Age)
+	assert.Equal(t, EventUserDeleted, events[2].Type)
+	assert.Equal(t, 1, events[2].Attempts)
+	assert.NotNil(t, events[2].After.DeletedAt)
+	assert.NotEqual(t, events[0].EventId, events[1].EventId)
+
+	published, err = outbox.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+		return errors.New("unexpected event")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestMemoryStorage_RelayEvents_parked(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1, user2)
+	outbox := s.(EventOutbox)
+
+	for i := 0; i < 2; i++ {
+		published, err := outbox.RelayEvents(context.Background(), 1, 2, func(evt Event) error {
+			return errors.New("event rejected")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 0, published)
+	}
+
+	var events []Event
+	published, err := outbox.RelayEvents(context.Background(), 1, 2, func(evt Event) error {
+		events = append(events, evt)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	require.Len(t, events, 1)
+	assert.Equal(t, user2.UserId, events[0].UserId)
+
+	published, err = outbox.RelayEvents(context.Background(), 10, 3, func(evt Event) error {
+		assert.Equal(t, user1.UserId, evt.UserId)
+		assert.Equal(t, 2, evt.Attempts)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+}
+
+func TestMemoryStorage_DisableEvents(t *testing.T) {
+	s := NewMemoryUserStorage()
+	s.(EventOutbox).DisableEvents()
+
+	_, err := s.CreateUser(context.Background(), user1)
+	require.NoError(t, err)
+
+	history, err := s.UserHistory(context.Background(), user1.UserId, 10, "")
+	require.NoError(t, err)
+	assert.Len(t, history.History, 1)
+
+	published, err := s.(EventOutbox).RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+		return errors.New("unexpected event")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestMemoryStorage_timestamps(t *testing.T) {
+	s := newFilledMemoryStorage(t, user1)
+
+	created, err := s.User(context.Background(), user1.UserId)
+	require.NoError(t, err)
+	assert.False(t, created.CreatedAt.IsZero())
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	updated, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Age: intPtr(43)})
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.True(t, updated.UpdatedAt.After(created.UpdatedAt))
+
+	replaced, _, err := s.PutUser(context.Background(), user1)
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, replaced.CreatedAt)
+	assert.False(t, replaced.UpdatedAt.Before(updated.UpdatedAt))
+}
+
+func TestMemoryStorage_concurrency(t *testing.T) {
+	s := NewMemoryUserStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			usr := User{UserId: fmt.Sprintf("00000000-0000-0000-0000-%012d", i), Name: "John Doe", Age: i + 1}
+			_, err := s.CreateUser(context.Background(), usr)
+			assert.NoError(t, err)
+			_, err = s.Users(context.Background(), configuration.UsersFilter{}, 10, "")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	users, err := s.Users(context.Background(), configuration.UsersFilter{}, configuration.MaxUsersLimit, "")
+	assert.NoError(t, err)
+	assert.Len(t, users.Users, 50)
+}
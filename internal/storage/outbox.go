@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+const outboxLockKey = 7236841920516
+
+var eventTypes = map[string]string{
+	OperationCreate:  EventUserCreated,
+	OperationUpdate:  EventUserUpdated,
+	OperationDelete:  EventUserDeleted,
+	OperationRestore: EventUserRestored,
+}
+
+type EventOutbox interface {
+	RelayEvents(ctx context.Context, limit int, maxAttempts int, publish func(evt Event) error) (int, error)
+	DisableEvents()
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type Event struct {
+	EventId    string    `json:"event_id"`
+	Type       string    `json:"type"`
+	UserId     string    `json:"user_id"`
+	Before     *User     `json:"before"`
+	After      *User     `json:"after"`
+	Principal  string    `json:"principal"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Attempts   int       `json:"-"`
+
+	outboxId int64
+}
+
+type eventPayload struct {
+	Before    *User  `json:"before"`
+	After     *User  `json:"after"`
+	Principal string `json:"principal"`
+}
+
+func newEvent(ctx context.Context, operation string, before *User, after *User) (Event, error) {
+	eventId, err := uuid.NewV7()
+	if err != nil {
+		return Event{}, err
+	}
+
+	userId := after.UserId
+	if before != nil {
+		userId = before.UserId
+	}
+
+	return Event{
+		EventId:    eventId.String(),
+		Type:       eventTypes[operation],
+		UserId:     userId,
+		Before:     before,
+		After:      after,
+		Principal:  Principal(ctx),
+		OccurredAt: time.Now(),
+	}, nil
+}
+
+func (st *storage) RelayEvents(ctx context.Context, limit int, maxAttempts int, publish func(evt Event) error) (int, error) {
+	var q queryer = st.db
+
+	if st.dialect.lockUserOutboxSQL != "" {
+		conn, err := st.db.Conn(ctx)
+		if err != nil {
+			return 0, st.dialect.classifyErr(err)
+		}
+		defer conn.Close()
+
+		var locked bool
+		if err := st.queryRow(ctx, conn, st.dialect.lockUserOutboxSQL, []interface{}{outboxLockKey}, &locked); err != nil {
+			return 0, err
+		}
+
+		if !locked {
+			return 0, nil
+		}
+		defer func() {
+			_, _ = conn.ExecContext(context.Background(), st.dialect.unlockUserOutboxSQL, outboxLockKey)
+		}()
+
+		q = conn
+	}
+
+	events, err := st.queryEvents(ctx, q, limit, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, evt := range events {
+		if err := publish(evt); err != nil {
+			if failErr := st.exec(ctx, q, st.dialect.failUserEventSQL, evt.outboxId, err.Error()); failErr != nil {
+				return i, failErr
+			}
+
+			return i, err
+		}
+
+		if err := st.exec(ctx, q, st.dialect.deleteUserEventSQL, evt.outboxId); err != nil {
+			return i, err
+		}
+	}
+
+	return len(events), nil
+}
+
+func (st *storage) DisableEvents() {
+	st.eventsDisabled = true
+}
+
+func (st *storage) recordEvent(ctx context.Context, tx *sql.Tx, operation string, before *User, after *User) error {
+	if st.eventsDisabled {
+		return nil
+	}
+
+	evt, err := newEvent(ctx, operation, before, after)
+	if err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(eventPayload{Before: evt.Before, After: evt.After, Principal: evt.Principal})
+
+	return st.exec(ctx, tx, st.dialect.insertUserEventSQL, evt.EventId, evt.Type, evt.UserId, string(payload))
+}
+
+func (st *storage) queryEvents(ctx context.Context, q queryer, limit int, maxAttempts int) ([]Event, error) {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	rows, err := q.QueryContext(stmtCtx, st.dialect.selectUserEventsSQL, limit, maxAttempts)
+	if err != nil {
+		return nil, st.statementErr(ctx, stmtCtx, err)
+	}
+	defer rows.Close()
+
+	events := make([]Event, 0)
+
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			return nil, st.statementErr(ctx, stmtCtx, err)
+		}
+
+		events = append(events, evt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return events, nil
+}
+
+func (st *storage) queryRow(ctx context.Context, q queryer, query string, args []interface{}, dest ...interface{}) error {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	if err := q.QueryRowContext(stmtCtx, query, args...).Scan(dest...); err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return nil
+}
+
+func (st *storage) exec(ctx context.Context, q queryer, query string, args ...interface{}) error {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	if _, err := q.ExecContext(stmtCtx, query, args...); err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return nil
+}
+
+func scanEvent(s scanner) (Event, error) {
+	var (
+		evt     Event
+		payload string
+	)
+
+	if err := s.Scan(
+		&evt.outboxId,
+		&evt.EventId,
+		&evt.Type,
+		&evt.UserId,
+		&payload,
+		&evt.OccurredAt,
+		&evt.Attempts,
+	); err != nil {
+		return Event{}, err
+	}
+
+	var p eventPayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return Event{}, err
+	}
+
+	evt.Before, evt.After, evt.Principal = p.Before, p.After, p.Principal
+
+	return evt, nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var eventColumns = []string{"outbox_id", "event_id", "event_type", "user_id", "payload", "occurred_at", "attempts"}
+
+func TestStorage_recordEvent(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		payload, err := json.Marshal(eventPayload{After: &user1, Principal: "support"})
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WithArgs(sqlmock.AnyArg(), EventUserCreated, user1.UserId, string(payload)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(WithPrincipal(context.Background(), "support"), user1)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(deleteUserSQL)).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WithArgs(sqlmock.AnyArg(), EventUserDeleted, user1.UserId, sqlmock.AnyArg()).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		err = s.DeleteUser(context.Background(), user1.UserId)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStorage_RelayEvents(t *testing.T) {
+	occurredAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated := User{UserId: user1.UserId, Name: user1.Name, Age: 43, Version: 2}
+
+	created, err := json.Marshal(eventPayload{After: &user1, Principal: "support"})
+	require.NoError(t, err)
+	changed, err := json.Marshal(eventPayload{Before: &user1, After: &updated, Principal: "support"})
+	require.NoError(t, err)
+
+	eventRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(eventColumns).
+			AddRow(1, "0186a0b4-0000-7000-8000-000000000001", EventUserCreated, user1.UserId, string(created), occurredAt, 0).
+			AddRow(2, "0186a0b4-0000-7000-8000-000000000002", EventUserUpdated, user1.UserId, string(changed), occurredAt, 1)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(lockUserOutboxSQL)).WithArgs(outboxLockKey).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserEventsSQL)).WithArgs(10, 10).WillReturnRows(eventRows())
+		mock.ExpectExec(regexp.QuoteMeta(deleteUserEventSQL)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(deleteUserEventSQL)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(unlockUserOutboxSQL)).WithArgs(outboxLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		s := NewUserStorage(db, time.Second).(EventOutbox)
+
+		var events []Event
+		published, err := s.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+			events = append(events, evt)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, published)
+		assert.Equal(t, []Event{
+			{EventId: "0186a0b4-0000-7000-8000-000000000001", Type: EventUserCreated, UserId: user1.UserId, After: &user1, Principal: "support", OccurredAt: occurredAt, outboxId: 1},
+			{EventId: "0186a0b4-0000-7000-8000-000000000002", Type: EventUserUpdated, UserId: user1.UserId, Before: &user1, After: &updated, Principal: "support", OccurredAt: occurredAt, Attempts: 1, outboxId: 2},
+		}, events)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok locked by another relay", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(lockUserOutboxSQL)).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+
+		s := NewUserStorage(db, time.Second).(EventOutbox)
+
+		published, err := s.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+			return errors.New("unexpected event")
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, published)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		publishErr := errors.New("webhook unavailable")
+
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(lockUserOutboxSQL)).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserEventsSQL)).WillReturnRows(eventRows())
+		mock.ExpectExec(regexp.QuoteMeta(deleteUserEventSQL)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(failUserEventSQL)).WithArgs(2, publishErr.Error()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(unlockUserOutboxSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		s := NewUserStorage(db, time.Second).(EventOutbox)
+
+		published, err := s.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+			if evt.Type == EventUserUpdated {
+				return publishErr
+			}
+
+			return nil
+		})
+
+		assert.Equal(t, publishErr, err)
+		assert.Equal(t, 1, published)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete error keeps published events deleted", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(lockUserOutboxSQL)).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserEventsSQL)).WillReturnRows(eventRows())
+		mock.ExpectExec(regexp.QuoteMeta(deleteUserEventSQL)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(deleteUserEventSQL)).WithArgs(2).WillReturnError(databaseError)
+		mock.ExpectExec(regexp.QuoteMeta(unlockUserOutboxSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		s := NewUserStorage(db, time.Second).(EventOutbox)
+
+		published, err := s.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+			return nil
+		})
+
+		assert.Equal(t, databaseError, err)
+		assert.Equal(t, 1, published)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(lockUserOutboxSQL)).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserEventsSQL)).WillReturnError(databaseError)
+		mock.ExpectExec(regexp.QuoteMeta(unlockUserOutboxSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		s := NewUserStorage(db, time.Second).(EventOutbox)
+
+		_, err = s.RelayEvents(context.Background(), 10, 10, func(evt Event) error {
+			return nil
+		})
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStorage_DisableEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+	mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationCreate, nil, userSnapshot(&user1), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	s := NewUserStorage(db, time.Second)
+	s.(EventOutbox).DisableEvents()
+
+	_, err = s.CreateUser(context.Background(), user1)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurePool(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	ConfigurePool(db, PoolConfig{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute, ConnMaxIdleTime: time.Second})
+
+	assert.Equal(t, 7, db.Stats().MaxOpenConnections)
+}
+
+func TestNewPoolStats(t *testing.T) {
+	stats := sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDuration:       1500 * time.Millisecond,
+		MaxIdleClosed:      6,
+		MaxIdleTimeClosed:  7,
+		MaxLifetimeClosed:  8,
+	}
+
+	expStats := PoolStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDurationMs:     1500,
+		MaxIdleClosed:      6,
+		MaxIdleTimeClosed:  7,
+		MaxLifetimeClosed:  8,
+	}
+
+	assert.Equal(t, expStats, NewPoolStats(stats))
+}
@@ -0,0 +1,4 @@
+DELETE FROM
+    "user_service"."user_outbox"
+WHERE
+    "outbox_id" = $1;
@@ -1,4 +1,14 @@
-DELETE FROM
+UPDATE
     "user_service"."users"
+SET
+    "deleted_at" = now()
 WHERE
-    "user_id" = $1;
+    "user_id" = $1 AND "deleted_at" IS NULL
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
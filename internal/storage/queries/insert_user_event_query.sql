@@ -0,0 +1,10 @@
+INSERT INTO
+    "user_service"."user_outbox" (
+        "event_id",
+        "event_type",
+        "user_id",
+        "payload"
+    )
+VALUES (
+    $1, $2, $3, $4
+);
@@ -0,0 +1,11 @@
+INSERT INTO
+    "user_service"."user_history" (
+        "user_id",
+        "operation",
+        "before",
+        "after",
+        "principal"
+    )
+VALUES (
+    $1, $2, $3, $4, $5
+);
@@ -0,0 +1,18 @@
+INSERT INTO
+    "user_service"."users" (
+        "user_id",
+        "name",
+        "age"
+    )
+VALUES (
+    $1, $2, $3
+)
+ON CONFLICT ("user_id") DO NOTHING
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
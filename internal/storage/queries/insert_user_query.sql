@@ -6,4 +6,12 @@ INSERT INTO
     )
 VALUES (
     $1, $2, $3
-);
+)
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
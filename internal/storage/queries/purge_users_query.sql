@@ -0,0 +1,4 @@
+DELETE FROM
+    "user_service"."users"
+WHERE
+    "deleted_at" < $1;
@@ -0,0 +1,14 @@
+UPDATE
+    "user_service"."users"
+SET
+    "deleted_at" = NULL
+WHERE
+    "user_id" = $1 AND "deleted_at" IS NOT NULL
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
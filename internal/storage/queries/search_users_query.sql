@@ -0,0 +1,36 @@
+SELECT
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at",
+    "score"
+FROM (
+    SELECT
+        "user_id",
+        "name",
+        "age",
+        "version",
+        "deleted_at",
+        "created_at",
+        "updated_at",
+        GREATEST(
+            "public"."similarity"("user_service"."normalize_name"("name"), "user_service"."normalize_name"($1::TEXT)),
+            "public"."word_similarity"("user_service"."normalize_name"($1::TEXT), "user_service"."normalize_name"("name"))
+        )::FLOAT8 AS "score"
+    FROM
+        "user_service"."users"
+    WHERE
+        "deleted_at" IS NULL AND (
+            "user_service"."normalize_name"("name") OPERATOR("public".%) "user_service"."normalize_name"($1::TEXT) OR
+            "user_service"."normalize_name"($1::TEXT) OPERATOR("public".<%) "user_service"."normalize_name"("name")
+        )
+) AS "matches"
+WHERE
+    "score" < $3::FLOAT8 OR ("score" = $3::FLOAT8 AND "user_id"::TEXT > $2::TEXT)
+ORDER BY
+    "score" DESC,
+    "user_id" ASC
+LIMIT $4;
@@ -0,0 +1,15 @@
+SELECT
+    "outbox_id",
+    "event_id",
+    "event_type",
+    "user_id",
+    "payload",
+    "occurred_at",
+    "attempts"
+FROM
+    "user_service"."user_outbox"
+WHERE
+    "attempts" < $2
+ORDER BY
+    "outbox_id" ASC
+LIMIT $1;
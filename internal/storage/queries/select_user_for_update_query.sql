@@ -0,0 +1,13 @@
+SELECT
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at"
+FROM
+    "user_service"."users"
+WHERE
+    "user_id" = $1
+FOR UPDATE;
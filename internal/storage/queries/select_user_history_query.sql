@@ -0,0 +1,15 @@
+SELECT
+    "history_id",
+    "user_id",
+    "operation",
+    "before",
+    "after",
+    "principal",
+    "changed_at"
+FROM
+    "user_service"."user_history"
+WHERE
+    "user_id" = $1 AND ($2::BIGINT = 0 OR "history_id" < $2::BIGINT)
+ORDER BY
+    "history_id" DESC
+LIMIT $3;
@@ -1,8 +1,12 @@
 SELECT
     "user_id",
     "name",
-    "age"
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at"
 FROM
     "user_service"."users"
 WHERE
-    "user_id" = $1;
+    "user_id" = $1 AND "deleted_at" IS NULL;
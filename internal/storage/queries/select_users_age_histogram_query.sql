@@ -0,0 +1,11 @@
+SELECT
+    %s AS "bucket",
+    count(*)
+FROM
+    "user_service"."users"
+WHERE
+    "deleted_at" IS NULL
+GROUP BY
+    "bucket"
+ORDER BY
+    "bucket";
@@ -0,0 +1,11 @@
+SELECT
+    date_trunc($1, "created_at" AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS "period",
+    count(*)
+FROM
+    "user_service"."users"
+WHERE
+    "deleted_at" IS NULL
+GROUP BY
+    "period"
+ORDER BY
+    "period";
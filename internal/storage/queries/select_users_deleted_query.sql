@@ -0,0 +1,6 @@
+SELECT
+    "ids"."value",
+    "users"."deleted_at" IS NOT NULL
+FROM
+    jsonb_array_elements_text($1::jsonb) AS "ids"
+    JOIN "user_service"."users" ON "users"."user_id" = "ids"."value"::uuid;
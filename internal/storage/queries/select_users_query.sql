@@ -1,6 +1,10 @@
 SELECT
     "user_id",
     "name",
-    "age"
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at"
 FROM
-    "user_service"."users";
+    "user_service"."users"
@@ -0,0 +1,9 @@
+SELECT
+    count(*),
+    min("age"),
+    max("age"),
+    avg("age")::FLOAT8
+FROM
+    "user_service"."users"
+WHERE
+    "deleted_at" IS NULL;
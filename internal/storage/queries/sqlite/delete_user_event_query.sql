@@ -0,0 +1,4 @@
+DELETE FROM
+    "user_outbox"
+WHERE
+    "outbox_id" = ?1;
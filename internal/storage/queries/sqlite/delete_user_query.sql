@@ -0,0 +1,14 @@
+UPDATE
+    "users"
+SET
+    "deleted_at" = strftime('%Y-%m-%d %H:%M:%f', 'now'), "updated_at" = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE
+    "user_id" = ?1 AND "deleted_at" IS NULL
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
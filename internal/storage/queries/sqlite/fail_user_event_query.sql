@@ -0,0 +1,7 @@
+UPDATE
+    "user_outbox"
+SET
+    "attempts" = "attempts" + 1,
+    "last_error" = ?2
+WHERE
+    "outbox_id" = ?1;
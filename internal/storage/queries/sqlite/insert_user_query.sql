@@ -0,0 +1,17 @@
+INSERT INTO
+    "users" (
+        "user_id",
+        "name",
+        "age"
+    )
+VALUES (
+    ?1, ?2, ?3
+)
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
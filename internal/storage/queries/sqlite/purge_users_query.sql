@@ -0,0 +1,4 @@
+DELETE FROM
+    "users"
+WHERE
+    "deleted_at" < ?1;
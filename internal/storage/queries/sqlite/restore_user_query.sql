@@ -0,0 +1,14 @@
+UPDATE
+    "users"
+SET
+    "deleted_at" = NULL, "updated_at" = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE
+    "user_id" = ?1 AND "deleted_at" IS NOT NULL
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
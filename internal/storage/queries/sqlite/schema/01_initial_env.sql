@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS "users" (
+    "user_id" TEXT NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "age" SMALLINT NOT NULL,
+    CONSTRAINT "user_id_pk" PRIMARY KEY ("user_id")
+);
@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "deleted_at" TIMESTAMP;
+
+CREATE INDEX "users_deleted_at_index" ON "users" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE "user_history" (
+    "history_id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    "user_id" TEXT NOT NULL,
+    "operation" VARCHAR(16) NOT NULL,
+    "before" TEXT,
+    "after" TEXT,
+    "principal" VARCHAR(255) NOT NULL,
+    "changed_at" TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX "user_history_user_id_index" ON "user_history" ("user_id", "history_id");
@@ -0,0 +1,20 @@
+CREATE TABLE "users_timestamps" (
+    "user_id" TEXT NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "age" SMALLINT NOT NULL,
+    "deleted_at" TIMESTAMP,
+    "version" INTEGER NOT NULL DEFAULT 1,
+    "created_at" TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    "updated_at" TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    CONSTRAINT "user_id_pk" PRIMARY KEY ("user_id")
+);
+
+INSERT INTO "users_timestamps" ("user_id", "name", "age", "deleted_at", "version")
+SELECT "user_id", "name", "age", "deleted_at", "version" FROM "users";
+
+DROP TABLE "users";
+ALTER TABLE "users_timestamps" RENAME TO "users";
+
+CREATE INDEX "users_deleted_at_index" ON "users" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+CREATE INDEX "users_created_at_index" ON "users" ("created_at");
+CREATE INDEX "users_updated_at_index" ON "users" ("updated_at");
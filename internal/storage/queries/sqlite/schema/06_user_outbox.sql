@@ -0,0 +1,12 @@
+CREATE TABLE "user_outbox" (
+    "outbox_id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    "event_id" TEXT NOT NULL,
+    "event_type" VARCHAR(32) NOT NULL,
+    "user_id" TEXT NOT NULL,
+    "payload" TEXT NOT NULL,
+    "occurred_at" TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "last_error" TEXT
+);
+
+CREATE UNIQUE INDEX "user_outbox_event_id_index" ON "user_outbox" ("event_id");
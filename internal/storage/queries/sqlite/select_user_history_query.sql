@@ -0,0 +1,15 @@
+SELECT
+    "history_id",
+    "user_id",
+    "operation",
+    "before",
+    "after",
+    "principal",
+    "changed_at"
+FROM
+    "user_history"
+WHERE
+    "user_id" = ?1 AND (?2 = 0 OR "history_id" < ?2)
+ORDER BY
+    "history_id" DESC
+LIMIT ?3;
@@ -0,0 +1,16 @@
+SELECT
+    CASE ?1
+        WHEN 'day' THEN strftime('%Y-%m-%dT00:00:00Z', "created_at")
+        WHEN 'week' THEN strftime('%Y-%m-%dT00:00:00Z', "created_at", 'weekday 0', '-6 days')
+        WHEN 'month' THEN strftime('%Y-%m-01T00:00:00Z', "created_at")
+        ELSE strftime('%Y-01-01T00:00:00Z', "created_at")
+    END AS "period",
+    count(*)
+FROM
+    "users"
+WHERE
+    "deleted_at" IS NULL
+GROUP BY
+    "period"
+ORDER BY
+    "period";
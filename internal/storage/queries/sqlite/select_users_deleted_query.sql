@@ -0,0 +1,6 @@
+SELECT
+    "ids"."value",
+    "users"."deleted_at" IS NOT NULL
+FROM
+    json_each(?1) AS "ids"
+    JOIN "users" ON "users"."user_id" = "ids"."value";
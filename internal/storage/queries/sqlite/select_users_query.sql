@@ -0,0 +1,10 @@
+SELECT
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at"
+FROM
+    "users"
@@ -0,0 +1,9 @@
+SELECT
+    count(*),
+    min("age"),
+    max("age"),
+    avg("age")
+FROM
+    "users"
+WHERE
+    "deleted_at" IS NULL;
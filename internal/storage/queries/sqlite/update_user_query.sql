@@ -0,0 +1,15 @@
+UPDATE
+    "users"
+SET
+    "name" = COALESCE(?2, "name"), "age" = COALESCE(?3, "age"), "version" = "version" + 1,
+    "updated_at" = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE
+    "user_id" = ?1 AND "deleted_at" IS NULL AND (?4 = 0 OR "version" = ?4)
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
@@ -0,0 +1,23 @@
+INSERT INTO
+    "users" (
+        "user_id",
+        "name",
+        "age"
+    )
+VALUES (
+    ?1, ?2, ?3
+)
+ON CONFLICT ("user_id") DO UPDATE
+SET
+    "name" = EXCLUDED."name", "age" = EXCLUDED."age", "version" = "users"."version" + 1,
+    "updated_at" = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE
+    "users"."deleted_at" IS NULL
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
@@ -1,6 +1,14 @@
 UPDATE
     "user_service"."users"
 SET
-    "name" = $2, "age" = $3
+    "name" = COALESCE($2, "name"), "age" = COALESCE($3, "age"), "version" = "version" + 1
 WHERE
-    "user_id" = $1;
+    "user_id" = $1 AND "deleted_at" IS NULL AND ($4 = 0 OR "version" = $4)
+RETURNING
+    "user_id",
+    "name",
+    "age",
+    "version",
+    "deleted_at",
+    "created_at",
+    "updated_at";
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"app/internal/configuration"
+)
+
+var ReadOnlyErr = errors.New("storage is read-only")
+
+type readOnlyStorage struct {
+	ust UserStorage
+}
+
+func NewReadOnlyUserStorage(ust UserStorage) UserStorage {
+	return &readOnlyStorage{ust: ust}
+}
+
+func (st *readOnlyStorage) Users(ctx context.Context, filter configuration.UsersFilter, limit int, cursor string) (UsersResponse, error) {
+	return st.ust.Users(ctx, filter, limit, cursor)
+}
+
+func (st *readOnlyStorage) ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error {
+	return st.ust.ExportUsers(ctx, filter, fn)
+}
+
+func (st *readOnlyStorage) User(ctx context.Context, userId string) (User, error) {
+	return st.ust.User(ctx, userId)
+}
+
+func (st *readOnlyStorage) CreateUser(_ context.Context, _ User) (User, error) {
+	return User{}, ReadOnlyErr
+}
+
+func (st *readOnlyStorage) CreateUsers(_ context.Context, _ []User, _ bool) ([]error, error) {
+	return nil, ReadOnlyErr
+}
+
+func (st *readOnlyStorage) UpdateUser(_ context.Context, _ UserPatch) (User, error) {
+	return User{}, ReadOnlyErr
+}
+
+func (st *readOnlyStorage) PutUser(_ context.Context, _ User) (User, bool, error) {
+	return User{}, false, ReadOnlyErr
+}
+
+func (st *readOnlyStorage) ImportUsers(ctx context.Context, users []User, dryRun bool) ([]ImportResult, error) {
+	if dryRun {
+		return st.ust.ImportUsers(ctx, users, dryRun)
+	}
+
+	return nil, ReadOnlyErr
+}
+
+func (st *readOnlyStorage) DeleteUser(_ context.Context, _ string) error {
+	return ReadOnlyErr
+}
+
+func (st *readOnlyStorage) RestoreUser(_ context.Context, _ string) error {
+	return ReadOnlyErr
+}
+
+func (st *readOnlyStorage) PurgeUsers(_ context.Context, _ time.Time) (int64, error) {
+	return 0, ReadOnlyErr
+}
+
+func (st *readOnlyStorage) SearchUsers(ctx context.Context, query string, limit int, cursor string) (SearchUsersResponse, error) {
+	return st.ust.SearchUsers(ctx, query, limit, cursor)
+}
+
+func (st *readOnlyStorage) UsersStats(ctx context.Context, ageBuckets []int, period string) (UsersStats, error) {
+	return st.ust.UsersStats(ctx, ageBuckets, period)
+}
+
+func (st *readOnlyStorage) UserHistory(ctx context.Context, userId string, limit int, cursor string) (UserHistoryResponse, error) {
+	return st.ust.UserHistory(ctx, userId, limit, cursor)
+}
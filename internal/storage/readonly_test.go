@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"app/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyStorage(t *testing.T) {
+	ctx := context.Background()
+
+	ust := NewMemoryUserStorage()
+	_, err := ust.CreateUser(ctx, user1)
+	require.NoError(t, err)
+
+	st := NewReadOnlyUserStorage(ust)
+
+	t.Run("reads", func(t *testing.T) {
+		usr, err := st.User(ctx, user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, user1.UserId, usr.UserId)
+
+		users, err := st.Users(ctx, configuration.UsersFilter{}, 10, "")
+		require.NoError(t, err)
+		assert.Len(t, users.Users, 1)
+
+		_, err = st.UserHistory(ctx, user1.UserId, 10, "")
+		assert.NoError(t, err)
+
+		found, err := st.SearchUsers(ctx, user1.Name, 10, "")
+		require.NoError(t, err)
+		assert.Len(t, found.Users, 1)
+
+		stats, err := st.UsersStats(ctx, configuration.DefaultAgeBuckets, configuration.StatsPeriodMonth)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Total)
+
+		results, err := st.ImportUsers(ctx, []User{user1, user2}, true)
+		require.NoError(t, err)
+		assert.Equal(t, []ImportResult{{Created: false}, {Created: true}}, results)
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		_, err := st.CreateUser(ctx, user2)
+		assert.ErrorIs(t, err, ReadOnlyErr)
+
+		_, err = st.CreateUsers(ctx, []User{user2}, true)
+		assert.ErrorIs(t, err, ReadOnlyErr)
+
+		_, err = st.UpdateUser(ctx, UserPatch{UserId: user1.UserId})
+		assert.ErrorIs(t, err, ReadOnlyErr)
+
+		_, _, err = st.PutUser(ctx, user1)
+		assert.ErrorIs(t, err, ReadOnlyErr)
+
+		_, err = st.ImportUsers(ctx, []User{user2}, false)
+		assert.ErrorIs(t, err, ReadOnlyErr)
+
+		assert.ErrorIs(t, st.DeleteUser(ctx, user1.UserId), ReadOnlyErr)
+		assert.ErrorIs(t, st.RestoreUser(ctx, user1.UserId), ReadOnlyErr)
+
+		_, err = st.PurgeUsers(ctx, time.Now())
+		assert.ErrorIs(t, err, ReadOnlyErr)
+
+		_, err = ust.User(ctx, user2.UserId)
+		assert.ErrorIs(t, err, UserNotFoundErr)
+	})
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type replica struct {
+	db             *sql.DB
+	cooldown       time.Duration
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+}
+
+func NewReplicatedUserStorage(db *sql.DB, replicaDB *sql.DB, statementTimeout time.Duration, replicaCooldown time.Duration) UserStorage {
+	return &storage{
+		db:               db,
+		replica:          &replica{db: replicaDB, cooldown: replicaCooldown},
+		dialect:          postgresDialect,
+		statementTimeout: statementTimeout,
+	}
+}
+
+type readYourWritesKey struct{}
+
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func ReadYourWrites(ctx context.Context) bool {
+	readYourWrites, _ := ctx.Value(readYourWritesKey{}).(bool)
+
+	return readYourWrites
+}
+
+func (r *replica) healthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !time.Now().Before(r.unhealthyUntil)
+}
+
+func (r *replica) markUnhealthy(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unhealthyUntil = time.Now().Add(r.cooldown)
+
+	log.Println(fmt.Sprintf("replica is unhealthy, reading from primary for %s - error: %s", r.cooldown, err))
+}
+
+func (st *storage) read(ctx context.Context, fn func(db *sql.DB) error) error {
+	if st.replica == nil || ReadYourWrites(ctx) || !st.replica.healthy() {
+		return fn(st.db)
+	}
+
+	err := fn(st.replica.db)
+	if errors.Is(err, ConnectionLostErr) {
+		st.replica.markUnhealthy(err)
+
+		return fn(st.db)
+	}
+
+	return err
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"app/internal/configuration"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReplicatedUserStorage(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	replicaDB, _, _ := sqlmock.New()
+	expStorage := &storage{
+		db:               db,
+		replica:          &replica{db: replicaDB, cooldown: time.Minute},
+		dialect:          postgresDialect,
+		statementTimeout: time.Second,
+	}
+
+	assert.Equal(t, expStorage, NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute))
+}
+
+func TestReadYourWrites(t *testing.T) {
+	assert.False(t, ReadYourWrites(context.Background()))
+	assert.True(t, ReadYourWrites(WithReadYourWrites(context.Background())))
+}
+
+func TestStorage_read(t *testing.T) {
+	t.Run("reads from replica", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		replicaDB, replicaMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		replicaMock.ExpectQuery("SELECT").WillReturnRows(userRows(user1))
+
+		s := NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute)
+
+		usr, err := s.User(context.Background(), user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, user1, usr)
+
+		users, err := s.Users(context.Background(), configuration.UsersFilter{}, 10, "")
+		require.NoError(t, err)
+		assert.Equal(t, UsersResponse{Users: []User{user1}}, users)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("read your writes reads from primary", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		replicaDB, replicaMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer replicaDB.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+
+		s := NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute)
+
+		usr, err := s.User(WithReadYourWrites(context.Background()), user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, user1, usr)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("writes go to primary", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		replicaDB, replicaMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer replicaDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute)
+
+		_, err = s.CreateUser(context.Background(), user1)
+		require.NoError(t, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("unhealthy replica falls back to primary", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		replicaDB, replicaMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnError(&pq.Error{Code: "57P03"})
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+
+		s := NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute)
+
+		usr, err := s.User(context.Background(), user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, user1, usr)
+
+		usr, err = s.User(context.Background(), user1.UserId)
+		require.NoError(t, err, "replica must be skipped during the cooldown")
+		assert.Equal(t, user1, usr)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("replica is used again after the cooldown", func(t *testing.T) {
+		r := &replica{cooldown: time.Millisecond}
+
+		r.markUnhealthy(databaseError)
+		assert.False(t, r.healthy())
+
+		time.Sleep(2 * time.Millisecond)
+		assert.True(t, r.healthy())
+	})
+
+	t.Run("replica not found error is returned", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		replicaDB, replicaMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+
+		s := NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute)
+
+		_, err = s.User(context.Background(), user1.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"app/internal/configuration"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Budget      time.Duration
+}
+
+type retryStorage struct {
+	ust    UserStorage
+	policy RetryPolicy
+	jitter func(d time.Duration) time.Duration
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func NewRetryUserStorage(ust UserStorage, policy RetryPolicy) UserStorage {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	return &retryStorage{
+		ust:    ust,
+		policy: policy,
+		jitter: equalJitter,
+		sleep:  sleepContext,
+	}
+}
+
+func retryableErr(err error) bool {
+	var nrErr *noRetryErr
+	if errors.As(err, &nrErr) {
+		return false
+	}
+
+	return errors.Is(err, SerializationFailureErr) || errors.Is(err, DeadlockErr) || errors.Is(err, ConnectionLostErr)
+}
+
+func (st *retryStorage) Users(ctx context.Context, filter configuration.UsersFilter, limit int, cursor string) (UsersResponse, error) {
+	var users UsersResponse
+
+	err := st.retry(ctx, func() error {
+		var err error
+		users, err = st.ust.Users(ctx, filter, limit, cursor)
+		return err
+	})
+
+	return users, err
+}
+
+func (st *retryStorage) ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error {
+	exported := false
+
+	return st.retry(ctx, func() error {
+		err := st.ust.ExportUsers(ctx, filter, func(usr User) error {
+			exported = true
+			return fn(usr)
+		})
+		if err != nil && exported {
+			return noRetry(err)
+		}
+
+		return err
+	})
+}
+
+func (st *retryStorage) User(ctx context.Context, userId string) (User, error) {
+	var usr User
+
+	err := st.retry(ctx, func() error {
+		var err error
+		usr, err = st.ust.User(ctx, userId)
+		return err
+	})
+
+	return usr, err
+}
+
+func (st *retryStorage) CreateUser(ctx context.Context, usr User) (User, error) {
+	var created User
+
+	err := st.retry(ctx, func() error {
+		var err error
+		created, err = st.ust.CreateUser(ctx, usr)
+		return err
+	})
+
+	return created, err
+}
+
+func (st *retryStorage) CreateUsers(ctx context.Context, users []User, atomic bool) ([]error, error) {
+	var errs []error
+
+	err := st.retry(ctx, func() error {
+		var err error
+		errs, err = st.ust.CreateUsers(ctx, users, atomic)
+		return err
+	})
+
+	return errs, err
+}
+
+func (st *retryStorage) UpdateUser(ctx context.Context, patch UserPatch) (User, error) {
+	var updated User
+
+	err := st.retry(ctx, func() error {
+		var err error
+		updated, err = st.ust.UpdateUser(ctx, patch)
+		return err
+	})
+
+	return updated, err
+}
+
+func (st *retryStorage) PutUser(ctx context.Context, usr User) (User, bool, error) {
+	var (
+		put     User
+		created bool
+	)
+
+	err := st.retry(ctx, func() error {
+		var err error
+		put, created, err = st.ust.PutUser(ctx, usr)
+		return err
+	})
+
+	return put, created, err
+}
+
+func (st *retryStorage) ImportUsers(ctx context.Context, users []User, dryRun bool) ([]ImportResult, error) {
+	var results []ImportResult
+
+	err := st.retry(ctx, func() error {
+		var err error
+		results, err = st.ust.ImportUsers(ctx, users, dryRun)
+		return err
+	})
+
+	return results, err
+}
+
+func (st *retryStorage) DeleteUser(ctx context.Context, userId string) error {
+	return st.retry(ctx, func() error {
+		return st.ust.DeleteUser(ctx, userId)
+	})
+}
+
+func (st *retryStorage) RestoreUser(ctx context.Context, userId string) error {
+	return st.retry(ctx, func() error {
+		return st.ust.RestoreUser(ctx, userId)
+	})
+}
+
+func (st *retryStorage) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+
+	err := st.retry(ctx, func() error {
+		var err error
+		purged, err = st.ust.PurgeUsers(ctx, deletedBefore)
+		return err
+	})
+
+	return purged, err
+}
+
+func (st *retryStorage) SearchUsers(ctx context.Context, query string, limit int, cursor string) (SearchUsersResponse, error) {
+	var users SearchUsersResponse
+
+	err := st.retry(ctx, func() error {
+		var err error
+		users, err = st.ust.SearchUsers(ctx, query, limit, cursor)
+		return err
+	})
+
+	return users, err
+}
+
+func (st *retryStorage) UsersStats(ctx context.Context, ageBuckets []int, period string) (UsersStats, error) {
+	var stats UsersStats
+
+	err := st.retry(ctx, func() error {
+		var err error
+		stats, err = st.ust.UsersStats(ctx, ageBuckets, period)
+		return err
+	})
+
+	return stats, err
+}
+
+func (st *retryStorage) UserHistory(ctx context.Context, userId string, limit int, cursor string) (UserHistoryResponse, error) {
+	var history UserHistoryResponse
+
+	err := st.retry(ctx, func() error {
+		var err error
+		history, err = st.ust.UserHistory(ctx, userId, limit, cursor)
+		return err
+	})
+
+	return history, err
+}
+
+func (st *retryStorage) retry(ctx context.Context, fn func() error) error {
+	deadline := time.Now().Add(st.policy.Budget)
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retryableErr(err) || attempt >= st.policy.MaxAttempts {
+			return err
+		}
+
+		delay := st.jitter(st.backoff(attempt))
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		log.Println(fmt.Sprintf("retrying storage operation in %s, attempt %d failed with error - %s", delay, attempt, err))
+
+		if sleepErr := st.sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func (st *retryStorage) backoff(attempt int) time.Duration {
+	delay := st.policy.BaseDelay
+	for i := 1; i < attempt && delay < st.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > st.policy.MaxDelay {
+		return st.policy.MaxDelay
+	}
+
+	return delay
+}
+
+func equalJitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+
+	half := d / 2
+
+	return half + time.Duration(rand.Int63n(int64(d-half)))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"app/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyStorage struct {
+	UserStorage
+	errs  []error
+	calls int
+}
+
+func (st *flakyStorage) User(ctx context.Context, userId string) (User, error) {
+	st.calls++
+	if len(st.errs) > 0 {
+		err := st.errs[0]
+		st.errs = st.errs[1:]
+		return User{}, err
+	}
+
+	return st.UserStorage.User(ctx, userId)
+}
+
+func (st *flakyStorage) ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error {
+	st.calls++
+	if err := st.UserStorage.ExportUsers(ctx, filter, fn); err != nil {
+		return err
+	}
+
+	if len(st.errs) > 0 {
+		err := st.errs[0]
+		st.errs = st.errs[1:]
+		return err
+	}
+
+	return nil
+}
+
+func newRetryStorage(ust UserStorage, policy RetryPolicy) (*retryStorage, *[]time.Duration) {
+	var delays []time.Duration
+
+	st := NewRetryUserStorage(ust, policy).(*retryStorage)
+	st.jitter = func(d time.Duration) time.Duration {
+		return d
+	}
+	st.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	return st, &delays
+}
+
+func TestRetryStorage_retry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond, Budget: time.Second}
+	serializationErr := fmt.Errorf("%w: could not serialize access", SerializationFailureErr)
+
+	t.Run("ok after retryable errors", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t, user1), errs: []error{serializationErr, classify(ConnectionLostErr, databaseError)}}
+		st, delays := newRetryStorage(ust, policy)
+
+		usr, err := st.User(context.Background(), user1.UserId)
+		require.NoError(t, err)
+		assert.Equal(t, user1, untimed(usr))
+		assert.Equal(t, 3, ust.calls)
+		assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, *delays)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t, user1), errs: []error{serializationErr, serializationErr, serializationErr, serializationErr, serializationErr}}
+		st, delays := newRetryStorage(ust, policy)
+
+		_, err := st.User(context.Background(), user1.UserId)
+		assert.Equal(t, serializationErr, err)
+		assert.Equal(t, 4, ust.calls)
+		assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}, *delays)
+	})
+
+	t.Run("budget exhausted", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t, user1), errs: []error{serializationErr, serializationErr, serializationErr}}
+		st, delays := newRetryStorage(ust, RetryPolicy{MaxAttempts: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond, Budget: 15 * time.Millisecond})
+
+		_, err := st.User(context.Background(), user1.UserId)
+		assert.Equal(t, serializationErr, err)
+		assert.Equal(t, 2, ust.calls)
+		assert.Equal(t, []time.Duration{10 * time.Millisecond}, *delays)
+	})
+
+	t.Run("not retryable error", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t, user1)}
+		st, delays := newRetryStorage(ust, policy)
+
+		_, err := st.User(context.Background(), user2.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+		assert.Equal(t, 1, ust.calls)
+		assert.Empty(t, *delays)
+	})
+
+	t.Run("context canceled while waiting", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t, user1), errs: []error{serializationErr}}
+		st := NewRetryUserStorage(ust, policy)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := st.User(ctx, user1.UserId)
+		assert.Equal(t, serializationErr, err)
+		assert.Equal(t, 1, ust.calls)
+	})
+}
+
+func TestRetryStorage_ExportUsers(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond, Budget: time.Second}
+	serializationErr := fmt.Errorf("%w: could not serialize access", SerializationFailureErr)
+
+	t.Run("ok retried before the first user", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t), errs: []error{serializationErr}}
+		st, delays := newRetryStorage(ust, policy)
+
+		err := st.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, ust.calls)
+		assert.Equal(t, []time.Duration{10 * time.Millisecond}, *delays)
+	})
+
+	t.Run("not retried after the first user", func(t *testing.T) {
+		ust := &flakyStorage{UserStorage: newFilledMemoryStorage(t, user1), errs: []error{serializationErr}}
+		st, delays := newRetryStorage(ust, policy)
+
+		exported := 0
+		err := st.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			exported++
+			return nil
+		})
+		assert.ErrorIs(t, err, SerializationFailureErr)
+		assert.Equal(t, 1, exported)
+		assert.Equal(t, 1, ust.calls)
+		assert.Empty(t, *delays)
+	})
+}
+
+func TestNewRetryUserStorage(t *testing.T) {
+	st := NewRetryUserStorage(NewMemoryUserStorage(), RetryPolicy{}).(*retryStorage)
+
+	assert.Equal(t, 1, st.policy.MaxAttempts)
+}
+
+func Test_equalJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := equalJitter(100 * time.Millisecond)
+
+		assert.GreaterOrEqual(t, int64(d), int64(50*time.Millisecond))
+		assert.Less(t, int64(d), int64(100*time.Millisecond))
+	}
+
+	assert.Equal(t, time.Duration(0), equalJitter(0))
+}
+
+func Test_retryableErr(t *testing.T) {
+	assert.True(t, retryableErr(classify(SerializationFailureErr, databaseError)))
+	assert.True(t, retryableErr(classify(DeadlockErr, databaseError)))
+	assert.True(t, retryableErr(classify(ConnectionLostErr, databaseError)))
+	assert.False(t, retryableErr(noRetry(classify(ConnectionLostErr, databaseError))))
+	assert.False(t, retryableErr(classify(UniqueViolationErr, databaseError)))
+	assert.False(t, retryableErr(StatementTimeoutErr))
+	assert.False(t, retryableErr(databaseError))
+}
@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"app/internal/configuration"
+	"github.com/google/uuid"
+)
+
+const (
+	similarityThreshold     = 0.3
+	wordSimilarityThreshold = 0.6
+)
+
+var accentFold = newAccentFold(map[string]string{
+	"a":  "àáâãäåāăąǎǟǡǻȁȃȧ",
+	"ae": "æ",
+	"b":  "ƀ",
+	"c":  "çćĉċčƈ",
+	"d":  "ðďđƌ",
+	"e":  "èéêëēĕėęěȅȇȩ",
+	"f":  "ƒ",
+	"g":  "ĝğġģǧǵ",
+	"h":  "ĥħȟ",
+	"i":  "ìíîïĩīĭįıǐȉȋ",
+	"ij": "ĳ",
+	"j":  "ĵǰ",
+	"k":  "ķƙǩ",
+	"l":  "ĺļľŀłƚ",
+	"n":  "ñńņňŉŋƞǹ",
+	"o":  "òóôõöøōŏőơǒǫǭȍȏȫȭȯȱ",
+	"oe": "œ",
+	"p":  "ƥ",
+	"r":  "ŕŗřȑȓ",
+	"s":  "śŝşšſș",
+	"ss": "ß",
+	"t":  "ţťŧƫƭț",
+	"th": "þ",
+	"u":  "ùúûüũūŭůűųưǔǖǘǚǜȕȗ",
+	"w":  "ŵ",
+	"y":  "ýÿŷƴȳ",
+	"z":  "źżžƶ",
+})
+
+type ScoredUser struct {
+	User
+	Score float64 `json:"score"`
+}
+
+type SearchUsersResponse struct {
+	Users      []ScoredUser `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type searchCursor struct {
+	Query  string  `json:"query"`
+	Score  float64 `json:"score"`
+	UserId string  `json:"user_id"`
+}
+
+func (st *storage) SearchUsers(ctx context.Context, query string, limit int, cursor string) (SearchUsersResponse, error) {
+	after, err := decodeSearchCursor(cursor, query)
+	if err != nil {
+		return SearchUsersResponse{}, err
+	}
+
+	if st.dialect.searchUsersSQL == "" {
+		return st.searchUsersInProcess(ctx, query, after, limit)
+	}
+
+	score := 2.0
+	if after.UserId != "" {
+		score = after.Score
+	}
+
+	var users []ScoredUser
+
+	err = st.read(ctx, func(db *sql.DB) error {
+		users, err = st.querySearchUsers(ctx, db, query, after.UserId, score, limit+1)
+		return err
+	})
+	if err != nil {
+		return SearchUsersResponse{}, err
+	}
+
+	return searchUsersPage(users, query, limit), nil
+}
+
+func (st *storage) querySearchUsers(ctx context.Context, db *sql.DB, query string, afterUserId string, afterScore float64, limit int) ([]ScoredUser, error) {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(stmtCtx, st.dialect.searchUsersSQL, query, afterUserId, afterScore, limit)
+	if err != nil {
+		return nil, st.statementErr(ctx, stmtCtx, err)
+	}
+	defer rows.Close()
+
+	users := make([]ScoredUser, 0)
+
+	for rows.Next() {
+		var (
+			usr       ScoredUser
+			deletedAt sql.NullTime
+		)
+
+		if err := rows.Scan(
+			&usr.UserId,
+			&usr.Name,
+			&usr.Age,
+			&usr.Version,
+			&deletedAt,
+			&usr.CreatedAt,
+			&usr.UpdatedAt,
+			&usr.Score,
+		); err != nil {
+			return nil, st.statementErr(ctx, stmtCtx, err)
+		}
+
+		if deletedAt.Valid {
+			usr.DeletedAt = &deletedAt.Time
+		}
+
+		users = append(users, usr)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return users, nil
+}
+
+func (st *storage) searchUsersInProcess(ctx context.Context, query string, after searchCursor, limit int) (SearchUsersResponse, error) {
+	usersQuery, args := buildUsersQuery(st.dialect, configuration.UsersFilter{}, usersCursor{}, 0)
+
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	var users []User
+
+	err := st.read(ctx, func(db *sql.DB) error {
+		users = users[:0]
+
+		return st.eachUser(ctx, stmtCtx, db, usersQuery, args, func(usr User) error {
+			users = append(users, usr)
+			return nil
+		})
+	})
+	if err != nil {
+		return SearchUsersResponse{}, err
+	}
+
+	return searchUsersPage(rankUsers(users, query, after, limit+1), query, limit), nil
+}
+
+func rankUsers(users []User, query string, after searchCursor, limit int) []ScoredUser {
+	queryTrigrams := trigrams(normalizeName(query))
+
+	matches := make([]ScoredUser, 0)
+	for _, usr := range users {
+		score, ok := matchName(queryTrigrams, trigrams(normalizeName(usr.Name)))
+		if !ok {
+			continue
+		}
+
+		if after.UserId != "" && (score > after.Score || (score == after.Score && usr.UserId <= after.UserId)) {
+			continue
+		}
+
+		matches = append(matches, ScoredUser{User: usr, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+
+		return matches[i].UserId < matches[j].UserId
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+func searchUsersPage(users []ScoredUser, query string, limit int) SearchUsersResponse {
+	var nextCursor string
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = encodeSearchCursor(users[limit-1], query)
+	}
+
+	return SearchUsersResponse{Users: users, NextCursor: nextCursor}
+}
+
+func encodeSearchCursor(usr ScoredUser, query string) string {
+	content, _ := json.Marshal(searchCursor{
+		Query:  query,
+		Score:  usr.Score,
+		UserId: usr.UserId,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeSearchCursor(s string, query string) (searchCursor, error) {
+	if s == "" {
+		return searchCursor{}, nil
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, InvalidCursorErr
+	}
+
+	var c searchCursor
+	if err := json.Unmarshal(content, &c); err != nil {
+		return searchCursor{}, InvalidCursorErr
+	}
+
+	if _, err := uuid.Parse(c.UserId); err != nil {
+		return searchCursor{}, InvalidCursorErr
+	}
+
+	if c.Query != query {
+		return searchCursor{}, InvalidCursorErr
+	}
+
+	return c, nil
+}
+
+func matchName(queryTrigrams []string, nameTrigrams []string) (float64, bool) {
+	score := similarity(queryTrigrams, nameTrigrams)
+	matched := score >= similarityThreshold
+
+	if wordScore := wordSimilarity(queryTrigrams, nameTrigrams); wordScore >= wordSimilarityThreshold {
+		matched = true
+		if wordScore > score {
+			score = wordScore
+		}
+	}
+
+	return score, matched
+}
+
+func normalizeName(name string) string {
+	var sb strings.Builder
+
+	for _, r := range strings.ToLower(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		if folded, ok := accentFold[r]; ok {
+			sb.WriteString(folded)
+			continue
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+func trigrams(s string) []string {
+	var result []string
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			result = append(result, string(padded[i:i+3]))
+		}
+	}
+
+	return result
+}
+
+func similarity(a []string, b []string) float64 {
+	setA := trigramSet(a)
+	setB := trigramSet(b)
+
+	if len(setA) == 0 || len(setB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range setA {
+		if setB[trigram] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
+
+func wordSimilarity(query []string, name []string) float64 {
+	querySet := trigramSet(query)
+	best := 0.0
+
+	for i := range name {
+		if !querySet[name[i]] {
+			continue
+		}
+
+		for j := i; j < len(name); j++ {
+			if !querySet[name[j]] {
+				continue
+			}
+
+			if score := similarity(query, name[i:j+1]); score > best {
+				best = score
+			}
+		}
+	}
+
+	return best
+}
+
+func trigramSet(trigrams []string) map[string]bool {
+	set := make(map[string]bool, len(trigrams))
+	for _, trigram := range trigrams {
+		set[trigram] = true
+	}
+
+	return set
+}
+
+func newAccentFold(folds map[string]string) map[rune]string {
+	fold := make(map[rune]string)
+	for base, accented := range folds {
+		for _, r := range accented {
+			fold[r] = base
+		}
+	}
+
+	return fold
+}
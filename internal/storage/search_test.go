@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var searchColumns = append(append([]string{}, userColumns...), "score")
+
+func TestStorage_SearchUsers(t *testing.T) {
+	scored1 := ScoredUser{User: user1, Score: 1}
+	scored2 := ScoredUser{User: user2, Score: 0.5}
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(searchColumns).
+			AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt, 1.0).
+			AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt, 0.5)
+		mock.ExpectQuery(regexp.QuoteMeta(searchUsersSQL)).WithArgs("john", "", 2.0, 3).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		users, err := s.SearchUsers(context.Background(), "john", 2, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, SearchUsersResponse{Users: []ScoredUser{scored1, scored2}}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok next page", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(searchColumns).
+			AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt, 1.0).
+			AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt, 0.5)
+		mock.ExpectQuery(regexp.QuoteMeta(searchUsersSQL)).WithArgs("john", user1.UserId, 1.0, 2).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		users, err := s.SearchUsers(context.Background(), "john", 1, encodeSearchCursor(scored1, "john"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, SearchUsersResponse{Users: []ScoredUser{scored1}, NextCursor: encodeSearchCursor(scored1, "john")}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.SearchUsers(context.Background(), "josh", 1, encodeSearchCursor(scored1, "john"))
+
+		assert.Equal(t, InvalidCursorErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(searchUsersSQL)).WillReturnError(databaseError)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.SearchUsers(context.Background(), "john", 1, "")
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_decodeSearchCursor(t *testing.T) {
+	cursor := encodeSearchCursor(ScoredUser{User: user1, Score: 0.25}, "john")
+
+	c, err := decodeSearchCursor(cursor, "john")
+	assert.NoError(t, err)
+	assert.Equal(t, searchCursor{Query: "john", Score: 0.25, UserId: user1.UserId}, c)
+
+	c, err = decodeSearchCursor("", "john")
+	assert.NoError(t, err)
+	assert.Equal(t, searchCursor{}, c)
+
+	for _, s := range []string{"!", "YWJj", "e30", cursor} {
+		_, err := decodeSearchCursor(s, "josh")
+		assert.Equal(t, InvalidCursorErr, err, s)
+	}
+}
+
+func Test_normalizeName(t *testing.T) {
+	assert.Equal(t, "zoe angstrom-oeuf", normalizeName("Zoë Ångström-ŒUF"))
+	assert.Equal(t, "zoe", normalizeName("Zoë"))
+	assert.Equal(t, "strasse", normalizeName("Straße"))
+}
+
+func Test_trigrams(t *testing.T) {
+	assert.Equal(t, []string{"  j", " jo", "jo ", "  d", " do", "doe", "oe "}, trigrams("jo, doe"))
+	assert.Empty(t, trigrams(" - "))
+}
+
+func Test_matchName(t *testing.T) {
+	type args struct {
+		query string
+		name  string
+	}
+	type exp struct {
+		score   float64
+		matched bool
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "exact",
+			args: args{query: "John Doe", name: "John Doe"},
+			exp:  exp{score: 1, matched: true},
+		},
+		{
+			name: "case and accent insensitive",
+			args: args{query: "JÖHN DÔE", name: "John Doe"},
+			exp:  exp{score: 1, matched: true},
+		},
+		{
+			name: "typo",
+			args: args{query: "Jon Doe", name: "John Doe"},
+			exp:  exp{score: 6.0 / 11, matched: true},
+		},
+		{
+			name: "word",
+			args: args{query: "brave", name: "Josh Brave"},
+			exp:  exp{score: 1, matched: true},
+		},
+		{
+			name: "no match",
+			args: args{query: "Jane", name: "John Doe"},
+			exp:  exp{score: 1.0 / 13, matched: false},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			score, matched := matchName(trigrams(normalizeName(tc.args.query)), trigrams(normalizeName(tc.args.name)))
+
+			assert.Equal(t, tc.exp.matched, matched)
+			assert.InDelta(t, tc.exp.score, score, 1e-9)
+		})
+	}
+}
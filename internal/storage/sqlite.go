@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	//go:embed queries/sqlite/select_users_query.sql
+	sqliteSelectUsersSQL string
+	//go:embed queries/sqlite/select_user_query.sql
+	sqliteSelectUserSQL string
+	//go:embed queries/sqlite/insert_user_query.sql
+	sqliteInsertUserSQL string
+	//go:embed queries/sqlite/update_user_query.sql
+	sqliteUpdateUserSQL string
+	//go:embed queries/sqlite/delete_user_query.sql
+	sqliteDeleteUserSQL string
+	//go:embed queries/sqlite/restore_user_query.sql
+	sqliteRestoreUserSQL string
+	//go:embed queries/sqlite/purge_users_query.sql
+	sqlitePurgeUsersSQL string
+	//go:embed queries/sqlite/insert_user_if_absent_query.sql
+	sqliteInsertUserIfAbsentSQL string
+	//go:embed queries/sqlite/upsert_user_query.sql
+	sqliteUpsertUserSQL string
+	//go:embed queries/sqlite/select_user_for_update_query.sql
+	sqliteSelectUserForUpdateSQL string
+	//go:embed queries/sqlite/select_users_deleted_query.sql
+	sqliteSelectUsersDeletedSQL string
+	//go:embed queries/sqlite/insert_user_history_query.sql
+	sqliteInsertUserHistorySQL string
+	//go:embed queries/sqlite/select_user_history_query.sql
+	sqliteSelectUserHistorySQL string
+	//go:embed queries/sqlite/select_users_summary_query.sql
+	sqliteSelectUsersSummarySQL string
+	//go:embed queries/sqlite/select_users_age_histogram_query.sql
+	sqliteSelectUsersAgeHistogramSQL string
+	//go:embed queries/sqlite/select_users_created_query.sql
+	sqliteSelectUsersCreatedSQL string
+	//go:embed queries/sqlite/insert_user_event_query.sql
+	sqliteInsertUserEventSQL string
+	//go:embed queries/sqlite/select_user_events_query.sql
+	sqliteSelectUserEventsSQL string
+	//go:embed queries/sqlite/delete_user_event_query.sql
+	sqliteDeleteUserEventSQL string
+	//go:embed queries/sqlite/fail_user_event_query.sql
+	sqliteFailUserEventSQL string
+
+	//go:embed queries/sqlite/schema/*.sql
+	sqliteSchema embed.FS
+)
+
+var sqliteDialect = &dialect{
+	selectUsersSQL: sqliteSelectUsersSQL,
+	selectUserSQL:  sqliteSelectUserSQL,
+	insertUserSQL:  sqliteInsertUserSQL,
+	updateUserSQL:  sqliteUpdateUserSQL,
+	deleteUserSQL:  sqliteDeleteUserSQL,
+	restoreUserSQL: sqliteRestoreUserSQL,
+	purgeUsersSQL:  sqlitePurgeUsersSQL,
+
+	insertUserIfAbsentSQL:  sqliteInsertUserIfAbsentSQL,
+	upsertUserSQL:          sqliteUpsertUserSQL,
+	selectUserForUpdateSQL: sqliteSelectUserForUpdateSQL,
+	selectUsersDeletedSQL:  sqliteSelectUsersDeletedSQL,
+	insertUserHistorySQL:   sqliteInsertUserHistorySQL,
+	selectUserHistorySQL:   sqliteSelectUserHistorySQL,
+
+	selectUsersSummarySQL:      sqliteSelectUsersSummarySQL,
+	selectUsersAgeHistogramSQL: sqliteSelectUsersAgeHistogramSQL,
+	selectUsersCreatedSQL:      sqliteSelectUsersCreatedSQL,
+
+	insertUserEventSQL:  sqliteInsertUserEventSQL,
+	selectUserEventsSQL: sqliteSelectUserEventsSQL,
+	deleteUserEventSQL:  sqliteDeleteUserEventSQL,
+	failUserEventSQL:    sqliteFailUserEventSQL,
+
+	placeholderPrefix: "?",
+	likeOperator:      "LIKE",
+	classifyErr:       classifySQLiteErr,
+}
+
+func NewSQLiteUserStorage(db *sql.DB, statementTimeout time.Duration) UserStorage {
+	return &storage{
+		db:               db,
+		dialect:          sqliteDialect,
+		statementTimeout: statementTimeout,
+	}
+}
+
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on", path))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func sqliteSchemaFiles() ([]string, error) {
+	files, err := fs.Glob(sqliteSchema, "queries/sqlite/schema/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	files, err := sqliteSchemaFiles()
+	if err != nil {
+		return err
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(files); i++ {
+		content, err := sqliteSchema.ReadFile(files[i])
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(string(content)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("cannot apply sqlite schema %s: %w", files[i], err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func classifySQLiteErr(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintPrimaryKey, sqlite3.ErrConstraintUnique:
+		return classify(UniqueViolationErr, err)
+	case sqlite3.ErrConstraintCheck:
+		return classify(CheckViolationErr, err)
+	}
+
+	return err
+}
@@ -0,0 +1,450 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"app/internal/configuration"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteStorage(t *testing.T) (UserStorage, *sql.DB) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "users.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return NewSQLiteUserStorage(db, time.Second), db
+}
+
+func TestNewSQLiteUserStorage(t *testing.T) {
+	db := &sql.DB{}
+	expStorage := &storage{
+		db:               db,
+		dialect:          sqliteDialect,
+		statementTimeout: time.Second,
+	}
+
+	assert.Equal(t, expStorage, NewSQLiteUserStorage(db, time.Second))
+}
+
+func TestOpenSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.sqlite")
+
+	db, err := OpenSQLite(path)
+	require.NoError(t, err)
+
+	files, err := sqliteSchemaFiles()
+	require.NoError(t, err)
+
+	var version int
+	require.NoError(t, db.QueryRow("PRAGMA user_version").Scan(&version))
+	assert.Equal(t, len(files), version)
+	require.NoError(t, db.Close())
+
+	db, err = OpenSQLite(path)
+	require.NoError(t, err, "reopening an up to date database must not fail")
+	require.NoError(t, db.Close())
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	s, _ := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	t.Run("create user", func(t *testing.T) {
+		created, err := s.CreateUser(ctx, user1)
+		require.NoError(t, err)
+		assert.Equal(t, user1, untimed(created))
+		assert.False(t, created.CreatedAt.IsZero())
+
+		_, err = s.CreateUser(ctx, user2)
+		require.NoError(t, err)
+		_, err = s.CreateUser(ctx, user3)
+		require.NoError(t, err)
+
+		_, err = s.CreateUser(ctx, user1)
+		assert.Equal(t, UserAlreadyExistsErr, err)
+	})
+
+	t.Run("user", func(t *testing.T) {
+		usr, err := s.User(ctx, user1.UserId)
+		assert.NoError(t, err)
+		assert.Equal(t, user1, untimed(usr))
+
+		_, err = s.User(ctx, "00000000-0000-0000-0000-000000000000")
+		assert.Equal(t, UserNotFoundErr, err)
+	})
+
+	t.Run("users", func(t *testing.T) {
+		filter := configuration.UsersFilter{
+			Sort: []configuration.UsersSort{
+				{Field: configuration.SortFieldAge, Direction: configuration.SortDirectionDesc},
+			},
+		}
+
+		page1, err := s.Users(ctx, filter, 2, "")
+		require.NoError(t, err)
+		assert.Equal(t, []User{user3, user1}, untimedUsers(page1.Users))
+
+		page2, err := s.Users(ctx, filter, 2, page1.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, UsersResponse{Users: []User{user2}}, untimedResponse(page2))
+
+		filtered, err := s.Users(ctx, configuration.UsersFilter{NamePrefix: "jo", AgeMin: 30}, 10, "")
+		require.NoError(t, err)
+		assert.Equal(t, []User{user1}, untimedUsers(filtered.Users))
+	})
+
+	t.Run("update user", func(t *testing.T) {
+		updated, err := s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Name: stringPtr("John Updated"), Age: intPtr(43)})
+		require.NoError(t, err)
+		assert.Equal(t, User{UserId: user1.UserId, Name: "John Updated", Age: 43, Version: 2}, untimed(updated))
+
+		usr, err := s.User(ctx, user1.UserId)
+		assert.NoError(t, err)
+		assert.Equal(t, updated, usr)
+
+		updated, err = s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Name: stringPtr("John Updated"), Age: intPtr(44), Version: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, updated.Version)
+
+		updated, err = s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Age: intPtr(50)})
+		require.NoError(t, err)
+		assert.Equal(t, User{UserId: user1.UserId, Name: "John Updated", Age: 50, Version: 4}, untimed(updated))
+
+		_, err = s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Name: stringPtr("John Updated"), Age: intPtr(45), Version: 2})
+		assert.Equal(t, UserVersionMismatchErr, err)
+
+		_, err = s.UpdateUser(ctx, UserPatch{UserId: "00000000-0000-0000-0000-000000000000", Name: stringPtr("Nobody"), Age: intPtr(1)})
+		assert.Equal(t, UserNotFoundErr, err)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		require.NoError(t, s.DeleteUser(ctx, user1.UserId))
+
+		assert.Equal(t, UserNotFoundErr, s.DeleteUser(ctx, user1.UserId))
+		_, err := s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Name: stringPtr("John Doe"), Age: intPtr(1)})
+		assert.Equal(t, UserNotFoundErr, err)
+		_, err = s.CreateUser(ctx, user1)
+		assert.Equal(t, UserAlreadyExistsErr, err)
+
+		_, err = s.User(ctx, user1.UserId)
+		assert.Equal(t, UserNotFoundErr, err)
+
+		deleted, err := s.Users(ctx, configuration.UsersFilter{Deleted: true}, 10, "")
+		require.NoError(t, err)
+		require.Len(t, deleted.Users, 1)
+		assert.Equal(t, user1.UserId, deleted.Users[0].UserId)
+		assert.NotNil(t, deleted.Users[0].DeletedAt)
+	})
+
+	t.Run("restore user", func(t *testing.T) {
+		require.NoError(t, s.RestoreUser(ctx, user1.UserId))
+
+		assert.Equal(t, UserNotFoundErr, s.RestoreUser(ctx, user1.UserId))
+
+		usr, err := s.User(ctx, user1.UserId)
+		assert.NoError(t, err)
+		assert.Nil(t, usr.DeletedAt)
+	})
+
+	t.Run("user history", func(t *testing.T) {
+		history, err := s.UserHistory(ctx, user1.UserId, 10, "")
+		require.NoError(t, err)
+
+		operations := make([]string, 0, len(history.History))
+		for _, change := range history.History {
+			operations = append(operations, change.Operation)
+			assert.Equal(t, AnonymousPrincipal, change.Principal)
+			assert.False(t, change.ChangedAt.IsZero())
+		}
+		assert.Equal(t, []string{OperationRestore, OperationDelete, OperationUpdate, OperationUpdate, OperationUpdate, OperationCreate}, operations)
+
+		assert.Equal(t, &user1, untimedPtr(history.History[5].After))
+		assert.Equal(t, 43, history.History[4].After.Age)
+		assert.NotNil(t, history.History[1].After.DeletedAt)
+		assert.Nil(t, history.History[0].After.DeletedAt)
+
+		page, err := s.UserHistory(WithPrincipal(ctx, "support"), user1.UserId, 2, "")
+		require.NoError(t, err)
+		assert.Equal(t, history.History[:2], page.History)
+
+		page, err = s.UserHistory(ctx, user1.UserId, 10, page.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, history.History[2:], page.History)
+	})
+
+	t.Run("purge users", func(t *testing.T) {
+		require.NoError(t, s.DeleteUser(ctx, user2.UserId))
+
+		purged, err := s.PurgeUsers(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), purged)
+
+		purged, err = s.PurgeUsers(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+
+		assert.Equal(t, UserNotFoundErr, s.RestoreUser(ctx, user2.UserId))
+	})
+}
+
+func TestSQLiteStorage_CreateUsers(t *testing.T) {
+	s, _ := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	_, err := s.CreateUser(ctx, user1)
+	require.NoError(t, err)
+
+	errs, err := s.CreateUsers(ctx, []User{user1, user2}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []error{UserAlreadyExistsErr, nil}, errs)
+
+	_, err = s.User(ctx, user2.UserId)
+	assert.Equal(t, UserNotFoundErr, err)
+
+	history, err := s.UserHistory(ctx, user2.UserId, 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, history.History)
+
+	errs, err = s.CreateUsers(ctx, []User{user1, user2}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []error{UserAlreadyExistsErr, nil}, errs)
+
+	usr, err := s.User(ctx, user2.UserId)
+	assert.NoError(t, err)
+	assert.Equal(t, user2, untimed(usr))
+
+	history, err = s.UserHistory(ctx, user2.UserId, 10, "")
+	require.NoError(t, err)
+	require.Len(t, history.History, 1)
+	assert.Equal(t, OperationCreate, history.History[0].Operation)
+}
+
+func TestSQLiteStorage_PutUser(t *testing.T) {
+	s, _ := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	usr, created, err := s.PutUser(ctx, user1)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, user1, untimed(usr))
+
+	usr, created, err = s.PutUser(ctx, User{UserId: user1.UserId, Name: "John Replaced", Age: 50})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, User{UserId: user1.UserId, Name: "John Replaced", Age: 50, Version: 2}, untimed(usr))
+
+	history, err := s.UserHistory(ctx, user1.UserId, 10, "")
+	require.NoError(t, err)
+	require.Len(t, history.History, 2)
+	assert.Equal(t, OperationUpdate, history.History[0].Operation)
+	assert.Equal(t, &user1, untimedPtr(history.History[0].Before))
+
+	require.NoError(t, s.DeleteUser(ctx, user1.UserId))
+	_, _, err = s.PutUser(ctx, user1)
+	assert.Equal(t, UserDeletedErr, err)
+}
+
+func TestSQLiteStorage_ImportUsers(t *testing.T) {
+	s, _ := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	_, err := s.CreateUser(ctx, user1)
+	require.NoError(t, err)
+
+	deleted := User{UserId: "8b0d7d7e-2b43-4c5e-9c55-1f0c7a4f1f0e", Name: "Jane Gone", Age: 30}
+	_, err = s.CreateUser(ctx, deleted)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteUser(ctx, deleted.UserId))
+
+	users := []User{
+		{UserId: user1.UserId, Name: "John Imported", Age: 43},
+		user2,
+		deleted,
+	}
+	expResults := []ImportResult{{Created: false}, {Created: true}, {Err: UserDeletedErr}}
+
+	results, err := s.ImportUsers(ctx, users, true)
+	require.NoError(t, err)
+	assert.Equal(t, expResults, results)
+
+	_, err = s.User(ctx, user2.UserId)
+	assert.Equal(t, UserNotFoundErr, err)
+
+	results, err = s.ImportUsers(ctx, users, false)
+	require.NoError(t, err)
+	assert.Equal(t, expResults, results)
+
+	usr, err := s.User(ctx, user1.UserId)
+	require.NoError(t, err)
+	assert.Equal(t, User{UserId: user1.UserId, Name: "John Imported", Age: 43, Version: 2}, untimed(usr))
+
+	usr, err = s.User(ctx, user2.UserId)
+	require.NoError(t, err)
+	assert.Equal(t, user2, untimed(usr))
+}
+
+func TestSQLiteStorage_SearchUsers(t *testing.T) {
+	s, _ := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	for _, usr := range []User{user1, user2} {
+		_, err := s.CreateUser(ctx, usr)
+		require.NoError(t, err)
+	}
+
+	users, err := s.SearchUsers(ctx, "jon doe", 10, "")
+	require.NoError(t, err)
+	require.Len(t, users.Users, 1)
+	assert.Empty(t, users.NextCursor)
+	assert.Equal(t, user1, untimed(users.Users[0].User))
+	assert.InDelta(t, 6.0/11, users.Users[0].Score, 1e-9)
+
+	users, err = s.SearchUsers(ctx, "brave", 10, "")
+	require.NoError(t, err)
+	require.Len(t, users.Users, 1)
+	assert.Equal(t, user2, untimed(users.Users[0].User))
+	assert.Equal(t, 1.0, users.Users[0].Score)
+}
+
+func TestSQLiteStorage_UsersStats(t *testing.T) {
+	s, db := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	for _, usr := range []User{user1, user2, user3} {
+		_, err := s.CreateUser(ctx, usr)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.DeleteUser(ctx, user3.UserId))
+
+	_, err := db.Exec(`UPDATE "users" SET "created_at" = '2022-03-20 12:00:00.000' WHERE "user_id" = ?`, user1.UserId)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE "users" SET "created_at" = '2022-03-14 08:00:00.000' WHERE "user_id" = ?`, user2.UserId)
+	require.NoError(t, err)
+
+	stats, err := s.UsersStats(ctx, []int{18, 30}, configuration.StatsPeriodWeek)
+
+	require.NoError(t, err)
+	assert.Equal(t, UsersStats{
+		Total: 2,
+		Age: AgeStats{
+			Min:  intPtr(20),
+			Max:  intPtr(42),
+			Mean: float64Ptr(31),
+			Histogram: []AgeBucket{
+				{From: 0, To: intPtr(18), Count: 0},
+				{From: 18, To: intPtr(30), Count: 1},
+				{From: 30, Count: 1},
+			},
+		},
+		Created: []PeriodCount{{Period: time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC), Count: 2}},
+	}, stats)
+
+	for period, exp := range map[string][]PeriodCount{
+		configuration.StatsPeriodDay: {
+			{Period: time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC), Count: 1},
+			{Period: time.Date(2022, 3, 20, 0, 0, 0, 0, time.UTC), Count: 1},
+		},
+		configuration.StatsPeriodMonth: {{Period: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), Count: 2}},
+		configuration.StatsPeriodYear:  {{Period: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Count: 2}},
+	} {
+		stats, err := s.UsersStats(ctx, configuration.DefaultAgeBuckets, period)
+		require.NoError(t, err)
+		assert.Equal(t, exp, stats.Created, period)
+	}
+}
+
+func TestSQLiteStorage_RelayEvents(t *testing.T) {
+	s, db := newSQLiteStorage(t)
+	ctx := WithPrincipal(context.Background(), "support")
+
+	_, err := s.CreateUser(ctx, user1)
+	require.NoError(t, err)
+	_, err = s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Age: intPtr(43)})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteUser(ctx, user1.UserId))
+
+	outbox := s.(EventOutbox)
+	publishErr := errors.New("webhook unavailable")
+
+	var types []string
+	published, err := outbox.RelayEvents(ctx, 2, 10, func(evt Event) error {
+		if evt.Type == EventUserUpdated {
+			return publishErr
+		}
+
+		assert.Equal(t, user1.UserId, evt.UserId)
+		assert.Equal(t, "support", evt.Principal)
+		assert.Equal(t, user1, untimed(*evt.After))
+		assert.WithinDuration(t, time.Now(), evt.OccurredAt, time.Minute)
+
+		types = append(types, evt.Type)
+		return nil
+	})
+	assert.Equal(t, publishErr, err)
+	assert.Equal(t, 1, published)
+
+	var (
+		attempts  int
+		lastError string
+	)
+	require.NoError(t, db.QueryRow(`SELECT "attempts", "last_error" FROM "user_outbox" WHERE "event_type" = ?`, EventUserUpdated).Scan(&attempts, &lastError))
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, publishErr.Error(), lastError)
+
+	published, err = outbox.RelayEvents(ctx, 10, 10, func(evt Event) error {
+		types = append(types, evt.Type)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []string{EventUserCreated, EventUserUpdated, EventUserDeleted}, types)
+
+	var pending int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM "user_outbox"`).Scan(&pending))
+	assert.Equal(t, 0, pending)
+}
+
+func TestSQLiteStorage_timestamps(t *testing.T) {
+	s, _ := newSQLiteStorage(t)
+	ctx := context.Background()
+
+	created, err := s.CreateUser(ctx, user1)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), created.CreatedAt, time.Minute)
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	time.Sleep(5 * time.Millisecond)
+
+	updated, err := s.UpdateUser(ctx, UserPatch{UserId: user1.UserId, Age: intPtr(43)})
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.True(t, updated.UpdatedAt.After(created.UpdatedAt))
+
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, s.DeleteUser(ctx, user1.UserId))
+	deleted, err := s.Users(ctx, configuration.UsersFilter{Deleted: true}, 10, "")
+	require.NoError(t, err)
+	require.Len(t, deleted.Users, 1)
+	assert.Equal(t, *deleted.Users[0].DeletedAt, deleted.Users[0].UpdatedAt)
+	assert.Equal(t, created.CreatedAt, deleted.Users[0].CreatedAt)
+}
+
+func Test_classifySQLiteErr(t *testing.T) {
+	assert.ErrorIs(t, classifySQLiteErr(sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}), UniqueViolationErr)
+	assert.ErrorIs(t, classifySQLiteErr(sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}), UniqueViolationErr)
+	assert.ErrorIs(t, classifySQLiteErr(sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintCheck}), CheckViolationErr)
+
+	notNullErr := sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintNotNull}
+	assert.Equal(t, notNullErr, classifySQLiteErr(notNullErr))
+	assert.Equal(t, databaseError, classifySQLiteErr(databaseError))
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"app/internal/configuration"
+)
+
+type UsersStats struct {
+	Total   int64         `json:"total"`
+	Age     AgeStats      `json:"age"`
+	Created []PeriodCount `json:"created"`
+}
+
+type AgeStats struct {
+	Min       *int        `json:"min"`
+	Max       *int        `json:"max"`
+	Mean      *float64    `json:"mean"`
+	Histogram []AgeBucket `json:"histogram"`
+}
+
+type AgeBucket struct {
+	From  int   `json:"from"`
+	To    *int  `json:"to,omitempty"`
+	Count int64 `json:"count"`
+}
+
+type PeriodCount struct {
+	Period time.Time `json:"period"`
+	Count  int64     `json:"count"`
+}
+
+func (st *storage) UsersStats(ctx context.Context, ageBuckets []int, period string) (UsersStats, error) {
+	var stats UsersStats
+
+	err := st.read(ctx, func(db *sql.DB) error {
+		var err error
+		stats, err = st.queryUsersStats(ctx, db, ageBuckets, period)
+		return err
+	})
+	if err != nil {
+		return UsersStats{}, err
+	}
+
+	return stats, nil
+}
+
+func (st *storage) queryUsersStats(ctx context.Context, db *sql.DB, ageBuckets []int, period string) (UsersStats, error) {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	stats := UsersStats{
+		Age:     AgeStats{Histogram: newAgeHistogram(ageBuckets)},
+		Created: make([]PeriodCount, 0),
+	}
+
+	var (
+		minAge  sql.NullInt64
+		maxAge  sql.NullInt64
+		meanAge sql.NullFloat64
+	)
+
+	if err := db.QueryRowContext(stmtCtx, st.dialect.selectUsersSummarySQL).Scan(&stats.Total, &minAge, &maxAge, &meanAge); err != nil {
+		return UsersStats{}, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	if minAge.Valid {
+		minValue, maxValue := int(minAge.Int64), int(maxAge.Int64)
+		stats.Age.Min = &minValue
+		stats.Age.Max = &maxValue
+		stats.Age.Mean = &meanAge.Float64
+	}
+
+	query, args := buildAgeHistogramQuery(st.dialect, ageBuckets)
+
+	err := st.eachRow(ctx, stmtCtx, db, query, args, func(rows *sql.Rows) error {
+		var (
+			bucket int
+			count  int64
+		)
+
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return err
+		}
+
+		stats.Age.Histogram[bucket].Count = count
+
+		return nil
+	})
+	if err != nil {
+		return UsersStats{}, err
+	}
+
+	err = st.eachRow(ctx, stmtCtx, db, st.dialect.selectUsersCreatedSQL, []interface{}{period}, func(rows *sql.Rows) error {
+		var (
+			start string
+			count int64
+		)
+
+		if err := rows.Scan(&start, &count); err != nil {
+			return err
+		}
+
+		periodStart, err := time.Parse(time.RFC3339Nano, start)
+		if err != nil {
+			return err
+		}
+
+		stats.Created = append(stats.Created, PeriodCount{Period: periodStart.UTC(), Count: count})
+
+		return nil
+	})
+	if err != nil {
+		return UsersStats{}, err
+	}
+
+	return stats, nil
+}
+
+func (st *storage) eachRow(ctx context.Context, stmtCtx context.Context, db *sql.DB, query string, args []interface{}, fn func(rows *sql.Rows) error) error {
+	rows, err := db.QueryContext(stmtCtx, query, args...)
+	if err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return st.statementErr(ctx, stmtCtx, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return nil
+}
+
+func buildAgeHistogramQuery(d *dialect, ageBuckets []int) (string, []interface{}) {
+	args := make([]interface{}, 0, len(ageBuckets))
+
+	var sb strings.Builder
+	sb.WriteString("CASE")
+
+	for i, bound := range ageBuckets {
+		args = append(args, bound)
+		sb.WriteString(fmt.Sprintf("\n        WHEN \"age\" < %s THEN %d", d.placeholder(len(args)), i))
+	}
+
+	sb.WriteString(fmt.Sprintf("\n        ELSE %d\n    END", len(ageBuckets)))
+
+	return fmt.Sprintf(strings.TrimSpace(d.selectUsersAgeHistogramSQL), sb.String()), args
+}
+
+func newAgeHistogram(ageBuckets []int) []AgeBucket {
+	histogram := make([]AgeBucket, 0, len(ageBuckets)+1)
+
+	from := 0
+	for _, bound := range ageBuckets {
+		to := bound
+		histogram = append(histogram, AgeBucket{From: from, To: &to})
+		from = bound
+	}
+
+	return append(histogram, AgeBucket{From: from})
+}
+
+func ageBucket(age int, ageBuckets []int) int {
+	for i, bound := range ageBuckets {
+		if age < bound {
+			return i
+		}
+	}
+
+	return len(ageBuckets)
+}
+
+func truncatePeriod(t time.Time, period string) time.Time {
+	year, month, day := t.UTC().Date()
+
+	switch period {
+	case configuration.StatsPeriodDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case configuration.StatsPeriodWeek:
+		start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	case configuration.StatsPeriodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
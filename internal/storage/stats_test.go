@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"app/internal/configuration"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_UsersStats(t *testing.T) {
+	ageBuckets := []int{18, 30}
+	histogramSQL, _ := buildAgeHistogramQuery(postgresDialect, ageBuckets)
+	period := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSummarySQL)).
+			WillReturnRows(sqlmock.NewRows([]string{"count", "min", "max", "avg"}).AddRow(3, 20, 42, 34.5))
+		mock.ExpectQuery(regexp.QuoteMeta(histogramSQL)).WithArgs(18, 30).
+			WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).AddRow(1, 1).AddRow(2, 2))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersCreatedSQL)).WithArgs(configuration.StatsPeriodMonth).
+			WillReturnRows(sqlmock.NewRows([]string{"period", "count"}).AddRow(period, 3))
+
+		s := NewUserStorage(db, time.Second)
+
+		stats, err := s.UsersStats(context.Background(), ageBuckets, configuration.StatsPeriodMonth)
+
+		assert.NoError(t, err)
+		assert.Equal(t, UsersStats{
+			Total: 3,
+			Age: AgeStats{
+				Min:  intPtr(20),
+				Max:  intPtr(42),
+				Mean: float64Ptr(34.5),
+				Histogram: []AgeBucket{
+					{From: 0, To: intPtr(18), Count: 0},
+					{From: 18, To: intPtr(30), Count: 1},
+					{From: 30, Count: 2},
+				},
+			},
+			Created: []PeriodCount{{Period: period, Count: 3}},
+		}, stats)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok empty", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSummarySQL)).
+			WillReturnRows(sqlmock.NewRows([]string{"count", "min", "max", "avg"}).AddRow(0, nil, nil, nil))
+		mock.ExpectQuery(regexp.QuoteMeta(histogramSQL)).WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersCreatedSQL)).WillReturnRows(sqlmock.NewRows([]string{"period", "count"}))
+
+		s := NewUserStorage(db, time.Second)
+
+		stats, err := s.UsersStats(context.Background(), ageBuckets, configuration.StatsPeriodMonth)
+
+		assert.NoError(t, err)
+		assert.Equal(t, UsersStats{
+			Age: AgeStats{
+				Histogram: []AgeBucket{
+					{From: 0, To: intPtr(18)},
+					{From: 18, To: intPtr(30)},
+					{From: 30},
+				},
+			},
+			Created: []PeriodCount{},
+		}, stats)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSummarySQL)).
+			WillReturnRows(sqlmock.NewRows([]string{"count", "min", "max", "avg"}).AddRow(3, 20, 42, 34.5))
+		mock.ExpectQuery(regexp.QuoteMeta(histogramSQL)).WillReturnError(databaseError)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UsersStats(context.Background(), ageBuckets, configuration.StatsPeriodMonth)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_buildAgeHistogramQuery(t *testing.T) {
+	query, args := buildAgeHistogramQuery(postgresDialect, []int{18, 65})
+
+	assert.Equal(t, `SELECT
+    CASE
+        WHEN "age" < $1 THEN 0
+        WHEN "age" < $2 THEN 1
+        ELSE 2
+    END AS "bucket",
+    count(*)
+FROM
+    "user_service"."users"
+WHERE
+    "deleted_at" IS NULL
+GROUP BY
+    "bucket"
+ORDER BY
+    "bucket";`, query)
+	assert.Equal(t, []interface{}{18, 65}, args)
+}
+
+func Test_truncatePeriod(t *testing.T) {
+	createdAt := time.Date(2022, 3, 17, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	assert.Equal(t, time.Date(2022, 3, 17, 0, 0, 0, 0, time.UTC), truncatePeriod(createdAt, configuration.StatsPeriodDay))
+	assert.Equal(t, time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC), truncatePeriod(createdAt, configuration.StatsPeriodWeek))
+	assert.Equal(t, time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC), truncatePeriod(time.Date(2022, 3, 20, 12, 0, 0, 0, time.UTC), configuration.StatsPeriodWeek))
+	assert.Equal(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), truncatePeriod(createdAt, configuration.StatsPeriodMonth))
+	assert.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), truncatePeriod(createdAt, configuration.StatsPeriodYear))
+}
@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
+	"encoding/json"
 	"errors"
-	"strings"
+	"time"
+
+	"app/internal/configuration"
 )
 
 var (
@@ -14,132 +18,629 @@ var (
 	selectUserSQL string
 	//go:embed queries/insert_user_query.sql
 	insertUserSQL string
+	//go:embed queries/insert_user_if_absent_query.sql
+	insertUserIfAbsentSQL string
+	//go:embed queries/upsert_user_query.sql
+	upsertUserSQL string
 	//go:embed queries/update_user_query.sql
 	updateUserSQL string
 	//go:embed queries/delete_user_query.sql
 	deleteUserSQL string
+	//go:embed queries/restore_user_query.sql
+	restoreUserSQL string
+	//go:embed queries/purge_users_query.sql
+	purgeUsersSQL string
+	//go:embed queries/select_user_for_update_query.sql
+	selectUserForUpdateSQL string
+	//go:embed queries/select_users_deleted_query.sql
+	selectUsersDeletedSQL string
+	//go:embed queries/insert_user_history_query.sql
+	insertUserHistorySQL string
+	//go:embed queries/select_user_history_query.sql
+	selectUserHistorySQL string
+	//go:embed queries/search_users_query.sql
+	searchUsersSQL string
+	//go:embed queries/select_users_summary_query.sql
+	selectUsersSummarySQL string
+	//go:embed queries/select_users_age_histogram_query.sql
+	selectUsersAgeHistogramSQL string
+	//go:embed queries/select_users_created_query.sql
+	selectUsersCreatedSQL string
+	//go:embed queries/insert_user_event_query.sql
+	insertUserEventSQL string
+	//go:embed queries/lock_user_outbox_query.sql
+	lockUserOutboxSQL string
+	//go:embed queries/unlock_user_outbox_query.sql
+	unlockUserOutboxSQL string
+	//go:embed queries/select_user_events_query.sql
+	selectUserEventsSQL string
+	//go:embed queries/delete_user_event_query.sql
+	deleteUserEventSQL string
+	//go:embed queries/fail_user_event_query.sql
+	failUserEventSQL string
 )
 
+const exportPageSize = 500
+
 type UserStorage interface {
-	Users() ([]User, error)
-	User(userId string) (User, error)
-	CreateUser(usr User) error
-	UpdateUser(usr User) error
-	DeleteUser(userId string) error
+	Users(ctx context.Context, filter configuration.UsersFilter, limit int, cursor string) (UsersResponse, error)
+	ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error
+	User(ctx context.Context, userId string) (User, error)
+	CreateUser(ctx context.Context, usr User) (User, error)
+	CreateUsers(ctx context.Context, users []User, atomic bool) ([]error, error)
+	UpdateUser(ctx context.Context, patch UserPatch) (User, error)
+	PutUser(ctx context.Context, usr User) (User, bool, error)
+	ImportUsers(ctx context.Context, users []User, dryRun bool) ([]ImportResult, error)
+	DeleteUser(ctx context.Context, userId string) error
+	RestoreUser(ctx context.Context, userId string) error
+	PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	SearchUsers(ctx context.Context, query string, limit int, cursor string) (SearchUsersResponse, error)
+	UsersStats(ctx context.Context, ageBuckets []int, period string) (UsersStats, error)
+	UserHistory(ctx context.Context, userId string, limit int, cursor string) (UserHistoryResponse, error)
 }
 
 var (
-	UserAlreadyExistsErr = errors.New("user already exists")
-	UserNotFoundErr      = errors.New("user not found")
+	UserAlreadyExistsErr   = errors.New("user already exists")
+	UserNotFoundErr        = errors.New("user not found")
+	UserVersionMismatchErr = errors.New("user version mismatch")
+	UserDeletedErr         = errors.New("user is deleted")
+	StatementTimeoutErr    = errors.New("statement timeout")
+
+	rollbackErr = errors.New("rollback")
 )
 
 type User struct {
-	UserId string `json:"user_id"`
-	Name   string `json:"name"`
-	Age    int    `json:"age"`
+	UserId    string     `json:"user_id"`
+	Name      string     `json:"name"`
+	Age       int        `json:"age"`
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type ImportResult struct {
+	Created bool
+	Err     error
+}
+
+type UserPatch struct {
+	UserId  string
+	Name    *string
+	Age     *int
+	Version int
 }
 
 type UsersResponse struct {
-	Users []User `json:"users"`
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type storage struct {
-	db *sql.DB
+	db               *sql.DB
+	replica          *replica
+	dialect          *dialect
+	statementTimeout time.Duration
+	eventsDisabled   bool
 }
 
-func NewUserStorage(db *sql.DB) UserStorage {
+func NewUserStorage(db *sql.DB, statementTimeout time.Duration) UserStorage {
 	return &storage{
-		db: db,
+		db:               db,
+		dialect:          postgresDialect,
+		statementTimeout: statementTimeout,
+	}
+}
+
+func (st *storage) Users(ctx context.Context, filter configuration.UsersFilter, limit int, cursor string) (UsersResponse, error) {
+	sortKeys := filter.SortKeys()
+
+	after, err := decodeCursor(cursor, sortKeys)
+	if err != nil {
+		return UsersResponse{}, err
+	}
+
+	query, args := buildUsersQuery(st.dialect, filter, after, limit+1)
+
+	var users []User
+
+	err = st.read(ctx, func(db *sql.DB) error {
+		users, err = st.queryUsers(ctx, db, query, args...)
+		return err
+	})
+	if err != nil {
+		return UsersResponse{}, err
+	}
+
+	var nextCursor string
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = encodeCursor(users[limit-1], sortKeys)
+	}
+
+	return UsersResponse{Users: users, NextCursor: nextCursor}, nil
+}
+
+func (st *storage) ExportUsers(ctx context.Context, filter configuration.UsersFilter, fn func(usr User) error) error {
+	var after usersCursor
+
+	for {
+		query, args := buildUsersQuery(st.dialect, filter, after, exportPageSize)
+
+		var users []User
+
+		err := st.read(ctx, func(db *sql.DB) error {
+			var err error
+			users, err = st.queryUsers(ctx, db, query, args...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, usr := range users {
+			if err := fn(usr); err != nil {
+				return err
+			}
+		}
+
+		if len(users) < exportPageSize {
+			return nil
+		}
+
+		last := users[len(users)-1]
+		after = usersCursor{UserId: last.UserId, Name: last.Name, Age: last.Age}
 	}
 }
 
-func (st *storage) Users() ([]User, error) {
+func (st *storage) queryUsers(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]User, error) {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
 	users := make([]User, 0)
 
-	rows, err := st.db.Query(selectUsersSQL)
+	err := st.eachUser(ctx, stmtCtx, db, query, args, func(usr User) error {
+		users = append(users, usr)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return users, nil
+}
+
+func (st *storage) eachUser(ctx context.Context, stmtCtx context.Context, db *sql.DB, query string, args []interface{}, fn func(usr User) error) error {
+	rows, err := db.QueryContext(stmtCtx, query, args...)
+	if err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var usr User
+		usr, err := scanUser(rows)
+		if err != nil {
+			return st.statementErr(ctx, stmtCtx, err)
+		}
 
-		if err := rows.Scan(
-			&usr.UserId,
-			&usr.Name,
-			&usr.Age,
-		); err != nil {
-			return nil, err
+		if err := fn(usr); err != nil {
+			return err
 		}
+	}
 
-		users = append(users, usr)
+	if err := rows.Err(); err != nil {
+		return st.statementErr(ctx, stmtCtx, err)
 	}
 
-	return users, err
+	return nil
 }
 
-func (st *storage) User(userId string) (User, error) {
-	row := st.db.QueryRow(selectUserSQL, userId)
-
+func (st *storage) User(ctx context.Context, userId string) (User, error) {
 	var usr User
 
-	if err := row.Scan(
-		&usr.UserId,
-		&usr.Name,
-		&usr.Age,
-	); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, UserNotFoundErr
+	err := st.read(ctx, func(db *sql.DB) error {
+		stmtCtx, cancel := st.statementContext(ctx)
+		defer cancel()
+
+		var err error
+		usr, err = scanUser(db.QueryRowContext(stmtCtx, st.dialect.selectUserSQL, userId))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return UserNotFoundErr
+			}
+
+			return st.statementErr(ctx, stmtCtx, err)
 		}
 
+		return nil
+	})
+	if err != nil {
 		return User{}, err
 	}
 
 	return usr, nil
 }
 
-func (st *storage) CreateUser(usr User) error {
-	if _, err := st.db.Exec(insertUserSQL, usr.UserId, usr.Name, usr.Age); err != nil {
-		if AlreadyExistsErr(err) {
-			return UserAlreadyExistsErr
+func (st *storage) CreateUser(ctx context.Context, usr User) (User, error) {
+	var created User
+
+	err := st.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+
+		created, err = st.queryUser(ctx, tx, st.dialect.insertUserSQL, usr.UserId, usr.Name, usr.Age)
+		if err != nil {
+			if errors.Is(err, UniqueViolationErr) {
+				return UserAlreadyExistsErr
+			}
+
+			return err
 		}
 
-		return err
+		return st.recordChange(ctx, tx, OperationCreate, nil, &created)
+	})
+	if err != nil {
+		return User{}, err
 	}
 
-	return nil
+	return created, nil
 }
 
-func (st *storage) UpdateUser(usr User) error {
-	res, err := st.db.Exec(updateUserSQL, usr.UserId, usr.Name, usr.Age)
+func (st *storage) CreateUsers(ctx context.Context, users []User, atomic bool) ([]error, error) {
+	errs := make([]error, len(users))
+
+	err := st.inTx(ctx, func(tx *sql.Tx) error {
+		conflict := false
+
+		for i, usr := range users {
+			created, err := st.queryUser(ctx, tx, st.dialect.insertUserIfAbsentSQL, usr.UserId, usr.Name, usr.Age)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					errs[i] = UserAlreadyExistsErr
+					conflict = true
+					continue
+				}
+
+				return err
+			}
+
+			if err := st.recordChange(ctx, tx, OperationCreate, nil, &created); err != nil {
+				return err
+			}
+		}
+
+		if atomic && conflict {
+			return rollbackErr
+		}
+
+		return nil
+	})
+	if err != nil && err != rollbackErr {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+func (st *storage) UpdateUser(ctx context.Context, patch UserPatch) (User, error) {
+	var updated User
+
+	err := st.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := st.lockUser(ctx, tx, patch.UserId)
+		if err != nil {
+			return err
+		}
+
+		if current.DeletedAt != nil {
+			return UserNotFoundErr
+		}
+
+		if patch.Version != 0 && patch.Version != current.Version {
+			return UserVersionMismatchErr
+		}
+
+		updated, err = st.queryUser(ctx, tx, st.dialect.updateUserSQL, patch.UserId, patch.Name, patch.Age, patch.Version)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return UserVersionMismatchErr
+			}
+
+			return err
+		}
+
+		return st.recordChange(ctx, tx, OperationUpdate, &current, &updated)
+	})
 	if err != nil {
-		return err
+		return User{}, err
 	}
 
-	if rowsAffected, err := res.RowsAffected(); err != nil {
+	return updated, nil
+}
+
+func (st *storage) PutUser(ctx context.Context, usr User) (User, bool, error) {
+	var (
+		put     User
+		created bool
+	)
+
+	err := st.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		put, created, err = st.putUser(ctx, tx, usr)
 		return err
-	} else if rowsAffected == 0 {
-		return UserNotFoundErr
+	})
+	if err != nil {
+		return User{}, false, err
 	}
 
-	return nil
+	return put, created, nil
 }
 
-func (st *storage) DeleteUser(userId string) error {
-	res, err := st.db.Exec(deleteUserSQL, userId)
+func (st *storage) ImportUsers(ctx context.Context, users []User, dryRun bool) ([]ImportResult, error) {
+	if dryRun {
+		return st.previewImport(ctx, users)
+	}
+
+	results := make([]ImportResult, len(users))
+
+	err := st.inTx(ctx, func(tx *sql.Tx) error {
+		for i, usr := range users {
+			_, created, err := st.putUser(ctx, tx, usr)
+			if err != nil {
+				if err == UserDeletedErr {
+					results[i].Err = err
+					continue
+				}
+
+				return err
+			}
+
+			results[i].Created = created
+		}
+
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (st *storage) previewImport(ctx context.Context, users []User) ([]ImportResult, error) {
+	userIds := make([]string, len(users))
+	for i, usr := range users {
+		userIds[i] = usr.UserId
+	}
+
+	userIdsJSON, _ := json.Marshal(userIds)
+
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	rows, err := st.db.QueryContext(stmtCtx, st.dialect.selectUsersDeletedSQL, string(userIdsJSON))
+	if err != nil {
+		return nil, st.statementErr(ctx, stmtCtx, err)
+	}
+	defer rows.Close()
+
+	deleted := make(map[string]bool, len(users))
+
+	for rows.Next() {
+		var (
+			userId    string
+			isDeleted bool
+		)
+
+		if err := rows.Scan(&userId, &isDeleted); err != nil {
+			return nil, st.statementErr(ctx, stmtCtx, err)
+		}
+
+		deleted[userId] = isDeleted
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	results := make([]ImportResult, len(users))
+	for i, usr := range users {
+		isDeleted, ok := deleted[usr.UserId]
+		if isDeleted {
+			results[i].Err = UserDeletedErr
+		}
+
+		results[i].Created = !ok
+	}
+
+	return results, nil
+}
+
+func (st *storage) putUser(ctx context.Context, tx *sql.Tx, usr User) (User, bool, error) {
+	current, err := st.lockUser(ctx, tx, usr.UserId)
+	if err == UserNotFoundErr {
+		var created User
+		created, err = st.queryUser(ctx, tx, st.dialect.insertUserIfAbsentSQL, usr.UserId, usr.Name, usr.Age)
+		if err == nil {
+			return created, true, st.recordChange(ctx, tx, OperationCreate, nil, &created)
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			return User{}, false, err
+		}
+
+		current, err = st.lockUser(ctx, tx, usr.UserId)
+		if err == UserNotFoundErr {
+			return User{}, false, UserDeletedErr
+		}
+	}
+	if err != nil {
+		return User{}, false, err
+	}
+
+	if current.DeletedAt != nil {
+		return User{}, false, UserDeletedErr
+	}
+
+	put, err := st.queryUser(ctx, tx, st.dialect.upsertUserSQL, usr.UserId, usr.Name, usr.Age)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, false, UserDeletedErr
+		}
+
+		return User{}, false, err
 	}
 
-	if rowsAffected, err := res.RowsAffected(); err != nil {
+	return put, false, st.recordChange(ctx, tx, OperationUpdate, &current, &put)
+}
+
+func (st *storage) DeleteUser(ctx context.Context, userId string) error {
+	return st.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := st.lockUser(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+
+		if current.DeletedAt != nil {
+			return UserNotFoundErr
+		}
+
+		deleted, err := st.queryUser(ctx, tx, st.dialect.deleteUserSQL, userId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return UserNotFoundErr
+			}
+
+			return err
+		}
+
+		return st.recordChange(ctx, tx, OperationDelete, &current, &deleted)
+	})
+}
+
+func (st *storage) RestoreUser(ctx context.Context, userId string) error {
+	return st.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := st.lockUser(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+
+		if current.DeletedAt == nil {
+			return UserNotFoundErr
+		}
+
+		restored, err := st.queryUser(ctx, tx, st.dialect.restoreUserSQL, userId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return UserNotFoundErr
+			}
+
+			return err
+		}
+
+		return st.recordChange(ctx, tx, OperationRestore, &current, &restored)
+	})
+}
+
+func (st *storage) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	res, err := st.db.ExecContext(stmtCtx, st.dialect.purgeUsersSQL, deletedBefore.UTC())
+	if err != nil {
+		return 0, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return res.RowsAffected()
+}
+
+func (st *storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return st.dialect.classifyErr(err)
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		if errors.Is(err, ConnectionLostErr) {
+			return noRetry(err)
+		}
+
 		return err
-	} else if rowsAffected == 0 {
-		return UserNotFoundErr
+	}
+
+	if err := tx.Commit(); err != nil {
+		return noRetry(st.dialect.classifyErr(err))
 	}
 
 	return nil
 }
 
-func AlreadyExistsErr(err error) bool {
-	return strings.HasPrefix(err.Error(), "pq: duplicate key value violates unique constraint")
+func (st *storage) lockUser(ctx context.Context, tx *sql.Tx, userId string) (User, error) {
+	usr, err := st.queryUser(ctx, tx, st.dialect.selectUserForUpdateSQL, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, UserNotFoundErr
+		}
+
+		return User{}, err
+	}
+
+	return usr, nil
+}
+
+func (st *storage) queryUser(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (User, error) {
+	stmtCtx, cancel := st.statementContext(ctx)
+	defer cancel()
+
+	usr, err := scanUser(tx.QueryRowContext(stmtCtx, query, args...))
+	if err != nil {
+		return User{}, st.statementErr(ctx, stmtCtx, err)
+	}
+
+	return usr, nil
+}
+
+func (st *storage) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if st.statementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, st.statementTimeout)
+}
+
+func (st *storage) statementErr(ctx context.Context, stmtCtx context.Context, err error) error {
+	if ctx.Err() == nil && stmtCtx.Err() == context.DeadlineExceeded {
+		return StatementTimeoutErr
+	}
+
+	return st.dialect.classifyErr(err)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(s scanner) (User, error) {
+	var (
+		usr       User
+		deletedAt sql.NullTime
+	)
+
+	if err := s.Scan(
+		&usr.UserId,
+		&usr.Name,
+		&usr.Age,
+		&usr.Version,
+		&deletedAt,
+		&usr.CreatedAt,
+		&usr.UpdatedAt,
+	); err != nil {
+		return User{}, err
+	}
+
+	if deletedAt.Valid {
+		usr.DeletedAt = &deletedAt.Time
+	}
+
+	return usr, nil
 }
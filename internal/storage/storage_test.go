@@ -1,12 +1,16 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"regexp"
 	"testing"
+	"time"
 
+	"app/internal/configuration"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -14,26 +18,34 @@ import (
 var (
 	databaseError = errors.New("database error")
 
+	userColumns = []string{"user_id", "name", "age", "version", "deleted_at", "created_at", "updated_at"}
+
+	defaultSortKeys = []configuration.UsersSort{{Field: configuration.SortFieldUserId, Direction: configuration.SortDirectionAsc}}
+
 	user1 = User{
-		UserId: "7df661d5-47e3-4533-baa6-5f952d18bffe",
-		Name:   "John Doe",
-		Age:    42,
+		UserId:  "7df661d5-47e3-4533-baa6-5f952d18bffe",
+		Name:    "John Doe",
+		Age:     42,
+		Version: 1,
 	}
 
 	user2 = User{
-		UserId: "63df08d2-fa53-4575-a681-99058f8daba5",
-		Name:   "Josh Brave",
-		Age:    20,
+		UserId:  "63df08d2-fa53-4575-a681-99058f8daba5",
+		Name:    "Josh Brave",
+		Age:     20,
+		Version: 1,
 	}
 )
 
 func TestNewUserStorage(t *testing.T) {
 	db, _, _ := sqlmock.New()
 	expStorage := &storage{
-		db: db,
+		db:               db,
+		dialect:          postgresDialect,
+		statementTimeout: time.Second,
 	}
 
-	assert.Equal(t, expStorage, NewUserStorage(db))
+	assert.Equal(t, expStorage, NewUserStorage(db, time.Second))
 }
 
 func TestStorage_Users(t *testing.T) {
@@ -42,15 +54,33 @@ func TestStorage_Users(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "age"}).AddRow(user1.UserId, user1.Name, user1.Age).AddRow(user2.UserId, user2.Name, user2.Age)
-		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WithArgs(3).WillReturnRows(rows)
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		users, err := s.Users()
+		users, err := s.Users(context.Background(), configuration.UsersFilter{}, 2, "")
 
 		assert.NoError(t, err)
-		assert.Equal(t, []User{user1, user2}, users)
+		assert.Equal(t, UsersResponse{Users: []User{user1, user2}}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok next page", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WithArgs(user2.UserId, 2).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		users, err := s.Users(context.Background(), configuration.UsersFilter{}, 1, encodeCursor(user2, defaultSortKeys))
+
+		assert.NoError(t, err)
+		assert.Equal(t, UsersResponse{Users: []User{user1}, NextCursor: encodeCursor(user1, defaultSortKeys)}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("ok empty", func(t *testing.T) {
@@ -58,15 +88,28 @@ func TestStorage_Users(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "age"})
+		rows := sqlmock.NewRows(userColumns)
 		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		users, err := s.Users()
+		users, err := s.Users(context.Background(), configuration.UsersFilter{}, 2, "")
 
 		assert.NoError(t, err)
-		assert.Equal(t, []User{}, users)
+		assert.Equal(t, UsersResponse{Users: []User{}}, users)
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.Users(context.Background(), configuration.UsersFilter{}, 2, "xxx")
+
+		assert.Equal(t, InvalidCursorErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("scan error", func(t *testing.T) {
@@ -77,12 +120,28 @@ func TestStorage_Users(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "name"}).AddRow(user1.UserId, user1.Name)
 		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		res, err := s.Users()
+		res, err := s.Users(context.Background(), configuration.UsersFilter{}, 2, "")
 
 		assert.Error(t, err)
-		assert.Nil(t, res)
+		assert.Equal(t, UsersResponse{}, res)
+	})
+
+	t.Run("rows error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).RowError(0, databaseError)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		res, err := s.Users(context.Background(), configuration.UsersFilter{}, 2, "")
+
+		assert.Equal(t, databaseError, err)
+		assert.Equal(t, UsersResponse{}, res)
 	})
 
 	t.Run("database error", func(t *testing.T) {
@@ -91,12 +150,134 @@ func TestStorage_Users(t *testing.T) {
 		defer db.Close()
 
 		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnError(databaseError)
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		res, err := s.Users()
+		res, err := s.Users(context.Background(), configuration.UsersFilter{}, 2, "")
 
 		assert.Equal(t, databaseError, err)
-		assert.Nil(t, res)
+		assert.Equal(t, UsersResponse{}, res)
+	})
+}
+
+func TestStorage_ExportUsers(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WithArgs(exportPageSize).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		var users []User
+		err = s.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			users = append(users, usr)
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []User{user1, user2}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok paged", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns)
+		for i := 0; i < exportPageSize; i++ {
+			rows.AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WithArgs(exportPageSize).WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WithArgs(user1.UserId, exportPageSize).WillReturnRows(
+			sqlmock.NewRows(userColumns).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt),
+		)
+
+		s := NewUserStorage(db, time.Second)
+
+		exported := 0
+		err = s.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			exported++
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, exportPageSize+1, exported)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rows error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt).RowError(1, databaseError)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		var users []User
+		err = s.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			users = append(users, usr)
+			return nil
+		})
+
+		assert.ErrorIs(t, err, databaseError)
+		assert.Empty(t, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
+
+		s := NewUserStorage(db, time.Second)
+
+		expErr := errors.New("broken pipe")
+		calls := 0
+		err = s.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			calls++
+			return expErr
+		})
+
+		assert.Equal(t, expErr, err)
+		assert.Equal(t, 1, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok replica lost falls back to primary", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		replicaDB, replicaMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer replicaDB.Close()
+
+		replicaRows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt).RowError(1, &pq.Error{Code: "57P03"})
+		replicaMock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(replicaRows)
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, nil, user2.CreatedAt, user2.UpdatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersSQL)).WillReturnRows(rows)
+
+		s := NewReplicatedUserStorage(db, replicaDB, time.Second, time.Minute)
+
+		var users []User
+		err = s.ExportUsers(context.Background(), configuration.UsersFilter{}, func(usr User) error {
+			users = append(users, usr)
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []User{user1, user2}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
 	})
 }
 
@@ -106,12 +287,12 @@ func TestStorage_User(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "age"}).AddRow(user1.UserId, user1.Name, user1.Age)
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt)
 		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnRows(rows)
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		user, err := s.User(user1.UserId)
+		user, err := s.User(context.Background(), user1.UserId)
 
 		assert.NoError(t, err)
 		assert.Equal(t, user1, user)
@@ -124,9 +305,9 @@ func TestStorage_User(t *testing.T) {
 
 		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnError(databaseError)
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		_, err = s.User(user1.UserId)
+		_, err = s.User(context.Background(), user1.UserId)
 
 		assert.Error(t, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -139,56 +320,308 @@ func TestStorage_User(t *testing.T) {
 
 		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillReturnError(sql.ErrNoRows)
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		_, err = s.User(user1.UserId)
+		_, err = s.User(context.Background(), user1.UserId)
 
 		assert.Equal(t, UserNotFoundErr, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
+func TestStorage_statementTimeout(t *testing.T) {
+	t.Run("statement timeout error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows(userColumns))
+
+		s := NewUserStorage(db, 10*time.Millisecond)
+
+		_, err = s.User(context.Background(), user1.UserId)
+
+		assert.Equal(t, StatementTimeoutErr, err)
+	})
+
+	t.Run("context canceled error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillDelayFor(time.Second).WillReturnRows(userRows(user1))
+
+		s := NewUserStorage(db, time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		err = s.DeleteUser(ctx, user1.UserId)
+
+		assert.Error(t, err)
+		assert.NotEqual(t, StatementTimeoutErr, err)
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		rows := sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, nil, user1.CreatedAt, user1.UpdatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserSQL)).WithArgs(user1.UserId).WillDelayFor(20 * time.Millisecond).WillReturnRows(rows)
+
+		s := NewUserStorage(db, 0)
+
+		user, err := s.User(context.Background(), user1.UserId)
+
+		assert.NoError(t, err)
+		assert.Equal(t, user1, user)
+	})
+}
+
 func TestStorage_CreateUser(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationCreate, nil, userSnapshot(&user1), "support").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		require.NoError(t, s.CreateUser(user1))
+		usr, err := s.CreateUser(WithPrincipal(context.Background(), "support"), user1)
+		require.NoError(t, err)
+		assert.Equal(t, user1, usr)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("user already exists error", func(t *testing.T) {
-		expErr := errors.New(`pq: duplicate key value violates unique constraint "user_id_pk"`)
+		expErr := &pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "user_id_pk"`}
 
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnError(expErr)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnError(expErr)
+		mock.ExpectRollback()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		err = s.CreateUser(user1)
+		_, err = s.CreateUser(context.Background(), user1)
 
 		assert.Equal(t, UserAlreadyExistsErr, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("history error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("database error", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnError(databaseError)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnError(databaseError)
+		mock.ExpectRollback()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		err = s.CreateUser(user1)
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin().WillReturnError(databaseError)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("commit serialization failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit().WillReturnError(&pq.Error{Code: "40001"})
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.ErrorIs(t, err, SerializationFailureErr)
+		assert.False(t, retryableErr(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("commit connection lost", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit().WillReturnError(&pq.Error{Code: "57P01"})
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.ErrorIs(t, err, ConnectionLostErr)
+		assert.False(t, retryableErr(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("statement connection lost", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnError(&pq.Error{Code: "08006"})
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.ErrorIs(t, err, ConnectionLostErr)
+		assert.False(t, retryableErr(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin connection lost", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin().WillReturnError(&pq.Error{Code: "57P03"})
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUser(context.Background(), user1)
+
+		assert.ErrorIs(t, err, ConnectionLostErr)
+		assert.True(t, retryableErr(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStorage_CreateUsers(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationCreate, nil, userSnapshot(&user1), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user2.UserId, user2.Name, user2.Age).WillReturnRows(userRows(user2))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user2.UserId, OperationCreate, nil, userSnapshot(&user2), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		errs, err := s.CreateUsers(context.Background(), []User{user1, user2}, true)
+
+		require.NoError(t, err)
+		assert.Equal(t, []error{nil, nil}, errs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("user already exists error atomic", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user2.UserId, user2.Name, user2.Age).WillReturnRows(userRows(user2))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		errs, err := s.CreateUsers(context.Background(), []User{user1, user2}, true)
+
+		require.NoError(t, err)
+		assert.Equal(t, []error{UserAlreadyExistsErr, nil}, errs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("user already exists error best effort", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user2.UserId, user2.Name, user2.Age).WillReturnRows(userRows(user2))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		errs, err := s.CreateUsers(context.Background(), []User{user1, user2}, false)
+
+		require.NoError(t, err)
+		assert.Equal(t, []error{UserAlreadyExistsErr, nil}, errs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.CreateUsers(context.Background(), []User{user1, user2}, false)
 
 		assert.Equal(t, databaseError, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -196,16 +629,70 @@ func TestStorage_CreateUser(t *testing.T) {
 }
 
 func TestStorage_UpdateUser(t *testing.T) {
+	updated := User{UserId: user1.UserId, Name: user1.Name, Age: user1.Age, Version: 2}
+
 	t.Run("ok", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(updateUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(updateUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age, 0).WillReturnRows(userRows(updated))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationUpdate, userSnapshot(&user1), userSnapshot(&updated), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		usr, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Name: stringPtr(user1.Name), Age: intPtr(user1.Age)})
+
+		require.NoError(t, err)
+		assert.Equal(t, updated, usr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok expected version", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(updateUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age, user1.Version).WillReturnRows(userRows(updated))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		require.NoError(t, s.UpdateUser(user1))
+		usr, err := s.UpdateUser(context.Background(), patchOf(user1))
+
+		require.NoError(t, err)
+		assert.Equal(t, updated, usr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok partial", func(t *testing.T) {
+		partial := User{UserId: user1.UserId, Name: user1.Name, Age: 43, Version: 2}
+
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(updateUserSQL)).WithArgs(user1.UserId, nil, 43, 0).WillReturnRows(userRows(partial))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationUpdate, userSnapshot(&user1), userSnapshot(&partial), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		usr, err := s.UpdateUser(context.Background(), UserPatch{UserId: user1.UserId, Age: intPtr(43)})
+
+		require.NoError(t, err)
+		assert.Equal(t, partial, usr)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -214,24 +701,162 @@ func TestStorage_UpdateUser(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(updateUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UpdateUser(context.Background(), patchOf(user1))
+
+		assert.Equal(t, UserNotFoundErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("deleted user not found error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(
+			sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, time.Now(), user1.CreatedAt, user1.UpdatedAt),
+		)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UpdateUser(context.Background(), patchOf(user1))
+
+		assert.Equal(t, UserNotFoundErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("user version mismatch error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(updated))
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UpdateUser(context.Background(), patchOf(user1))
+
+		assert.Equal(t, UserVersionMismatchErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(updateUserSQL)).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.UpdateUser(context.Background(), patchOf(user1))
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStorage_PutUser(t *testing.T) {
+	replaced := User{UserId: user1.UserId, Name: "John Replaced", Age: 50, Version: 2}
+
+	t.Run("ok created", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationCreate, nil, userSnapshot(&user1), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
 
-		s := NewUserStorage(db)
+		usr, created, err := s.PutUser(context.Background(), user1)
 
-		assert.Equal(t, UserNotFoundErr, s.UpdateUser(user1))
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, user1, usr)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
-	t.Run("rows affected error", func(t *testing.T) {
+	t.Run("ok updated", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(updateUserSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnResult(sqlmock.NewErrorResult(databaseError))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(upsertUserSQL)).WithArgs(replaced.UserId, replaced.Name, replaced.Age).WillReturnRows(userRows(replaced))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationUpdate, userSnapshot(&user1), userSnapshot(&replaced), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
 
-		s := NewUserStorage(db)
+		usr, created, err := s.PutUser(context.Background(), User{UserId: replaced.UserId, Name: replaced.Name, Age: replaced.Age})
 
-		assert.Equal(t, databaseError, s.UpdateUser(user1))
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, replaced, usr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok concurrently created user is updated", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(replaced.UserId, replaced.Name, replaced.Age).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(upsertUserSQL)).WithArgs(replaced.UserId, replaced.Name, replaced.Age).WillReturnRows(userRows(replaced))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationUpdate, userSnapshot(&user1), userSnapshot(&replaced), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		usr, created, err := s.PutUser(context.Background(), User{UserId: replaced.UserId, Name: replaced.Name, Age: replaced.Age})
+
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, replaced, usr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("user deleted error", func(t *testing.T) {
+		deletedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(
+			sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, deletedAt, user1.CreatedAt, user1.UpdatedAt),
+		)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, _, err = s.PutUser(context.Background(), user1)
+
+		assert.Equal(t, UserDeletedErr, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -240,26 +865,117 @@ func TestStorage_UpdateUser(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(updateUserSQL)).WillReturnError(databaseError)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
 
-		s := NewUserStorage(db)
+		_, _, err = s.PutUser(context.Background(), user1)
 
-		assert.Equal(t, databaseError, s.UpdateUser(user1))
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStorage_ImportUsers(t *testing.T) {
+	const user3Id = "0f2e5c1a-3b9d-4c7e-8a61-2d5f9b0e4c33"
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserIfAbsentSQL)).WithArgs(user1.UserId, user1.Name, user1.Age).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationCreate, nil, userSnapshot(&user1), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user2.UserId).WillReturnRows(
+			sqlmock.NewRows(userColumns).AddRow(user2.UserId, user2.Name, user2.Age, user2.Version, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), user2.CreatedAt, user2.UpdatedAt),
+		)
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		results, err := s.ImportUsers(context.Background(), []User{user1, user2}, false)
+
+		require.NoError(t, err)
+		assert.Equal(t, []ImportResult{{Created: true}, {Err: UserDeletedErr}}, results)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ok dry run", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersDeletedSQL)).WithArgs(`["` + user1.UserId + `","` + user2.UserId + `","` + user3Id + `"]`).WillReturnRows(
+			sqlmock.NewRows([]string{"user_id", "deleted"}).AddRow(user2.UserId, false).AddRow(user3Id, true),
+		)
+
+		s := NewUserStorage(db, time.Second)
+
+		results, err := s.ImportUsers(context.Background(), []User{user1, user2, {UserId: user3Id}}, true)
+
+		require.NoError(t, err)
+		assert.Equal(t, []ImportResult{{Created: true}, {Created: false}, {Err: UserDeletedErr}}, results)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dry run database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(selectUsersDeletedSQL)).WillReturnError(databaseError)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.ImportUsers(context.Background(), []User{user1}, true)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.ImportUsers(context.Background(), []User{user1}, false)
+
+		assert.ErrorIs(t, err, databaseError)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
 func TestStorage_DeleteUser(t *testing.T) {
+	deletedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	deleted := User{UserId: user1.UserId, Name: user1.Name, Age: user1.Age, Version: user1.Version, DeletedAt: &deletedAt}
+
 	t.Run("ok", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(deleteUserSQL)).WithArgs(user1.UserId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(deleteUserSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(deleted))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationDelete, userSnapshot(&user1), userSnapshot(&deleted), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		require.NoError(t, s.DeleteUser(user1.UserId))
+		require.NoError(t, s.DeleteUser(context.Background(), user1.UserId))
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -268,24 +984,28 @@ func TestStorage_DeleteUser(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(deleteUserSQL)).WithArgs(user1.UserId).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(sqlmock.NewRows(userColumns))
+		mock.ExpectRollback()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		assert.Equal(t, UserNotFoundErr, s.DeleteUser(user1.UserId))
+		assert.Equal(t, UserNotFoundErr, s.DeleteUser(context.Background(), user1.UserId))
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
-	t.Run("rows affected error", func(t *testing.T) {
+	t.Run("already deleted user not found error", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(deleteUserSQL)).WithArgs(user1.UserId).WillReturnResult(sqlmock.NewErrorResult(databaseError))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(deleted))
+		mock.ExpectRollback()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		assert.Equal(t, databaseError, s.DeleteUser(user1.UserId))
+		assert.Equal(t, UserNotFoundErr, s.DeleteUser(context.Background(), user1.UserId))
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -294,21 +1014,169 @@ func TestStorage_DeleteUser(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(deleteUserSQL)).WillReturnError(databaseError)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectQuery(regexp.QuoteMeta(deleteUserSQL)).WillReturnError(databaseError)
+		mock.ExpectRollback()
 
-		s := NewUserStorage(db)
+		s := NewUserStorage(db, time.Second)
 
-		assert.Equal(t, databaseError, s.DeleteUser(user1.UserId))
+		assert.Equal(t, databaseError, s.DeleteUser(context.Background(), user1.UserId))
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
-func TestAlreadyExistsErr(t *testing.T) {
-	t.Run("already exists error", func(t *testing.T) {
-		assert.True(t, AlreadyExistsErr(errors.New("pq: duplicate key value violates unique constraint")))
+func TestStorage_RestoreUser(t *testing.T) {
+	deletedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	deleted := User{UserId: user1.UserId, Name: user1.Name, Age: user1.Age, Version: user1.Version, DeletedAt: &deletedAt}
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(deleted))
+		mock.ExpectQuery(regexp.QuoteMeta(restoreUserSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserHistorySQL)).WithArgs(user1.UserId, OperationRestore, userSnapshot(&deleted), userSnapshot(&user1), AnonymousPrincipal).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(insertUserEventSQL)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		s := NewUserStorage(db, time.Second)
+
+		require.NoError(t, s.RestoreUser(context.Background(), user1.UserId))
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
-	t.Run("not already exists error", func(t *testing.T) {
-		assert.False(t, AlreadyExistsErr(errors.New("pq: duplicate key value violates unique")))
+	t.Run("user not found error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WithArgs(user1.UserId).WillReturnRows(userRows(user1))
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		assert.Equal(t, UserNotFoundErr, s.RestoreUser(context.Background(), user1.UserId))
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(selectUserForUpdateSQL)).WillReturnError(databaseError)
+		mock.ExpectRollback()
+
+		s := NewUserStorage(db, time.Second)
+
+		assert.Equal(t, databaseError, s.RestoreUser(context.Background(), user1.UserId))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStorage_PurgeUsers(t *testing.T) {
+	deletedBefore := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectExec(regexp.QuoteMeta(purgeUsersSQL)).WithArgs(deletedBefore).WillReturnResult(sqlmock.NewResult(0, 3))
+
+		s := NewUserStorage(db, time.Second)
+
+		purged, err := s.PurgeUsers(context.Background(), deletedBefore)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), purged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectExec(regexp.QuoteMeta(purgeUsersSQL)).WillReturnError(databaseError)
+
+		s := NewUserStorage(db, time.Second)
+
+		_, err = s.PurgeUsers(context.Background(), deletedBefore)
+
+		assert.Equal(t, databaseError, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func patchOf(usr User) UserPatch {
+	return UserPatch{UserId: usr.UserId, Name: stringPtr(usr.Name), Age: intPtr(usr.Age), Version: usr.Version}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func untimed(usr User) User {
+	usr.CreatedAt, usr.UpdatedAt = time.Time{}, time.Time{}
+	return usr
+}
+
+func untimedPtr(usr *User) *User {
+	if usr == nil {
+		return nil
+	}
+
+	u := untimed(*usr)
+	return &u
+}
+
+func untimedUsers(users []User) []User {
+	untimedUsers := make([]User, 0, len(users))
+	for _, usr := range users {
+		untimedUsers = append(untimedUsers, untimed(usr))
+	}
+
+	return untimedUsers
+}
+
+func untimedResponse(resp UsersResponse) UsersResponse {
+	resp.Users = untimedUsers(resp.Users)
+	return resp
+}
+
+func userRows(usr User) *sqlmock.Rows {
+	var deletedAt interface{}
+	if usr.DeletedAt != nil {
+		deletedAt = *usr.DeletedAt
+	}
+
+	return sqlmock.NewRows(userColumns).AddRow(usr.UserId, usr.Name, usr.Age, usr.Version, deletedAt, usr.CreatedAt, usr.UpdatedAt)
+}
+
+func Test_scanUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	deletedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(userColumns).AddRow(user1.UserId, user1.Name, user1.Age, user1.Version, deletedAt, user1.CreatedAt, user1.UpdatedAt))
+
+	usr, err := scanUser(db.QueryRow("SELECT"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, User{UserId: user1.UserId, Name: user1.Name, Age: user1.Age, Version: user1.Version, DeletedAt: &deletedAt}, usr)
 }
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"app/internal/configuration"
+)
+
+var usersSortColumns = map[string]string{
+	configuration.SortFieldUserId: `"user_id"`,
+	configuration.SortFieldName:   `"name"`,
+	configuration.SortFieldAge:    `"age"`,
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type usersQuery struct {
+	dialect    *dialect
+	conditions []string
+	args       []interface{}
+}
+
+func buildUsersQuery(d *dialect, filter configuration.UsersFilter, after usersCursor, limit int) (string, []interface{}) {
+	q := &usersQuery{dialect: d}
+
+	if filter.Deleted {
+		q.conditions = append(q.conditions, `"deleted_at" IS NOT NULL`)
+	} else {
+		q.conditions = append(q.conditions, `"deleted_at" IS NULL`)
+	}
+
+	if filter.NamePrefix != "" {
+		q.conditions = append(q.conditions, d.like(`"name"`, q.arg(likeEscaper.Replace(filter.NamePrefix)+"%")))
+	}
+
+	if filter.NameContains != "" {
+		q.conditions = append(q.conditions, d.like(`"name"`, q.arg("%"+likeEscaper.Replace(filter.NameContains)+"%")))
+	}
+
+	if filter.AgeMin > 0 {
+		q.where(`"age" >= %s`, filter.AgeMin)
+	}
+
+	if filter.AgeMax > 0 {
+		q.where(`"age" <= %s`, filter.AgeMax)
+	}
+
+	sortKeys := filter.SortKeys()
+
+	if after.UserId != "" {
+		q.keyset(sortKeys, after)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(d.selectUsersBaseSQL())
+
+	if len(q.conditions) > 0 {
+		sb.WriteString("\nWHERE\n    ")
+		sb.WriteString(strings.Join(q.conditions, "\n    AND "))
+	}
+
+	orderBy := make([]string, 0, len(sortKeys))
+	for _, srt := range sortKeys {
+		direction := "ASC"
+		if srt.Desc() {
+			direction = "DESC"
+		}
+
+		orderBy = append(orderBy, usersSortColumns[srt.Field]+" "+direction)
+	}
+
+	sb.WriteString("\nORDER BY\n    ")
+	sb.WriteString(strings.Join(orderBy, ", "))
+
+	if limit > 0 {
+		sb.WriteString("\nLIMIT ")
+		sb.WriteString(q.arg(limit))
+	}
+
+	sb.WriteString(";")
+
+	return sb.String(), q.args
+}
+
+func (q *usersQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+
+	return q.dialect.placeholder(len(q.args))
+}
+
+func (q *usersQuery) where(condition string, v interface{}) {
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, q.arg(v)))
+}
+
+func (q *usersQuery) keyset(sortKeys []configuration.UsersSort, after usersCursor) {
+	alternatives := make([]string, 0, len(sortKeys))
+
+	for i, srt := range sortKeys {
+		terms := make([]string, 0, i+1)
+
+		for _, prev := range sortKeys[:i] {
+			terms = append(terms, fmt.Sprintf("%s = %s", usersSortColumns[prev.Field], q.arg(after.value(prev.Field))))
+		}
+
+		op := ">"
+		if srt.Desc() {
+			op = "<"
+		}
+
+		terms = append(terms, fmt.Sprintf("%s %s %s", usersSortColumns[srt.Field], op, q.arg(after.value(srt.Field))))
+
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	q.conditions = append(q.conditions, "("+strings.Join(alternatives, " OR ")+")")
+}
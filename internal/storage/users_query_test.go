@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"testing"
+
+	"app/internal/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_buildUsersQuery(t *testing.T) {
+	type args struct {
+		filter configuration.UsersFilter
+		after  usersCursor
+		limit  int
+	}
+	type exp struct {
+		query string
+		args  []interface{}
+	}
+	tcs := []struct {
+		name string
+		args args
+		exp  exp
+	}{
+		{
+			name: "no filter",
+			args: args{
+				filter: configuration.UsersFilter{},
+				limit:  11,
+			},
+			exp: exp{
+				query: selectUsersSQL +
+					"WHERE\n" +
+					"    \"deleted_at\" IS NULL\n" +
+					"ORDER BY\n    \"user_id\" ASC\nLIMIT $1;",
+				args: []interface{}{11},
+			},
+		},
+		{
+			name: "no limit",
+			args: args{
+				filter: configuration.UsersFilter{},
+			},
+			exp: exp{
+				query: selectUsersSQL +
+					"WHERE\n" +
+					"    \"deleted_at\" IS NULL\n" +
+					"ORDER BY\n    \"user_id\" ASC;",
+			},
+		},
+		{
+			name: "filter and sort",
+			args: args{
+				filter: configuration.UsersFilter{
+					NamePrefix:   "Jo",
+					NameContains: "50%_off",
+					AgeMin:       18,
+					AgeMax:       65,
+					Sort: []configuration.UsersSort{
+						{Field: configuration.SortFieldAge, Direction: configuration.SortDirectionDesc},
+						{Field: configuration.SortFieldName},
+					},
+				},
+				limit: 11,
+			},
+			exp: exp{
+				query: selectUsersSQL +
+					"WHERE\n" +
+					"    \"deleted_at\" IS NULL\n" +
+					"    AND \"name\" ILIKE $1 ESCAPE '\\'\n" +
+					"    AND \"name\" ILIKE $2 ESCAPE '\\'\n" +
+					"    AND \"age\" >= $3\n" +
+					"    AND \"age\" <= $4\n" +
+					"ORDER BY\n    \"age\" DESC, \"name\" ASC, \"user_id\" ASC\nLIMIT $5;",
+				args: []interface{}{"Jo%", `%50\%\_off%`, 18, 65, 11},
+			},
+		},
+		{
+			name: "keyset deleted",
+			args: args{
+				filter: configuration.UsersFilter{
+					Sort: []configuration.UsersSort{
+						{Field: configuration.SortFieldAge, Direction: configuration.SortDirectionDesc},
+					},
+					Deleted: true,
+				},
+				after: usersCursor{UserId: user1.UserId, Name: user1.Name, Age: user1.Age},
+				limit: 11,
+			},
+			exp: exp{
+				query: selectUsersSQL +
+					"WHERE\n" +
+					"    \"deleted_at\" IS NOT NULL\n" +
+					"    AND ((\"age\" < $1) OR (\"age\" = $2 AND \"user_id\" > $3))\n" +
+					"ORDER BY\n    \"age\" DESC, \"user_id\" ASC\nLIMIT $4;",
+				args: []interface{}{user1.Age, user1.Age, user1.UserId, 11},
+			},
+		},
+	}
+
+	t.Run("sqlite", func(t *testing.T) {
+		query, args := buildUsersQuery(sqliteDialect, configuration.UsersFilter{NamePrefix: "Jo"}, usersCursor{UserId: user1.UserId}, 11)
+
+		assert.Equal(t, sqliteSelectUsersSQL+
+			"WHERE\n"+
+			"    \"deleted_at\" IS NULL\n"+
+			"    AND \"name\" LIKE ?1 ESCAPE '\\'\n"+
+			"    AND ((\"user_id\" > ?2))\n"+
+			"ORDER BY\n    \"user_id\" ASC\nLIMIT ?3;", query)
+		assert.Equal(t, []interface{}{"Jo%", user1.UserId, 11}, args)
+	})
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			query, args := buildUsersQuery(postgresDialect, tc.args.filter, tc.args.after, tc.args.limit)
+
+			assert.Equal(t, tc.exp.query, query)
+			assert.Equal(t, tc.exp.args, args)
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package sql
+
+import "embed"
+
+//go:embed src/*.sql
+var Migrations embed.FS
@@ -0,0 +1,5 @@
+DELETE FROM "user_service"."users" WHERE "deleted_at" IS NOT NULL;
+
+DROP INDEX "user_service"."users_deleted_at_index";
+
+ALTER TABLE "user_service"."users" DROP COLUMN "deleted_at";
@@ -0,0 +1,3 @@
+ALTER TABLE "user_service"."users" ADD COLUMN "deleted_at" TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX "users_deleted_at_index" ON "user_service"."users" USING btree ("deleted_at") WHERE "deleted_at" IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE "user_service"."users" DROP COLUMN "version";
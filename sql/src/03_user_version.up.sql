@@ -0,0 +1 @@
+ALTER TABLE "user_service"."users" ADD COLUMN "version" INTEGER NOT NULL DEFAULT 1;
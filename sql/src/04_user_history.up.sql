@@ -0,0 +1,12 @@
+CREATE TABLE "user_service"."user_history" (
+    "history_id" BIGSERIAL NOT NULL,
+    "user_id" UUID NOT NULL,
+    "operation" VARCHAR(16) NOT NULL,
+    "before" JSONB,
+    "after" JSONB,
+    "principal" VARCHAR(255) NOT NULL,
+    "changed_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "user_service"."user_history" ADD CONSTRAINT "user_history_pk" PRIMARY KEY ("history_id");
+CREATE INDEX "user_history_user_id_index" ON "user_service"."user_history" USING btree ("user_id", "history_id");
@@ -0,0 +1,6 @@
+DROP TRIGGER "users_set_updated_at" ON "user_service"."users";
+DROP FUNCTION "user_service"."users_set_updated_at"();
+
+ALTER TABLE "user_service"."users"
+    DROP COLUMN "created_at",
+    DROP COLUMN "updated_at";
@@ -0,0 +1,18 @@
+ALTER TABLE "user_service"."users"
+    ADD COLUMN "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    ADD COLUMN "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+CREATE INDEX "users_created_at_index" ON "user_service"."users" USING btree ("created_at");
+CREATE INDEX "users_updated_at_index" ON "user_service"."users" USING btree ("updated_at");
+
+CREATE FUNCTION "user_service"."users_set_updated_at"() RETURNS TRIGGER AS $$
+BEGIN
+    NEW."created_at" = OLD."created_at";
+    NEW."updated_at" = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "users_set_updated_at"
+    BEFORE UPDATE ON "user_service"."users"
+    FOR EACH ROW EXECUTE PROCEDURE "user_service"."users_set_updated_at"();
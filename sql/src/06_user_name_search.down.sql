@@ -0,0 +1,5 @@
+DROP INDEX "user_service"."users_name_trgm_index";
+DROP FUNCTION "user_service"."normalize_name"(TEXT);
+
+DROP EXTENSION IF EXISTS "unaccent";
+DROP EXTENSION IF EXISTS "pg_trgm";
@@ -0,0 +1,8 @@
+CREATE EXTENSION IF NOT EXISTS "pg_trgm" WITH SCHEMA "public";
+CREATE EXTENSION IF NOT EXISTS "unaccent" WITH SCHEMA "public";
+
+CREATE FUNCTION "user_service"."normalize_name"(TEXT) RETURNS TEXT AS $$
+    SELECT lower("public"."unaccent"('"public"."unaccent"'::REGDICTIONARY, $1));
+$$ LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE;
+
+CREATE INDEX "users_name_trgm_index" ON "user_service"."users" USING gin ("user_service"."normalize_name"("name") "public"."gin_trgm_ops");
@@ -0,0 +1,13 @@
+CREATE TABLE "user_service"."user_outbox" (
+    "outbox_id" BIGSERIAL NOT NULL,
+    "event_id" UUID NOT NULL,
+    "event_type" VARCHAR(32) NOT NULL,
+    "user_id" UUID NOT NULL,
+    "payload" JSONB NOT NULL,
+    "occurred_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "last_error" TEXT
+);
+
+ALTER TABLE "user_service"."user_outbox" ADD CONSTRAINT "user_outbox_pk" PRIMARY KEY ("outbox_id");
+CREATE UNIQUE INDEX "user_outbox_event_id_index" ON "user_service"."user_outbox" USING btree ("event_id");